@@ -0,0 +1,73 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/ccremer/clustercode-api-gateway/jobs"
+	"github.com/ccremer/clustercode-api-gateway/schema"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type (
+	ErrorResponse struct {
+		Error      string             `json:"error"`
+		Details    []string           `json:"details,omitempty"`
+		Violations []schema.Violation `json:"violations,omitempty"`
+	}
+)
+
+var (
+	// closed when the server shuts down, so that long-lived streams end.
+	shutdown     = make(chan struct{})
+	shutdownOnce = &sync.Once{}
+	Tracker      *jobs.Tracker
+	// PublishTimeout limits how long a request waits for the broker to confirm a message.
+	PublishTimeout = 5 * time.Second
+	// MaxMessageSize limits the size of a message in a validation request, in bytes.
+	MaxMessageSize int64 = 1 << 20
+)
+
+// CloseStreams ends all Server-Sent Event streams and WebSocket connections.
+// http.Server.Shutdown does not wait for hijacked connections and would wait for streams until it times out.
+func CloseStreams() {
+	shutdownOnce.Do(func() {
+		close(shutdown)
+	})
+	if Events != nil {
+		Events.closeAll()
+	}
+}
+
+func writeJson(writer http.ResponseWriter, status int, value interface{}) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	if err := json.NewEncoder(writer).Encode(value); err != nil {
+		log.Warn(err)
+	}
+}
+
+func toJsonString(value interface{}) (string, error) {
+	data, err := json.Marshal(value)
+	return string(data), err
+}
+
+func writeError(writer http.ResponseWriter, status int, message string, details ...string) {
+	writeJson(writer, status, &ErrorResponse{
+		Error:   message,
+		Details: details,
+	})
+}
+
+// writeValidationError answers with 400 and lists the schema violations, if the error provides them.
+func writeValidationError(writer http.ResponseWriter, message string, err error) {
+	response := &ErrorResponse{
+		Error:   message,
+		Details: []string{err.Error()},
+	}
+	if validationErr, ok := err.(*schema.ValidationError); ok {
+		response.Violations = validationErr.Violations
+	}
+	writeJson(writer, http.StatusBadRequest, response)
+}
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"context"
+	"github.com/ccremer/clustercode-api-gateway/entities"
+	"github.com/ccremer/clustercode-api-gateway/messaging"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+)
+
+type (
+	// ReplayDeadLetterRequest optionally replaces the body of the message before it is replayed.
+	ReplayDeadLetterRequest struct {
+		Body *string `json:"body,omitempty"`
+	}
+	DeadLetterResponse struct {
+		ID    string `json:"id"`
+		State string `json:"state"`
+	}
+	invalidPayloadError struct {
+		err error
+	}
+)
+
+const (
+	DeadLetterReplayed = "replayed"
+	DeadLetterDropped  = "dropped"
+
+	defaultDeadLetterLimit = 100
+	maxDeadLetterLimit     = 1000
+)
+
+func (e invalidPayloadError) Error() string {
+	return e.err.Error()
+}
+
+// HandleListDeadLetters returns the messages at the head of the dead-letter queue. They remain in the queue.
+func HandleListDeadLetters(writer http.ResponseWriter, request *http.Request) {
+	limit := defaultDeadLetterLimit
+	if value := request.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxDeadLetterLimit {
+			writeError(writer, http.StatusBadRequest, "limit must be a number between 1 and "+strconv.Itoa(maxDeadLetterLimit))
+			return
+		}
+		limit = parsed
+	}
+	messages, err := Messaging.PeekDeadLetters(limit)
+	if err != nil {
+		writeDeadLetterError(writer, "", err)
+		return
+	}
+	writeJson(writer, http.StatusOK, messages)
+}
+
+// HandleReplayDeadLetter republishes the message to its original queue. The body can be replaced, but it has to
+// be valid according to the schema version of the message either way, otherwise the message would just be
+// dead-lettered again.
+func HandleReplayDeadLetter(writer http.ResponseWriter, request *http.Request) {
+	id := mux.Vars(request)["id"]
+	body, err := ioutil.ReadAll(request.Body)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, "could not read request body", err.Error())
+		return
+	}
+	replay := ReplayDeadLetterRequest{}
+	if len(body) > 0 {
+		if err := entities.FromJson(string(body), &replay); err != nil {
+			writeError(writer, http.StatusBadRequest, "request body is not valid JSON", err.Error())
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(request.Context(), PublishTimeout)
+	defer cancel()
+	err = Messaging.ReplayDeadLetter(ctx, id, func(message *messaging.DeadLetterMessage) (string, error) {
+		payload := message.Body
+		if replay.Body != nil {
+			payload = *replay.Body
+		}
+		version := entities.SchemaVersionOf(message.Headers)
+		if valid, err := entities.Validator.ValidateXmlVersion(&payload, version); !valid {
+			return "", invalidPayloadError{err: err}
+		}
+		return payload, nil
+	})
+	if err != nil {
+		writeDeadLetterError(writer, id, err)
+		return
+	}
+	log.WithField("id", id).Info("replayed dead-lettered message")
+	writeJson(writer, http.StatusOK, &DeadLetterResponse{ID: id, State: DeadLetterReplayed})
+}
+
+// HandleDropDeadLetter removes the message from the dead-letter queue for good.
+func HandleDropDeadLetter(writer http.ResponseWriter, request *http.Request) {
+	id := mux.Vars(request)["id"]
+	if err := Messaging.DropDeadLetter(id); err != nil {
+		writeDeadLetterError(writer, id, err)
+		return
+	}
+	log.WithField("id", id).Info("dropped dead-lettered message")
+	writeJson(writer, http.StatusOK, &DeadLetterResponse{ID: id, State: DeadLetterDropped})
+}
+
+func writeDeadLetterError(writer http.ResponseWriter, id string, err error) {
+	switch invalid := err.(type) {
+	case invalidPayloadError:
+		writeValidationError(writer, "message would be rejected by the schema", invalid.err)
+		return
+	}
+	switch err {
+	case messaging.ErrDeadLetterNotFound:
+		writeError(writer, http.StatusNotFound, "dead-lettered message not found", id)
+	case messaging.ErrUnknownExchange, messaging.ErrUnknownQueue:
+		writeError(writer, http.StatusConflict, "message can't be replayed", err.Error())
+	case context.DeadlineExceeded, context.Canceled:
+		writeError(writer, http.StatusServiceUnavailable, "message could not be replayed in time", err.Error())
+	case messaging.ErrDeadLettersDisabled:
+		writeError(writer, http.StatusNotFound, "dead-letter exchange is not enabled")
+	default:
+		log.WithFields(log.Fields{
+			"id":    id,
+			"error": err,
+		}).Warn("could not access dead-letter queue")
+		writeError(writer, http.StatusServiceUnavailable, "dead-letter queue is not available", err.Error())
+	}
+}
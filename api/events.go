@@ -0,0 +1,233 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/ccremer/clustercode-api-gateway/entities"
+	"github.com/gorilla/websocket"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	writeWait  = 10 * time.Second
+	pongWait   = 60 * time.Second
+	pingPeriod = pongWait * 9 / 10
+	// Clients that have this many events pending are considered too slow and get disconnected.
+	eventClientBuffer = 256
+)
+
+type (
+	// EventHub relays every consumed event to the connected WebSocket clients.
+	EventHub struct {
+		clients map[*eventClient]bool
+		m       *sync.Mutex
+		// closed is set by closeAll, clients connecting afterwards are rejected.
+		closed bool
+	}
+	EventFilter struct {
+		JobIDs []string `json:"jobIds,omitempty"`
+		Types  []string `json:"types,omitempty"`
+	}
+	EventEnvelope struct {
+		Type  string          `json:"type"`
+		JobID string          `json:"jobId"`
+		Event json.RawMessage `json:"event"`
+	}
+	eventClient struct {
+		conn       *websocket.Conn
+		remoteAddr string
+		send       chan []byte
+		filter     EventFilter
+	}
+)
+
+var (
+	Events   *EventHub
+	upgrader = websocket.Upgrader{}
+)
+
+func NewEventHub() *EventHub {
+	return &EventHub{
+		clients: make(map[*eventClient]bool),
+		m:       &sync.Mutex{},
+	}
+}
+
+// Broadcast sends the event to all clients whose filter matches. It never blocks, so it is safe to register as
+// entities.EventListener: clients that can't keep up are dropped instead of stalling the consumer.
+func (h *EventHub) Broadcast(event entities.Message) {
+	eventType := entities.EventType(event)
+	jobID := entities.JobIDOf(event)
+	payload, err := entities.ToJson(event)
+	if err != nil {
+		log.WithField("error", err).Warn("could not serialize event")
+		return
+	}
+	message, err := json.Marshal(&EventEnvelope{
+		Type:  eventType,
+		JobID: jobID,
+		Event: json.RawMessage(payload),
+	})
+	if err != nil {
+		log.WithField("error", err).Warn("could not serialize event")
+		return
+	}
+
+	h.m.Lock()
+	defer h.m.Unlock()
+	for client := range h.clients {
+		if !client.filter.matches(eventType, jobID) {
+			continue
+		}
+		select {
+		case client.send <- message:
+		default:
+			log.WithField("remote_addr", client.remoteAddr).Warn("event client is too slow, disconnecting")
+			h.unregister(client)
+		}
+	}
+}
+
+// register adds the client and returns true, unless the hub has been closed.
+func (h *EventHub) register(client *eventClient) bool {
+	h.m.Lock()
+	defer h.m.Unlock()
+	if h.closed {
+		return false
+	}
+	h.clients[client] = true
+	return true
+}
+
+func (h *EventHub) isClosed() bool {
+	h.m.Lock()
+	defer h.m.Unlock()
+	return h.closed
+}
+
+func (h *EventHub) unregister(client *eventClient) {
+	if h.clients[client] {
+		delete(h.clients, client)
+		close(client.send)
+	}
+}
+
+func (h *EventHub) closeAll() {
+	h.m.Lock()
+	defer h.m.Unlock()
+	h.closed = true
+	for client := range h.clients {
+		h.unregister(client)
+	}
+}
+
+func (h *EventHub) setFilter(client *eventClient, filter EventFilter) {
+	h.m.Lock()
+	defer h.m.Unlock()
+	client.filter = filter
+}
+
+func (f EventFilter) matches(eventType string, jobID string) bool {
+	return containsOrEmpty(f.Types, eventType) && containsOrEmpty(f.JobIDs, jobID)
+}
+
+func containsOrEmpty(values []string, value string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// HandleEvents upgrades the connection to a WebSocket and relays the lifecycle events as JSON.
+// The initial filter can be given with "jobId" and "type" query parameters, the client can replace it at any time
+// by sending an EventFilter as JSON. Clients are rejected once the server is shutting down, see CloseStreams.
+func HandleEvents(writer http.ResponseWriter, request *http.Request) {
+	if Events.isClosed() {
+		writeError(writer, http.StatusServiceUnavailable, "server is shutting down")
+		return
+	}
+	conn, err := upgrader.Upgrade(writer, request, nil)
+	if err != nil {
+		log.WithField("error", err).Debug("could not upgrade to WebSocket")
+		return
+	}
+	query := request.URL.Query()
+	client := &eventClient{
+		conn:       conn,
+		remoteAddr: conn.RemoteAddr().String(),
+		send:       make(chan []byte, eventClientBuffer),
+		filter: EventFilter{
+			JobIDs: query["jobId"],
+			Types:  query["type"],
+		},
+	}
+	// The hub may have been closed during the upgrade.
+	if !Events.register(client) {
+		conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseGoingAway, "server is shutting down"), time.Now().Add(writeWait))
+		conn.Close()
+		return
+	}
+	log.WithField("remote_addr", client.remoteAddr).Debug("event client connected")
+
+	go client.writePump()
+	client.readPump(Events)
+}
+
+func (c *eventClient) readPump(hub *EventHub) {
+	defer func() {
+		hub.m.Lock()
+		hub.unregister(c)
+		hub.m.Unlock()
+		log.WithField("remote_addr", c.remoteAddr).Debug("event client disconnected")
+	}()
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+	for {
+		_, message, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		filter := EventFilter{}
+		if err := json.Unmarshal(message, &filter); err != nil {
+			log.WithField("error", err).Debug("ignoring invalid event filter")
+			continue
+		}
+		hub.setFilter(c, filter)
+	}
+}
+
+func (c *eventClient) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+	for {
+		select {
+		case message, open := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !open {
+				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/ccremer/clustercode-api-gateway/entities"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func connectEventClient(t *testing.T, query string) (*websocket.Conn, func()) {
+	Events = NewEventHub()
+	server := httptest.NewServer(http.HandlerFunc(HandleEvents))
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/v1/events" + query
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	assert.NoError(t, err)
+	// wait until the client is registered
+	for i := 0; i < 100 && countClients(Events) == 0; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	return conn, func() {
+		conn.Close()
+		server.Close()
+	}
+}
+
+func countClients(hub *EventHub) int {
+	hub.m.Lock()
+	defer hub.m.Unlock()
+	return len(hub.clients)
+}
+
+func TestHandleEvents_ShouldRelayMatchingEvents(t *testing.T) {
+	conn, closer := connectEventClient(t, "?type=SliceAddedEvent")
+	defer closer()
+
+	Events.Broadcast(&entities.TaskCancelledEvent{JobID: jobID})
+	Events.Broadcast(&entities.SliceAddedEvent{JobID: jobID, SliceNr: 3})
+
+	envelope := EventEnvelope{}
+	assert.NoError(t, conn.ReadJSON(&envelope))
+	assert.Equal(t, "SliceAddedEvent", envelope.Type)
+	assert.Equal(t, jobID, envelope.JobID)
+	assert.JSONEq(t, `{"JobID": "620b8251-52a1-4ecd-8adc-4fb280214bba", "SliceNr": 3, "Args": null}`, string(envelope.Event))
+}
+
+func TestHandleEvents_ShouldRejectClientsAfterClose(t *testing.T) {
+	Events = NewEventHub()
+	Events.closeAll()
+	server := httptest.NewServer(http.HandlerFunc(HandleEvents))
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/v1/events"
+	_, response, err := websocket.DefaultDialer.Dial(url, nil)
+	assert.Equal(t, websocket.ErrBadHandshake, err)
+	if assert.NotNil(t, response) {
+		assert.Equal(t, http.StatusServiceUnavailable, response.StatusCode)
+	}
+	assert.Equal(t, 0, countClients(Events))
+}
+
+func TestEventHub_ShouldNotRegisterClientsAfterClose(t *testing.T) {
+	hub := NewEventHub()
+	hub.closeAll()
+
+	assert.False(t, hub.register(&eventClient{send: make(chan []byte, 1)}))
+	assert.Empty(t, hub.clients)
+}
+
+func TestEventHub_Broadcast_ShouldDropSlowClients(t *testing.T) {
+	hub := NewEventHub()
+	client := &eventClient{send: make(chan []byte, 1)}
+	hub.register(client)
+
+	hub.Broadcast(&entities.TaskCancelledEvent{JobID: jobID})
+	hub.Broadcast(&entities.TaskCancelledEvent{JobID: jobID})
+
+	assert.Empty(t, hub.clients)
+	message, open := <-client.send
+	assert.True(t, open)
+	assert.True(t, json.Valid(message))
+	_, open = <-client.send
+	assert.False(t, open)
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"github.com/ccremer/clustercode-api-gateway/entities"
+	"github.com/ccremer/clustercode-api-gateway/messaging"
+	"net/http"
+)
+
+type (
+	HealthResponse struct {
+		Status       string                  `json:"status"`
+		SchemaLoaded bool                    `json:"schemaLoaded"`
+		RabbitMq     messaging.ServiceStatus `json:"rabbitmq"`
+	}
+)
+
+const (
+	StatusUp   = "UP"
+	StatusDown = "DOWN"
+)
+
+var Messaging messaging.Broker
+
+// HandleHealth is the liveness probe. It only fails if the gateway can't recover by itself, which is the case if
+// the schema could not be loaded. A lost RabbitMQ connection is reconnected automatically and only affects readiness.
+func HandleHealth(writer http.ResponseWriter, request *http.Request) {
+	response := newHealthResponse()
+	writeHealth(writer, response, response.SchemaLoaded)
+}
+
+// HandleReady is the readiness probe. It fails unless the schema is loaded, RabbitMQ is connected and all channels are open.
+func HandleReady(writer http.ResponseWriter, request *http.Request) {
+	response := newHealthResponse()
+	writeHealth(writer, response, response.SchemaLoaded && response.RabbitMq.IsReady())
+}
+
+func newHealthResponse() *HealthResponse {
+	response := &HealthResponse{
+		SchemaLoaded: entities.Validator.IsLoaded(),
+	}
+	if Messaging != nil {
+		response.RabbitMq = Messaging.Status()
+	}
+	return response
+}
+
+func writeHealth(writer http.ResponseWriter, response *HealthResponse, healthy bool) {
+	if healthy {
+		response.Status = StatusUp
+		writeJson(writer, http.StatusOK, response)
+	} else {
+		response.Status = StatusDown
+		writeJson(writer, http.StatusServiceUnavailable, response)
+	}
+}
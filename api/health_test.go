@@ -0,0 +1,50 @@
+package api
+
+import (
+	"github.com/ccremer/clustercode-api-gateway/entities"
+	"github.com/ccremer/clustercode-api-gateway/schema"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+var healthTests = []struct {
+	name           string
+	validator      *schema.Validator
+	handler        http.HandlerFunc
+	expectedStatus int
+}{
+	{
+		"Health_WithSchema_ShouldBeUp",
+		schema.NewXmlValidator("../schema/clustercode_v1.xsd"),
+		HandleHealth,
+		http.StatusOK,
+	},
+	{
+		"Health_WithoutSchema_ShouldBeDown",
+		&schema.Validator{},
+		HandleHealth,
+		http.StatusServiceUnavailable,
+	},
+	{
+		"Ready_WithoutRabbitMq_ShouldBeDown",
+		schema.NewXmlValidator("../schema/clustercode_v1.xsd"),
+		HandleReady,
+		http.StatusServiceUnavailable,
+	},
+}
+
+func TestHealth(t *testing.T) {
+	Messaging = nil
+	for _, tt := range healthTests {
+		t.Run(tt.name, func(t *testing.T) {
+			entities.Validator = tt.validator
+			recorder := httptest.NewRecorder()
+
+			tt.handler(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			assert.Equal(t, tt.expectedStatus, recorder.Code)
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"fmt"
+	"github.com/ccremer/clustercode-api-gateway/jobs"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const keepAliveInterval = 15 * time.Second
+
+// HandleStreamLogs streams the std streams of completed slices as Server-Sent Events.
+// Clients can filter by file descriptor with one or more "fd" query parameters and resume with "Last-Event-ID".
+func HandleStreamLogs(writer http.ResponseWriter, request *http.Request) {
+	jobID := mux.Vars(request)["jobId"]
+	fds, err := parseFileDescriptors(request.URL.Query()["fd"])
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, "fd is not a valid file descriptor", err.Error())
+		return
+	}
+	lastID, err := parseLastEventID(request)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, "Last-Event-ID is not valid", err.Error())
+		return
+	}
+	flusher, ok := writer.(http.Flusher)
+	if !ok {
+		writeError(writer, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+
+	backlog, lines, cancel, err := Tracker.SubscribeLogs(jobID, lastID)
+	if err == jobs.ErrJobNotFound {
+		writeError(writer, http.StatusNotFound, "job not found", jobID)
+		return
+	}
+	defer cancel()
+
+	writer.Header().Set("Content-Type", "text/event-stream")
+	writer.Header().Set("Cache-Control", "no-cache")
+	writer.Header().Set("Connection", "keep-alive")
+	writer.WriteHeader(http.StatusOK)
+
+	logEntry := log.WithField("job_id", jobID)
+	logEntry.Debug("log stream opened")
+	for _, line := range backlog {
+		if err := writeLogEvent(writer, line, fds); err != nil {
+			logEntry.WithField("error", err).Debug("log stream closed")
+			return
+		}
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+	for {
+		var err error
+		select {
+		case <-request.Context().Done():
+			logEntry.Debug("log stream closed by client")
+			return
+		case <-shutdown:
+			logEntry.Debug("log stream closed by server")
+			return
+		case <-keepAlive.C:
+			_, err = fmt.Fprint(writer, ": keep-alive\n\n")
+		case line, open := <-lines:
+			if !open {
+				logEntry.Warn("log stream client fell behind, closing stream")
+				return
+			}
+			err = writeLogEvent(writer, line, fds)
+		}
+		if err != nil {
+			logEntry.WithField("error", err).Debug("log stream closed")
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+func writeLogEvent(writer http.ResponseWriter, line jobs.LogLine, fds map[int]bool) error {
+	if len(fds) > 0 && !fds[line.FD] {
+		return nil
+	}
+	data, err := toJsonString(line)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(writer, "id: %d\nevent: log\ndata: %s\n\n", line.ID, data)
+	return err
+}
+
+func parseFileDescriptors(values []string) (map[int]bool, error) {
+	fds := make(map[int]bool)
+	for _, value := range values {
+		fd, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, err
+		}
+		fds[fd] = true
+	}
+	return fds, nil
+}
+
+func parseLastEventID(request *http.Request) (uint64, error) {
+	value := request.Header.Get("Last-Event-ID")
+	if value == "" {
+		value = request.URL.Query().Get("lastEventId")
+	}
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.ParseUint(value, 10, 64)
+}
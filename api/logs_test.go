@@ -0,0 +1,53 @@
+package api
+
+import (
+	"context"
+	"github.com/ccremer/clustercode-api-gateway/entities"
+	"github.com/ccremer/clustercode-api-gateway/jobs"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const jobID = "620b8251-52a1-4ecd-8adc-4fb280214bba"
+
+func TestHandleStreamLogs_ShouldFilterAndResume(t *testing.T) {
+	Tracker = jobs.NewTracker()
+	Tracker.Apply(&entities.SliceCompletedEvent{
+		JobID:   jobID,
+		SliceNr: 2,
+		StdStreams: []entities.StdStream{
+			{FD: entities.StdErrFileDescriptor, Line: "skipped by Last-Event-ID"},
+			{FD: entities.StdOutFileDescriptor, Line: "skipped by fd"},
+			{FD: entities.StdErrFileDescriptor, Line: "from stderr"},
+		},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	request := httptest.NewRequest(http.MethodGet, "/api/v1/tasks/"+jobID+"/logs/stream?fd=2", nil).WithContext(ctx)
+	request = mux.SetURLVars(request, map[string]string{"jobId": jobID})
+	request.Header.Set("Last-Event-ID", "1")
+	recorder := httptest.NewRecorder()
+
+	HandleStreamLogs(recorder, request)
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "text/event-stream", recorder.Header().Get("Content-Type"))
+	assert.Equal(t, "id: 3\nevent: log\ndata: {\"id\":3,\"sliceNr\":2,\"fd\":2,\"line\":\"from stderr\"}\n\n", recorder.Body.String())
+}
+
+func TestHandleStreamLogs_ShouldReturnNotFound_IfJobUnknown(t *testing.T) {
+	Tracker = jobs.NewTracker()
+	request := httptest.NewRequest(http.MethodGet, "/api/v1/tasks/"+jobID+"/logs/stream", nil)
+	request = mux.SetURLVars(request, map[string]string{"jobId": jobID})
+	recorder := httptest.NewRecorder()
+
+	HandleStreamLogs(recorder, request)
+
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+	assert.Empty(t, Tracker.List(), "streaming should not create the job")
+}
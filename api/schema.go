@@ -0,0 +1,120 @@
+package api
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"github.com/ccremer/clustercode-api-gateway/schema"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	SchemaIndex struct {
+		XMLName xml.Name `json:"-" xml:"Schemas"`
+		// Latest is the version that validates messages without a version, 0 if it is not one of the versions.
+		Latest  int           `json:"latest" xml:"latest,attr"`
+		Schemas []SchemaEntry `json:"schemas" xml:"Schema"`
+	}
+	SchemaEntry struct {
+		Version int    `json:"version" xml:"version,attr"`
+		Url     string `json:"url" xml:"Url"`
+		Digest  string `json:"digest" xml:"Digest"`
+		Size    int    `json:"size" xml:"Size"`
+		Latest  bool   `json:"latest" xml:"latest,attr"`
+	}
+)
+
+var (
+	Schemas *schema.Files
+	// SchemaMaxAge is how long clients may cache a schema version. The latest alias is always revalidated.
+	SchemaMaxAge = 24 * time.Hour
+)
+
+// HandleSchemaIndex lists the schema versions, as XML if the client accepts it and JSON otherwise.
+func HandleSchemaIndex(writer http.ResponseWriter, request *http.Request) {
+	if Schemas == nil {
+		writeError(writer, http.StatusServiceUnavailable, "schemas are not loaded")
+		return
+	}
+	index := &SchemaIndex{Schemas: []SchemaEntry{}}
+	for _, version := range Schemas.Versions() {
+		file, _ := Schemas.Version(version)
+		entry := SchemaEntry{
+			Version: version,
+			Url:     schemaUrl(version),
+			Digest:  "sha256:" + file.Digest,
+			Size:    len(file.Content),
+			Latest:  Schemas.IsLatest(file),
+		}
+		if entry.Latest {
+			index.Latest = version
+		}
+		index.Schemas = append(index.Schemas, entry)
+	}
+
+	writer.Header().Set("Cache-Control", "no-cache")
+	if !acceptsXml(request) {
+		writeJson(writer, http.StatusOK, index)
+		return
+	}
+	writer.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	writer.WriteHeader(http.StatusOK)
+	if _, err := writer.Write([]byte(xml.Header)); err != nil {
+		log.Warn(err)
+		return
+	}
+	if err := xml.NewEncoder(writer).Encode(index); err != nil {
+		log.Warn(err)
+	}
+}
+
+// HandleGetSchema serves the XSD of the requested version.
+func HandleGetSchema(writer http.ResponseWriter, request *http.Request) {
+	if Schemas == nil {
+		writeError(writer, http.StatusServiceUnavailable, "schemas are not loaded")
+		return
+	}
+	version, _ := strconv.Atoi(mux.Vars(request)["version"])
+	file, exists := Schemas.Version(version)
+	if !exists {
+		writeError(writer, http.StatusNotFound, fmt.Sprintf("schema version %d does not exist", version),
+			fmt.Sprintf("available versions: %v", Schemas.Versions()))
+		return
+	}
+	serveSchema(writer, request, file, fmt.Sprintf("public, max-age=%d", int(SchemaMaxAge.Seconds())))
+}
+
+// HandleLatestSchema serves the XSD that validates messages which do not declare a version.
+func HandleLatestSchema(writer http.ResponseWriter, request *http.Request) {
+	if Schemas == nil {
+		writeError(writer, http.StatusServiceUnavailable, "schemas are not loaded")
+		return
+	}
+	serveSchema(writer, request, Schemas.Latest, "no-cache")
+}
+
+// serveSchema answers with a strong ETag of the content digest, so that conditional requests are answered with 304.
+func serveSchema(writer http.ResponseWriter, request *http.Request, file *schema.File, cacheControl string) {
+	log.WithFields(log.Fields{
+		"name": file.Name,
+		"uri":  request.RequestURI,
+	}).Debug("Accessing schema")
+	writer.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	writer.Header().Set("ETag", `"`+file.Digest+`"`)
+	writer.Header().Set("Cache-Control", cacheControl)
+	http.ServeContent(writer, request, file.Name, file.ModTime, bytes.NewReader(file.Content))
+}
+
+func schemaUrl(version int) string {
+	return fmt.Sprintf("/schema/v%d/clustercode.xsd", version)
+}
+
+func acceptsXml(request *http.Request) bool {
+	accept := request.Header.Get("Accept")
+	return strings.Contains(accept, "application/xml") || strings.Contains(accept, "text/xml")
+}
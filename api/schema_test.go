@@ -0,0 +1,111 @@
+package api
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"github.com/ccremer/clustercode-api-gateway/schema"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func loadTestSchemas(t *testing.T) {
+	files, err := schema.ReadFiles("../schema/testdata/xsd/event_v2.xsd", "../schema/testdata/xsd/event_v%d.xsd")
+	require.NoError(t, err)
+	Schemas = files
+}
+
+func TestHandleSchemaIndex_ShouldListVersions(t *testing.T) {
+	loadTestSchemas(t)
+	recorder := httptest.NewRecorder()
+
+	HandleSchemaIndex(recorder, httptest.NewRequest(http.MethodGet, "/schema", nil))
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "no-cache", recorder.Header().Get("Cache-Control"))
+	index := &SchemaIndex{}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), index))
+	assert.Equal(t, 2, index.Latest)
+	require.Len(t, index.Schemas, 2)
+	v1, _ := Schemas.Version(1)
+	assert.Equal(t, SchemaEntry{
+		Version: 1,
+		Url:     "/schema/v1/clustercode.xsd",
+		Digest:  "sha256:" + v1.Digest,
+		Size:    len(v1.Content),
+	}, index.Schemas[0])
+	assert.True(t, index.Schemas[1].Latest)
+}
+
+func TestHandleSchemaIndex_ShouldNegotiateXml(t *testing.T) {
+	loadTestSchemas(t)
+	request := httptest.NewRequest(http.MethodGet, "/schema", nil)
+	request.Header.Set("Accept", "application/xml")
+	recorder := httptest.NewRecorder()
+
+	HandleSchemaIndex(recorder, request)
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "application/xml; charset=utf-8", recorder.Header().Get("Content-Type"))
+	index := &SchemaIndex{}
+	require.NoError(t, xml.Unmarshal(recorder.Body.Bytes(), index))
+	assert.Equal(t, 2, index.Latest)
+	assert.Len(t, index.Schemas, 2)
+	assert.Equal(t, "/schema/v2/clustercode.xsd", index.Schemas[1].Url)
+}
+
+func TestHandleGetSchema(t *testing.T) {
+	loadTestSchemas(t)
+	v1, _ := Schemas.Version(1)
+	tests := []struct {
+		name           string
+		version        string
+		ifNoneMatch    string
+		expectedStatus int
+	}{
+		{"ShouldServeVersion", "1", "", http.StatusOK},
+		{"ShouldAnswerNotModified_IfETagMatches", "1", `"` + v1.Digest + `"`, http.StatusNotModified},
+		{"ShouldServeVersion_IfETagDiffers", "1", `"other"`, http.StatusOK},
+		{"ShouldRejectUnknownVersion", "3", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/schema/v"+tt.version+"/clustercode.xsd", nil)
+			request = mux.SetURLVars(request, map[string]string{"version": tt.version})
+			if tt.ifNoneMatch != "" {
+				request.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+			recorder := httptest.NewRecorder()
+
+			HandleGetSchema(recorder, request)
+
+			assert.Equal(t, tt.expectedStatus, recorder.Code)
+			switch tt.expectedStatus {
+			case http.StatusOK:
+				assert.Equal(t, string(v1.Content), recorder.Body.String())
+				assert.Equal(t, "public, max-age=86400", recorder.Header().Get("Cache-Control"))
+				fallthrough
+			case http.StatusNotModified:
+				assert.Equal(t, `"`+v1.Digest+`"`, recorder.Header().Get("ETag"))
+			case http.StatusNotFound:
+				assert.JSONEq(t, `{"error":"schema version 3 does not exist","details":["available versions: [1 2]"]}`,
+					recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandleLatestSchema_ShouldServeLatest(t *testing.T) {
+	loadTestSchemas(t)
+	recorder := httptest.NewRecorder()
+
+	HandleLatestSchema(recorder, httptest.NewRequest(http.MethodGet, "/schema/latest/clustercode.xsd", nil))
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, string(Schemas.Latest.Content), recorder.Body.String())
+	assert.Equal(t, `"`+Schemas.Latest.Digest+`"`, recorder.Header().Get("ETag"))
+	assert.Equal(t, "no-cache", recorder.Header().Get("Cache-Control"))
+}
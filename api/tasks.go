@@ -0,0 +1,119 @@
+package api
+
+import (
+	"context"
+	"github.com/ccremer/clustercode-api-gateway/entities"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+)
+
+type (
+	AddTaskRequest struct {
+		File      string   `json:"file"`
+		SliceSize int      `json:"sliceSize,omitempty"`
+		Args      []string `json:"args,omitempty"`
+		FileHash  string   `json:"fileHash,omitempty"`
+	}
+	AddTaskResponse struct {
+		JobID string `json:"jobId"`
+	}
+	CancelTaskResponse struct {
+		JobID string `json:"jobId"`
+		State string `json:"state"`
+	}
+)
+
+const (
+	CancellationRequested = "cancellation_requested"
+)
+
+// HandleAddTask accepts a new transcoding task and publishes it as TaskAddedEvent.
+func HandleAddTask(writer http.ResponseWriter, request *http.Request) {
+	body, err := ioutil.ReadAll(request.Body)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, "could not read request body", err.Error())
+		return
+	}
+	task := AddTaskRequest{}
+	if err := entities.FromJson(string(body), &task); err != nil {
+		writeError(writer, http.StatusBadRequest, "request body is not valid JSON", err.Error())
+		return
+	}
+	file, err := url.Parse(task.File)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, "file is not a valid URI", err.Error())
+		return
+	}
+
+	event := &entities.TaskAddedEvent{
+		JobID:     entities.NewJobID(),
+		File:      file,
+		SliceSize: task.SliceSize,
+		Args:      task.Args,
+		FileHash:  task.FileHash,
+	}
+	payload, err := entities.ToValidXml(event)
+	if err != nil {
+		writeValidationError(writer, "task would be rejected by the schema", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(request.Context(), PublishTimeout)
+	defer cancel()
+	if err := entities.PublishTaskAdded(ctx, payload); err != nil {
+		log.WithFields(log.Fields{
+			"job_id": event.JobID,
+			"error":  err,
+		}).Warn("could not publish task")
+		writeError(writer, http.StatusServiceUnavailable, "task could not be published", err.Error())
+		return
+	}
+	log.WithField("job_id", event.JobID).Info("task added")
+	writeJson(writer, http.StatusAccepted, &AddTaskResponse{JobID: event.JobID})
+}
+
+// HandleCancelTask publishes a TaskCancelledEvent for the job given in the path.
+func HandleCancelTask(writer http.ResponseWriter, request *http.Request) {
+	event := &entities.TaskCancelledEvent{
+		JobID: mux.Vars(request)["jobId"],
+	}
+	payload, err := entities.ToValidXml(event)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, "job id is not valid", err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(request.Context(), PublishTimeout)
+	defer cancel()
+	if err := entities.PublishTaskCancelled(ctx, payload); err != nil {
+		log.WithFields(log.Fields{
+			"job_id": event.JobID,
+			"error":  err,
+		}).Warn("could not publish task cancellation")
+		writeError(writer, http.StatusServiceUnavailable, "task cancellation could not be published", err.Error())
+		return
+	}
+	log.WithField("job_id", event.JobID).Info("task cancellation requested")
+	writeJson(writer, http.StatusAccepted, &CancelTaskResponse{
+		JobID: event.JobID,
+		State: CancellationRequested,
+	})
+}
+
+// HandleListTasks returns all jobs known to the job tracker.
+func HandleListTasks(writer http.ResponseWriter, request *http.Request) {
+	writeJson(writer, http.StatusOK, Tracker.List())
+}
+
+// HandleGetTask returns the state of a single job including its slices.
+func HandleGetTask(writer http.ResponseWriter, request *http.Request) {
+	jobID := mux.Vars(request)["jobId"]
+	if job, found := Tracker.Get(jobID); found {
+		writeJson(writer, http.StatusOK, job)
+	} else {
+		writeError(writer, http.StatusNotFound, "job not found", jobID)
+	}
+}
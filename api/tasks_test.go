@@ -0,0 +1,141 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/ccremer/clustercode-api-gateway/entities"
+	"github.com/ccremer/clustercode-api-gateway/messaging"
+	"github.com/ccremer/clustercode-api-gateway/schema"
+	"github.com/gorilla/mux"
+	"github.com/micro/go-config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var addTaskTests = []struct {
+	name string
+	body string
+}{
+	{
+		"InvalidJson",
+		`{"file": `,
+	},
+	{
+		"MissingPath",
+		`{"file": "clustercode://base_dir:12"}`,
+	},
+	{
+		"InvalidFileHash",
+		`{"file": "clustercode://base_dir/movie.mp4", "fileHash": "abc"}`,
+	},
+	{
+		"NegativeSliceSize",
+		`{"file": "clustercode://base_dir/movie.mp4", "sliceSize": -1}`,
+	},
+}
+
+func TestHandleAddTask_ShouldRejectInvalidTasks(t *testing.T) {
+	entities.Validator = schema.NewXmlValidator("../schema/clustercode_v1.xsd")
+	for _, tt := range addTaskTests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, "/api/v1/tasks", strings.NewReader(tt.body))
+			recorder := httptest.NewRecorder()
+
+			HandleAddTask(recorder, request)
+
+			assert.Equal(t, http.StatusBadRequest, recorder.Code)
+			assert.Contains(t, recorder.Body.String(), `"error"`)
+		})
+	}
+}
+
+func TestHandleAddTask_ShouldPublishTask(t *testing.T) {
+	require.NoError(t, config.LoadFile("../defaults.yaml"))
+	entities.Validator = schema.NewVersionedXmlValidator("", "../schema/clustercode_v2.xsd", "../schema/clustercode_v%d.xsd")
+	v1 := schema.NewXmlValidator("../schema/clustercode_v1.xsd")
+	broker := messaging.NewMemoryBroker()
+	entities.Connect(broker)
+	defer broker.Stop(context.Background())
+	worker := &messaging.ChannelConfig{
+		Name:            "worker",
+		QueueOptions:    &messaging.QueueOptions{Exclusive: true},
+		ExchangeOptions: &messaging.ExchangeOptions{ExchangeName: "task-added", ExchangeType: "fanout"},
+	}
+	published := make(chan string, 10)
+	require.NoError(t, broker.Subscribe(worker, func(d *messaging.Delivery) {
+		published <- string(d.Body)
+		broker.Ack(d)
+	}))
+
+	tests := []struct {
+		name              string
+		body              string
+		expectedVersion   string
+		expectedV1IsValid bool
+	}{
+		{"WithoutSliceSize", `{"file": "clustercode://base_dir/movie.mp4", "args": ["-c:v", "copy"]}`, "", true},
+		{"WithSliceSize", `{"file": "clustercode://base_dir/movie.mp4", "sliceSize": 120}`, `version="2"`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, "/api/v1/tasks", strings.NewReader(tt.body))
+			recorder := httptest.NewRecorder()
+
+			HandleAddTask(recorder, request)
+
+			response := AddTaskResponse{}
+			assert.Equal(t, http.StatusAccepted, recorder.Code)
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+			var payload string
+			select {
+			case payload = <-published:
+			case <-time.After(time.Second):
+				require.FailNow(t, "task has not been published")
+			}
+			assert.Contains(t, payload, "<JobId>"+response.JobID+"</JobId>")
+			if tt.expectedVersion != "" {
+				assert.Contains(t, payload, tt.expectedVersion)
+			}
+			valid, _ := v1.ValidateXml(&payload)
+			assert.Equal(t, tt.expectedV1IsValid, valid, "only tasks with slice size require schema version 2")
+		})
+	}
+}
+
+func TestHandleCancelTask_ShouldRejectMalformedJobId(t *testing.T) {
+	entities.Validator = schema.NewXmlValidator("../schema/clustercode_v1.xsd")
+	for _, jobId := range []string{"invalid-content", "aaaaaaaa-bbbb-4ccc-addd-eeeeeeeeeeeX"} {
+		t.Run(jobId, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodDelete, "/api/v1/tasks/"+jobId, nil)
+			request = mux.SetURLVars(request, map[string]string{"jobId": jobId})
+			recorder := httptest.NewRecorder()
+
+			HandleCancelTask(recorder, request)
+
+			assert.Equal(t, http.StatusBadRequest, recorder.Code)
+		})
+	}
+}
+
+func TestHandleAddTask_ShouldListViolations(t *testing.T) {
+	entities.Validator = schema.NewXmlValidator("../schema/clustercode_v1.xsd")
+	body := `{"file": "clustercode://base_dir/movie.mp4", "fileHash": "abc"}`
+	request := httptest.NewRequest(http.MethodPost, "/api/v1/tasks", strings.NewReader(body))
+	recorder := httptest.NewRecorder()
+
+	HandleAddTask(recorder, request)
+
+	response := ErrorResponse{}
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	if assert.Len(t, response.Violations, 1) {
+		assert.Equal(t, "/TaskAddedEvent/FileHash", response.Violations[0].Path)
+		assert.Equal(t, "length", response.Violations[0].Facet)
+		assert.Equal(t, "abc", response.Violations[0].Value)
+	}
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"github.com/ccremer/clustercode-api-gateway/entities"
+	"github.com/ccremer/clustercode-api-gateway/schema"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+)
+
+type (
+	ValidateResponse struct {
+		Valid bool `json:"valid"`
+		// MessageType is the root element of the message, e.g. TaskAddedEvent.
+		MessageType string `json:"messageType,omitempty"`
+		// Version is the schema version the message was validated against.
+		Version    int                `json:"version,omitempty"`
+		Violations []schema.Violation `json:"violations,omitempty"`
+	}
+)
+
+// HandleValidate validates the XML message in the request body the way consumed messages are validated. The
+// ?version=N parameter stands in for the x-clustercode-schema-version header, a version attribute of the message
+// takes precedence. Answers with 200 if the message is valid, with 422 otherwise and with 413 if the message is larger
+// than MaxMessageSize.
+func HandleValidate(writer http.ResponseWriter, request *http.Request) {
+	if !entities.Validator.IsLoaded() {
+		writeError(writer, http.StatusServiceUnavailable, "schema is not loaded")
+		return
+	}
+	version := 0
+	if value := request.URL.Query().Get("version"); value != "" {
+		var err error
+		if version, err = strconv.Atoi(value); err != nil || version <= 0 {
+			writeError(writer, http.StatusBadRequest, "version is not a positive number", value)
+			return
+		}
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(writer, request.Body, MaxMessageSize))
+	if err != nil && int64(len(body)) == MaxMessageSize {
+		// The reader stops at the limit, so the body is too large rather than incomplete.
+		writeError(writer, http.StatusRequestEntityTooLarge, "message is larger than "+strconv.FormatInt(MaxMessageSize, 10)+" bytes")
+		return
+	}
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, "could not read request body", err.Error())
+		return
+	}
+
+	xml := string(body)
+	report := entities.Validator.Validate(&xml, version)
+	response := &ValidateResponse{
+		Valid:       report.Valid(),
+		MessageType: report.Root,
+		Version:     report.Version,
+		Violations:  report.Violations,
+	}
+	if !response.Valid {
+		writeJson(writer, http.StatusUnprocessableEntity, response)
+		return
+	}
+	writeJson(writer, http.StatusOK, response)
+}
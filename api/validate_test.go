@@ -0,0 +1,98 @@
+package api
+
+import (
+	"github.com/ccremer/clustercode-api-gateway/entities"
+	"github.com/ccremer/clustercode-api-gateway/schema"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandleValidate(t *testing.T) {
+	entities.Validator = schema.NewVersionedXmlValidator("",
+		"../schema/testdata/xsd/event_v2.xsd", "../schema/testdata/xsd/event_v%d.xsd")
+	tests := []struct {
+		name             string
+		query            string
+		body             string
+		expectedStatus   int
+		expectedResponse string
+	}{
+		{
+			"ShouldAcceptValidMessage",
+			"",
+			`<Event><Name>a</Name><Priority>1</Priority></Event>`,
+			http.StatusOK,
+			`{"valid":true,"messageType":"Event","version":2}`,
+		},
+		{
+			"ShouldValidateAgainstRequestedVersion",
+			"?version=1",
+			`<Event><Name>a</Name><Priority>1</Priority></Event>`,
+			http.StatusUnprocessableEntity,
+			`{"valid":false,"messageType":"Event","version":1,"violations":[{"path":"/Event/Priority","line":1,"column":22,
+				"message":"Element 'Priority': This element is not expected."}]}`,
+		},
+		{
+			"ShouldRejectUnsupportedVersion",
+			"?version=3",
+			`<Event><Name>a</Name></Event>`,
+			http.StatusUnprocessableEntity,
+			`{"valid":false,"messageType":"Event","violations":[{"message":"schema version 3 is not supported"}]}`,
+		},
+		{
+			"ShouldRejectMalformedMessage",
+			"",
+			`<Event>`,
+			http.StatusUnprocessableEntity,
+			`{"valid":false,"violations":[{"line":1,"column":8,
+				"message":"provided XML string is not well-formed: unexpected EOF"}]}`,
+		},
+		{
+			"ShouldRejectInvalidVersionParameter",
+			"?version=latest",
+			`<Event><Name>a</Name></Event>`,
+			http.StatusBadRequest,
+			`{"error":"version is not a positive number","details":["latest"]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, "/api/v1/validate"+tt.query, strings.NewReader(tt.body))
+			recorder := httptest.NewRecorder()
+
+			HandleValidate(recorder, request)
+
+			assert.Equal(t, tt.expectedStatus, recorder.Code)
+			assert.JSONEq(t, tt.expectedResponse, recorder.Body.String())
+		})
+	}
+}
+
+func TestHandleValidate_ShouldLimitMessageSize(t *testing.T) {
+	entities.Validator = schema.NewVersionedXmlValidator("",
+		"../schema/testdata/xsd/event_v2.xsd", "../schema/testdata/xsd/event_v%d.xsd")
+	message := `<Event><Name>a</Name><Priority>1</Priority></Event>`
+	defer func(size int64) { MaxMessageSize = size }(MaxMessageSize)
+	MaxMessageSize = int64(len(message))
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+	}{
+		{"AtLimit", message, http.StatusOK},
+		{"AboveLimit", message + "\n", http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, "/api/v1/validate", strings.NewReader(tt.body))
+			recorder := httptest.NewRecorder()
+
+			HandleValidate(recorder, request)
+
+			assert.Equal(t, tt.expectedStatus, recorder.Code)
+		})
+	}
+}
@@ -0,0 +1,499 @@
+// Command xsdgen generates Go types with their xml tags and golden file round-trip tests from every version of
+// the schema, so that types and schema can't drift apart unnoticed:
+//
+//	go run ../cmd/xsdgen -schema ../schema/clustercode_v%d.xsd -out v%d
+//
+// Every version gets its own package, named after the last element of its directory. The generated tests
+// serialize a message with only the required and one with all the values, compare the XML with the golden files
+// in testdata, which "go test -update" writes, validate it against the schema and deserialize it again. They fail
+// as well if the schema changed since the types were generated.
+//
+// Elements with child elements or attributes become structs. Elements that only wrap a repeated element, like
+// <Args><Arg/></Args>, become slices with a path tag like "Args>Arg". Optional values are omitted if empty, so an
+// optional element can't hold the zero value of its Go type.
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"github.com/ccremer/clustercode-api-gateway/schema"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+func main() {
+	pattern := flag.String("schema", "", "file pattern of the schema versions, e.g. ../schema/clustercode_v%d.xsd")
+	out := flag.String("out", "v%d", "output directory of each version")
+	flag.Parse()
+	if *pattern == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	files, err := schema.ReadFiles("", *pattern)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(files.Versions()) == 0 {
+		log.Fatalf("no schema matches %s", *pattern)
+	}
+	for _, version := range files.Versions() {
+		file, _ := files.Version(version)
+		dir := fmt.Sprintf(*out, version)
+		schemaPath, err := filepath.Rel(dir, fmt.Sprintf(*pattern, version))
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := generate(file, dir, filepath.ToSlash(schemaPath)); err != nil {
+			log.Fatalf("%s: %s", file.Name, err)
+		}
+	}
+}
+
+func generate(file *schema.File, dir string, schemaPath string) error {
+	messages, err := schema.Describe(file.Content)
+	if err != nil {
+		return err
+	}
+	digest := sha256.Sum256(file.Content)
+	g := &generator{
+		file:        file,
+		digest:      hex.EncodeToString(digest[:]),
+		schemaPath:  schemaPath,
+		packageName: filepath.Base(dir),
+		byName:      make(map[string]*structType),
+	}
+	for _, message := range messages {
+		if err := g.addMessage(message); err != nil {
+			return err
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Join(dir, "testdata"), 0755); err != nil {
+		return err
+	}
+	if err := write(filepath.Join(dir, "entities.go"), g.types()); err != nil {
+		return err
+	}
+	return write(filepath.Join(dir, "entities_test.go"), g.tests())
+}
+
+func write(path string, source []byte) error {
+	formatted, err := format.Source(source)
+	if err != nil {
+		return fmt.Errorf("%s: %s", path, err)
+	}
+	return ioutil.WriteFile(path, formatted, 0644)
+}
+
+type (
+	generator struct {
+		file        *schema.File
+		digest      string
+		schemaPath  string
+		packageName string
+		messages    []*structType
+		// structs contains all types in the order they are declared.
+		structs []*structType
+		byName  map[string]*structType
+	}
+	structType struct {
+		name    string
+		doc     string
+		message string
+		fields  []*field
+	}
+	field struct {
+		name   string
+		goType string
+		tag    string
+		kind   fieldKind
+		// decl is the attribute, the element with the character data or the (repeated) child element.
+		decl schema.Declaration
+		// wrapper is the element around the repeated child element of wrapperField.
+		wrapper *schema.Declaration
+		// item is the type of struct elements, nil for simple ones.
+		item *structType
+	}
+	fieldKind int
+)
+
+const (
+	attributeField fieldKind = iota
+	textField
+	elementField
+	wrapperField
+)
+
+// goTypes maps the built-in XSD types that are not mapped to string.
+var goTypes = map[string]string{
+	"boolean":            "bool",
+	"integer":            "int",
+	"nonNegativeInteger": "int",
+	"positiveInteger":    "int",
+	"nonPositiveInteger": "int",
+	"negativeInteger":    "int",
+	"long":               "int64",
+	"int":                "int32",
+	"short":              "int16",
+	"byte":               "int8",
+	"unsignedLong":       "uint64",
+	"unsignedInt":        "uint32",
+	"unsignedShort":      "uint16",
+	"unsignedByte":       "uint8",
+}
+
+func goTypeOf(xsdType string) string {
+	if goType, mapped := goTypes[xsdType]; mapped {
+		return goType
+	}
+	return "string"
+}
+
+func (g *generator) addMessage(message schema.Declaration) error {
+	t := &structType{
+		name:    exported(message.Name),
+		doc:     fmt.Sprintf("is the %s message of schema version %d.", message.Name, g.file.Version),
+		message: message.Name,
+	}
+	if _, exists := g.byName[t.name]; exists {
+		return fmt.Errorf("message %s: type %s is generated more than once", message.Name, t.name)
+	}
+	// The message is declared before the types of its elements.
+	g.byName[t.name] = t
+	g.messages = append(g.messages, t)
+	g.structs = append(g.structs, t)
+	if err := g.addFields(t, message); err != nil {
+		return fmt.Errorf("message %s: %s", message.Name, err)
+	}
+	return nil
+}
+
+// structOf returns the struct for the complex element, which is shared with other elements of the same type.
+// Anonymous types are named after their element, prefixed with the name of the parent if that is ambiguous.
+func (g *generator) structOf(d schema.Declaration, parent string) (*structType, error) {
+	t := &structType{name: exported(d.Name), doc: fmt.Sprintf("maps the %s element.", d.Name)}
+	if d.TypeName != "" {
+		t.name = exported(d.TypeName)
+		t.doc = fmt.Sprintf("maps the %s type.", d.TypeName)
+	}
+	if err := g.addFields(t, d); err != nil {
+		return nil, err
+	}
+	for _, name := range []string{t.name, parent + t.name} {
+		existing, exists := g.byName[name]
+		switch {
+		case !exists:
+			t.name = name
+			g.byName[name] = t
+			g.structs = append(g.structs, t)
+			return t, nil
+		case existing.message == "" && existing.signature() == t.signature():
+			return existing, nil
+		}
+	}
+	return nil, fmt.Errorf("type %s is generated more than once", t.name)
+}
+
+func (g *generator) addFields(t *structType, d schema.Declaration) error {
+	for _, attr := range d.Attributes {
+		t.fields = append(t.fields, &field{
+			name:   exported(attr.Name),
+			goType: goTypeOf(attr.Type),
+			tag:    attr.Name + ",attr" + omitEmpty(attr.Optional),
+			kind:   attributeField,
+			decl:   attr,
+		})
+	}
+	if d.Type != "" {
+		t.fields = append(t.fields, &field{name: "Value", goType: goTypeOf(d.Type), tag: ",chardata", kind: textField, decl: d})
+	}
+	for i := range d.Children {
+		child := d.Children[i]
+		f := &field{name: exported(child.Name), kind: elementField, decl: child}
+		switch {
+		case isWrapper(child):
+			item := child.Children[0]
+			f.kind, f.decl, f.wrapper = wrapperField, item, &child
+			itemType, err := g.itemOf(f, t.name)
+			if err != nil {
+				return err
+			}
+			f.goType, f.tag = "[]"+itemType, child.Name+">"+item.Name+",omitempty"
+		case child.Repeated:
+			itemType, err := g.itemOf(f, t.name)
+			if err != nil {
+				return err
+			}
+			f.goType, f.tag = "[]"+itemType, child.Name
+		default:
+			itemType, err := g.itemOf(f, t.name)
+			if err != nil {
+				return err
+			}
+			f.goType, f.tag = itemType, child.Name+omitEmpty(child.Optional)
+			if f.item != nil && child.Optional {
+				f.goType = "*" + itemType
+			}
+		}
+		t.fields = append(t.fields, f)
+	}
+	names := map[string]bool{"XMLName": t.message != ""}
+	for _, f := range t.fields {
+		if names[f.name] {
+			return fmt.Errorf("field %s of %s is generated more than once", f.name, t.name)
+		}
+		names[f.name] = true
+	}
+	return nil
+}
+
+// itemOf returns the Go type of the field's declaration, which is a struct unless it only has simple content.
+func (g *generator) itemOf(f *field, parent string) (string, error) {
+	d := f.decl
+	if d.Type != "" && len(d.Attributes) == 0 {
+		return goTypeOf(d.Type), nil
+	}
+	item, err := g.structOf(d, parent)
+	if err != nil {
+		return "", err
+	}
+	f.item = item
+	return item.name, nil
+}
+
+// isWrapper returns true if the element contains nothing but a repeated element.
+func isWrapper(d schema.Declaration) bool {
+	return len(d.Attributes) == 0 && d.Type == "" && len(d.Children) == 1 && d.Children[0].Repeated && !d.Repeated
+}
+
+func omitEmpty(optional bool) string {
+	if optional {
+		return ",omitempty"
+	}
+	return ""
+}
+
+func (t *structType) signature() string {
+	signature := &bytes.Buffer{}
+	for _, f := range t.fields {
+		fmt.Fprintf(signature, "%s %s %s;", f.name, f.goType, f.tag)
+	}
+	return signature.String()
+}
+
+func (g *generator) header(source *bytes.Buffer) {
+	fmt.Fprintf(source, "// Code generated by xsdgen from %s; DO NOT EDIT.\n\n", g.file.Name)
+}
+
+func (g *generator) types() []byte {
+	source := &bytes.Buffer{}
+	g.header(source)
+	fmt.Fprintf(source, "// Package %s contains the messages of schema version %d.\n", g.packageName, g.file.Version)
+	fmt.Fprintf(source, "package %s\n\n", g.packageName)
+	fmt.Fprintf(source, "import \"encoding/xml\"\n\n")
+	fmt.Fprintf(source, "const (\n")
+	fmt.Fprintf(source, "// SchemaVersion is the version of the schema the types are generated from.\n")
+	fmt.Fprintf(source, "SchemaVersion = %d\n", g.file.Version)
+	fmt.Fprintf(source, "// SchemaDigest is the hex encoded SHA-256 digest of the schema the types are generated from.\n")
+	fmt.Fprintf(source, "SchemaDigest = %q\n", g.digest)
+	fmt.Fprintf(source, ")\n\n")
+
+	fmt.Fprintf(source, "type (\n")
+	for _, t := range g.structs {
+		fmt.Fprintf(source, "// %s %s\n", t.name, t.doc)
+		fmt.Fprintf(source, "%s struct {\n", t.name)
+		if t.message != "" {
+			fmt.Fprintf(source, "XMLName xml.Name `xml:%q`\n", t.message)
+		}
+		for _, f := range t.fields {
+			fmt.Fprintf(source, "%s %s `xml:%q`\n", f.name, f.goType, f.tag)
+		}
+		fmt.Fprintf(source, "}\n")
+	}
+	fmt.Fprintf(source, ")\n\n")
+
+	fmt.Fprintf(source, "// Messages creates an empty message by the name of its root element.\n")
+	fmt.Fprintf(source, "var Messages = map[string]func() interface{}{\n")
+	for _, t := range g.messages {
+		fmt.Fprintf(source, "%q: func() interface{} { return &%s{} },\n", t.message, t.name)
+	}
+	fmt.Fprintf(source, "}\n")
+	return source.Bytes()
+}
+
+func (g *generator) tests() []byte {
+	source := &bytes.Buffer{}
+	g.header(source)
+	fmt.Fprintf(source, "package %s\n\n", g.packageName)
+	fmt.Fprint(source, `import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"flag"
+	"github.com/ccremer/clustercode-api-gateway/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+`)
+	fmt.Fprintf(source, "const schemaPath = %q\n\n", g.schemaPath)
+	fmt.Fprintf(source, "var update = flag.Bool(\"update\", false, \"update golden files\")\n\n")
+	fmt.Fprintf(source, "var roundTripTests = []struct {\nname string\nexpected interface{}\ntestFile string\n}{\n")
+	for _, t := range g.messages {
+		required := g.literal(t, false)
+		complete := g.literal(t, true)
+		fmt.Fprintf(source, "{\n%q,\n&%s,\n%q,\n},\n", t.message+"_Required", required, snake(t.message)+"_required.xml")
+		if complete != required {
+			fmt.Fprintf(source, "{\n%q,\n&%s,\n%q,\n},\n", t.message+"_Complete", complete, snake(t.message)+"_complete.xml")
+		}
+	}
+	fmt.Fprintf(source, "}\n\n")
+	fmt.Fprint(source, `func TestRoundTrip(t *testing.T) {
+	validator := schema.NewXmlValidator(schemaPath)
+	for _, tt := range roundTripTests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join("testdata", tt.testFile)
+
+			// serialize
+			xmlBytes, err := xml.Marshal(tt.expected)
+			require.NoError(t, err)
+			xmlString := string(xmlBytes)
+			if *update {
+				t.Log("update golden file")
+				require.NoError(t, ioutil.WriteFile(path, []byte(xmlString+"\n"), 0644))
+			}
+
+			// verify from existing file
+			golden, err := ioutil.ReadFile(path)
+			require.NoError(t, err, "run go generate ./entities to write the golden files")
+			assert.Equal(t, string(golden), xmlString+"\n")
+
+			// validate
+			valid, err := validator.ValidateXml(&xmlString)
+			assert.NoError(t, err)
+			assert.True(t, valid)
+
+			// deserialize into a new value, so that repeated runs (-count) don't accumulate repeated elements
+			result := reflect.New(reflect.TypeOf(tt.expected).Elem()).Interface()
+			require.NoError(t, xml.Unmarshal(golden, result))
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestSchemaDigest_ShouldMatchSchema(t *testing.T) {
+	content, err := ioutil.ReadFile(schemaPath)
+	require.NoError(t, err)
+	digest := sha256.Sum256(content)
+	assert.Equal(t, SchemaDigest, hex.EncodeToString(digest[:]), "the schema changed, run go generate ./entities")
+}
+`)
+	return source.Bytes()
+}
+
+// literal returns a composite literal of the struct with sample values, leaving out optional values unless
+// complete is set. Repeated elements occur twice if complete is set and as often as required otherwise.
+func (g *generator) literal(t *structType, complete bool) string {
+	literal := &bytes.Buffer{}
+	fmt.Fprintf(literal, "%s{\n", t.name)
+	if t.message != "" {
+		fmt.Fprintf(literal, "XMLName: xml.Name{Local: %q},\n", t.message)
+	}
+	for _, f := range t.fields {
+		switch f.kind {
+		case attributeField, textField:
+			if complete || !f.decl.Optional || f.kind == textField {
+				fmt.Fprintf(literal, "%s: %s,\n", f.name, simpleLiteral(f.goType, f.decl.Sample))
+			}
+		case wrapperField, elementField:
+			count := occurrences(f, complete)
+			if count == 0 {
+				continue
+			}
+			item := g.itemLiteral(f, complete)
+			switch {
+			case strings.HasPrefix(f.goType, "[]"):
+				fmt.Fprintf(literal, "%s: %s{%s},\n", f.name, f.goType, strings.TrimSuffix(strings.Repeat(item+", ", count), ", "))
+			case strings.HasPrefix(f.goType, "*"):
+				fmt.Fprintf(literal, "%s: &%s,\n", f.name, item)
+			default:
+				fmt.Fprintf(literal, "%s: %s,\n", f.name, item)
+			}
+		}
+	}
+	fmt.Fprintf(literal, "}")
+	return literal.String()
+}
+
+func (g *generator) itemLiteral(f *field, complete bool) string {
+	if f.item != nil {
+		return g.literal(f.item, complete)
+	}
+	return simpleLiteral(f.goType[strings.LastIndex(f.goType, "]")+1:], f.decl.Sample)
+}
+
+// occurrences returns how often the field's element occurs in the sample.
+func occurrences(f *field, complete bool) int {
+	repeated := f.kind == wrapperField || f.decl.Repeated
+	switch {
+	case complete && repeated:
+		return 2
+	case complete:
+		return 1
+	case f.kind == wrapperField && f.wrapper.Optional:
+		return 0
+	case f.kind == wrapperField:
+		// The wrapper is only written if it contains an element.
+		return 1
+	case f.decl.Optional:
+		return 0
+	}
+	return 1
+}
+
+func simpleLiteral(goType string, sample string) string {
+	switch goType {
+	case "string":
+		return strconv.Quote(sample)
+	case "bool":
+		return strconv.FormatBool(sample == "true" || sample == "1")
+	}
+	return sample
+}
+
+// exported turns an XML name like std_streams into an exported Go name like StdStreams.
+func exported(name string) string {
+	parts := strings.FieldsFunc(name, func(r rune) bool {
+		return r == '_' || r == '-' || r == '.'
+	})
+	for i, part := range parts {
+		parts[i] = strings.ToUpper(part[:1]) + part[1:]
+	}
+	return strings.Join(parts, "")
+}
+
+// snake turns a name like TaskAddedEvent into task_added_event.
+func snake(name string) string {
+	result := &bytes.Buffer{}
+	for i, r := range name {
+		if unicode.IsUpper(r) && i > 0 {
+			result.WriteRune('_')
+		}
+		result.WriteRune(unicode.ToLower(r))
+	}
+	return result.String()
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/ccremer/clustercode-api-gateway/schema"
+	"io"
+	"io/ioutil"
+)
+
+// compareSchemas implements "compare-schemas [-json] [-require backward|forward|full|none] OLD.xsd NEW.xsd". It
+// prints the incompatible changes per message element and returns the exit code, which is 1 if the schemas are
+// not compatible in the required direction and 2 if they could not be compared.
+func compareSchemas(args []string, out io.Writer) int {
+	flags := flag.NewFlagSet("compare-schemas", flag.ContinueOnError)
+	flags.SetOutput(out)
+	asJson := flags.Bool("json", false, "print the changes as JSON")
+	require := flags.String("require", "backward", "compatibility to require: backward, forward, full or none")
+	flags.Usage = func() {
+		fmt.Fprintln(out, "Usage: clustercode-api-gateway compare-schemas [flags] OLD.xsd NEW.xsd")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return 2
+	}
+	switch *require {
+	case "backward", "forward", "full", "none":
+	default:
+		fmt.Fprintf(out, "-require '%s' is not one of backward, forward, full or none\n", *require)
+		return 2
+	}
+
+	before, err := ioutil.ReadFile(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return 2
+	}
+	after, err := ioutil.ReadFile(flags.Arg(1))
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return 2
+	}
+	compatibility, err := schema.CompareSchemas(before, after)
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return 2
+	}
+
+	if *asJson {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(compatibility); err != nil {
+			fmt.Fprintln(out, err)
+			return 2
+		}
+	} else {
+		printChanges(out, compatibility)
+	}
+	backward, forward := compatibility.IsBackwardCompatible(), compatibility.IsForwardCompatible()
+	if *require == "backward" && !backward || *require == "forward" && !forward || *require == "full" && !(backward && forward) {
+		return 1
+	}
+	return 0
+}
+
+func printChanges(out io.Writer, compatibility *schema.Compatibility) {
+	element := ""
+	for i, change := range compatibility.Changes {
+		if i == 0 || change.Element != element {
+			element = change.Element
+			fmt.Fprintln(out, element)
+		}
+		fmt.Fprintf(out, "  %s\n", change)
+	}
+	fmt.Fprintf(out, "backward compatible: %t\n", compatibility.IsBackwardCompatible())
+	fmt.Fprintf(out, "forward compatible: %t\n", compatibility.IsForwardCompatible())
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+const (
+	eventV1 = "schema/testdata/xsd/event_v1.xsd"
+	eventV2 = "schema/testdata/xsd/event_v2.xsd"
+)
+
+func TestCompareSchemas(t *testing.T) {
+	tests := []struct {
+		name           string
+		args           []string
+		expectedCode   int
+		expectedOutput string
+	}{
+		{"Compatible", []string{eventV1, eventV2}, 0, "backward compatible: true"},
+		{"CompatibleIfNotRequired", []string{"-require", "none", eventV2, eventV1}, 0, "backward compatible: false"},
+		{"Incompatible", []string{eventV2, eventV1}, 1, "backward compatible: false"},
+		{"IncompatibleForward", []string{"-require", "forward", eventV1, eventV2}, 1, "forward compatible: false"},
+		{"IncompatibleFull", []string{"-require", "full", eventV1, eventV2}, 1, "forward compatible: false"},
+		{"Json", []string{"-json", eventV1, eventV2}, 0, `"changes"`},
+		{"MissingArgument", []string{eventV1}, 2, "Usage:"},
+		{"UnknownFlag", []string{"-strict", eventV1, eventV2}, 2, "flag provided but not defined"},
+		{"UnknownRequirement", []string{"-require", "sideways", eventV1, eventV2}, 2, "-require 'sideways'"},
+		{"MissingFile", []string{eventV1, "schema/testdata/xsd/event_v9.xsd"}, 2, "event_v9.xsd"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+
+			code := compareSchemas(tt.args, out)
+
+			assert.Equal(t, tt.expectedCode, code)
+			assert.Contains(t, out.String(), tt.expectedOutput)
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package entities
+
+import (
+	"bytes"
+	xml2 "encoding/xml"
+	"fmt"
+	"github.com/ccremer/clustercode-api-gateway/messaging"
+	log "github.com/sirupsen/logrus"
+	"sync"
+)
+
+type (
+	// Dispatcher routes deliveries to the handlers registered for their event type, which is the root element of
+	// the payload. Deliveries whose AMQP type property names a different event are rejected.
+	// The error returned by the handlers decides how the delivery is completed, see CompletionOf.
+	Dispatcher struct {
+		m      *sync.RWMutex
+		routes map[string]*eventRoute
+	}
+	eventRoute struct {
+		deserialize deserializer
+		handlers    []func(event Message) error
+	}
+	retryableError struct {
+		err error
+	}
+)
+
+// DefaultDispatcher consumes the events observed by the gateway and notifies the event listeners of them. Register
+// handlers before calling Connect.
+var DefaultDispatcher = newDefaultDispatcher()
+
+func newDefaultDispatcher() *Dispatcher {
+	d := NewDispatcher()
+	d.OnEvent(func(event Message) error {
+		notifyListeners(event)
+		return nil
+	})
+	return d
+}
+
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{
+		m: &sync.RWMutex{},
+		routes: map[string]*eventRoute{
+			"TaskAddedEvent": {deserialize: func(d *messaging.Delivery) (Message, error) {
+				return DeserializeTaskAddedEvent(d)
+			}},
+			"TaskCompletedEvent": {deserialize: func(d *messaging.Delivery) (Message, error) {
+				return DeserializeTaskCompletedEvent(d)
+			}},
+			"TaskCancelledEvent": {deserialize: func(d *messaging.Delivery) (Message, error) {
+				return DeserializeTaskCancelledEvent(d)
+			}},
+			"SliceAddedEvent": {deserialize: func(d *messaging.Delivery) (Message, error) {
+				return DeserializeSliceAddedEvent(d)
+			}},
+			"SliceCompletedEvent": {deserialize: func(d *messaging.Delivery) (Message, error) {
+				return DeserializeSliceCompletedEvent(d)
+			}},
+		},
+	}
+}
+
+// Retryable marks the error as transient: the delivery is requeued instead of dead-lettered.
+func Retryable(err error) error {
+	return retryableError{err: err}
+}
+
+func (e retryableError) Error() string {
+	return e.err.Error()
+}
+
+// CompletionOf translates a handler result: nil completes the delivery, errors marked with Retryable requeue it
+// and any other error rejects it for good, which dead-letters it.
+func CompletionOf(err error) CompletionType {
+	switch err.(type) {
+	case nil:
+		return Complete
+	case retryableError:
+		return IncompleteAndRequeue
+	}
+	return Incomplete
+}
+
+func (d *Dispatcher) OnTaskAdded(handler func(event *TaskAddedEvent) error) {
+	d.addHandler("TaskAddedEvent", func(event Message) error {
+		return handler(event.(*TaskAddedEvent))
+	})
+}
+
+func (d *Dispatcher) OnTaskCompleted(handler func(event *TaskCompletedEvent) error) {
+	d.addHandler("TaskCompletedEvent", func(event Message) error {
+		return handler(event.(*TaskCompletedEvent))
+	})
+}
+
+func (d *Dispatcher) OnTaskCancelled(handler func(event *TaskCancelledEvent) error) {
+	d.addHandler("TaskCancelledEvent", func(event Message) error {
+		return handler(event.(*TaskCancelledEvent))
+	})
+}
+
+func (d *Dispatcher) OnSliceAdded(handler func(event *SliceAddedEvent) error) {
+	d.addHandler("SliceAddedEvent", func(event Message) error {
+		return handler(event.(*SliceAddedEvent))
+	})
+}
+
+func (d *Dispatcher) OnSliceCompleted(handler func(event *SliceCompletedEvent) error) {
+	d.addHandler("SliceCompletedEvent", func(event Message) error {
+		return handler(event.(*SliceCompletedEvent))
+	})
+}
+
+// OnEvent registers the handler for every event type.
+func (d *Dispatcher) OnEvent(handler func(event Message) error) {
+	d.m.RLock()
+	eventTypes := make([]string, 0, len(d.routes))
+	for eventType := range d.routes {
+		eventTypes = append(eventTypes, eventType)
+	}
+	d.m.RUnlock()
+	for _, eventType := range eventTypes {
+		d.addHandler(eventType, handler)
+	}
+}
+
+func (d *Dispatcher) addHandler(eventType string, handler func(event Message) error) {
+	d.m.Lock()
+	defer d.m.Unlock()
+	route := d.routes[eventType]
+	route.handlers = append(route.handlers, handler)
+}
+
+// Consume dispatches the delivery and completes it according to the outcome. It is a messaging.Consumer.
+// Handlers run in the order they were registered until one fails. A requeued delivery runs all of them again,
+// so handlers should be idempotent.
+func (d *Dispatcher) Consume(delivery *messaging.Delivery) {
+	err := d.dispatch(delivery)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"routing_key": delivery.RoutingKey,
+			"error":       err,
+		}).Warn("could not handle message")
+	}
+	settle(CompletionOf(err), delivery, err)
+}
+
+func (d *Dispatcher) dispatch(delivery *messaging.Delivery) error {
+	eventType, err := eventTypeOf(delivery)
+	if err != nil {
+		return fmt.Errorf("could not determine event type: %s", err)
+	}
+	d.m.RLock()
+	route, known := d.routes[eventType]
+	var handlers []func(event Message) error
+	if known {
+		handlers = make([]func(event Message) error, len(route.handlers))
+		copy(handlers, route.handlers)
+	}
+	d.m.RUnlock()
+	if !known {
+		return fmt.Errorf("event type '%s' is not supported", eventType)
+	}
+
+	event, err := route.deserialize(delivery)
+	if err != nil {
+		return err
+	}
+	for _, handler := range handlers {
+		if err := handler(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// eventTypeOf returns the root element of the payload. If the AMQP type property is set, it has to match.
+func eventTypeOf(delivery *messaging.Delivery) (string, error) {
+	decoder := xml2.NewDecoder(bytes.NewReader(delivery.Body))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return "", err
+		}
+		if start, ok := token.(xml2.StartElement); ok {
+			if delivery.Type != "" && delivery.Type != start.Name.Local {
+				return "", fmt.Errorf("type property '%s' does not match root element '%s'", delivery.Type, start.Name.Local)
+			}
+			return start.Name.Local, nil
+		}
+	}
+}
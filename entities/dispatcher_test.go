@@ -0,0 +1,140 @@
+package entities
+
+import (
+	"errors"
+	"github.com/ccremer/clustercode-api-gateway/messaging"
+	"github.com/ccremer/clustercode-api-gateway/schema"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// recordingBroker records how deliveries are settled.
+type recordingBroker struct {
+	messaging.Broker
+	acked        bool
+	deadLettered bool
+	requeued     bool
+}
+
+func (b *recordingBroker) Ack(d *messaging.Delivery) error {
+	b.acked = true
+	return nil
+}
+
+func (b *recordingBroker) DeadLetter(d *messaging.Delivery, reason error) error {
+	b.deadLettered = true
+	return nil
+}
+
+func (b *recordingBroker) Requeue(d *messaging.Delivery, reason error) error {
+	b.requeued = true
+	return nil
+}
+
+const taskCancelledXml = `<TaskCancelledEvent><JobId>620b8251-52a1-4ecd-8adc-4fb280214bba</JobId></TaskCancelledEvent>`
+
+var dispatchTests = []struct {
+	name             string
+	body             string
+	eventType        string
+	handlerErr       error
+	expectedHandled  bool
+	expectedAcked    bool
+	expectedRequeued bool
+}{
+	{
+		name:            "HandlerSucceeds",
+		body:            taskCancelledXml,
+		expectedHandled: true,
+		expectedAcked:   true,
+	},
+	{
+		name:            "HandlerFails",
+		body:            taskCancelledXml,
+		handlerErr:      errors.New("failed"),
+		expectedHandled: true,
+	},
+	{
+		name:             "HandlerFailsTemporarily",
+		body:             taskCancelledXml,
+		handlerErr:       Retryable(errors.New("try again")),
+		expectedHandled:  true,
+		expectedRequeued: true,
+	},
+	{
+		name: "InvalidPayload",
+		body: `<TaskCancelledEvent><JobId>invalid</JobId></TaskCancelledEvent>`,
+	},
+	{
+		name: "UnknownRootElement",
+		body: `<Unknown/>`,
+	},
+	{
+		name: "NotXml",
+		body: `not xml`,
+	},
+	{
+		name:            "MatchingTypeProperty",
+		body:            taskCancelledXml,
+		eventType:       "TaskCancelledEvent",
+		expectedHandled: true,
+		expectedAcked:   true,
+	},
+	{
+		name:      "MismatchingTypeProperty",
+		body:      taskCancelledXml,
+		eventType: "SliceAddedEvent",
+	},
+}
+
+func TestDispatcher_Consume(t *testing.T) {
+	Validator = schema.NewXmlValidator("../schema/clustercode_v1.xsd")
+	for _, tt := range dispatchTests {
+		t.Run(tt.name, func(t *testing.T) {
+			handled := false
+			dispatcher := NewDispatcher()
+			dispatcher.OnTaskCancelled(func(event *TaskCancelledEvent) error {
+				handled = true
+				assert.Equal(t, "620b8251-52a1-4ecd-8adc-4fb280214bba", event.JobID)
+				return tt.handlerErr
+			})
+			broker := &recordingBroker{}
+			service = broker
+
+			dispatcher.Consume(&messaging.Delivery{
+				Type: tt.eventType,
+				Body: []byte(tt.body),
+			})
+
+			assert.Equal(t, tt.expectedHandled, handled)
+			assert.Equal(t, tt.expectedAcked, broker.acked)
+			assert.Equal(t, !tt.expectedAcked && !tt.expectedRequeued, broker.deadLettered)
+			assert.Equal(t, tt.expectedRequeued, broker.requeued)
+		})
+	}
+}
+
+func TestDispatcher_ShouldStopAtFirstFailingHandler(t *testing.T) {
+	Validator = schema.NewXmlValidator("../schema/clustercode_v1.xsd")
+	service = &recordingBroker{}
+	dispatcher := NewDispatcher()
+	var calls []string
+	dispatcher.OnEvent(func(event Message) error {
+		calls = append(calls, "first")
+		return errors.New("failed")
+	})
+	dispatcher.OnTaskCancelled(func(event *TaskCancelledEvent) error {
+		calls = append(calls, "second")
+		return nil
+	})
+
+	dispatcher.Consume(&messaging.Delivery{Body: []byte(taskCancelledXml)})
+
+	assert.Equal(t, []string{"first"}, calls)
+}
+
+func TestCompletionOf(t *testing.T) {
+	assert.Equal(t, Complete, CompletionOf(nil))
+	assert.Equal(t, Incomplete, CompletionOf(errors.New("failed")))
+	assert.Equal(t, IncompleteAndRequeue, CompletionOf(Retryable(errors.New("failed"))))
+}
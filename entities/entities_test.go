@@ -1,21 +1,28 @@
 package entities
 
 import (
+	encoding "encoding/xml"
 	"flag"
+	"github.com/ccremer/clustercode-api-gateway/entities/v2"
+	"github.com/ccremer/clustercode-api-gateway/messaging"
 	"github.com/ccremer/clustercode-api-gateway/schema"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"io/ioutil"
 	"net/url"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 )
 
 var update = flag.Bool("update", false, "update golden files")
 
+var taskFileUrl, _ = url.Parse("clustercode://base_dir:12/movie.mp4")
+
 var serializationTests = []struct {
 	name     string
 	expected interface{}
-	result   interface{}
 	testFile string
 }{
 	{
@@ -25,7 +32,6 @@ var serializationTests = []struct {
 			JobID:   "620b8251-52a1-4ecd-8adc-4fb280214bba",
 			SliceNr: 34,
 		},
-		&SliceAddedEvent{},
 		"slice_added_event_1.xml",
 	},
 	{
@@ -34,9 +40,18 @@ var serializationTests = []struct {
 			JobID:   "620b8251-52a1-4ecd-8adc-4fb280214bba",
 			SliceNr: 34,
 		},
-		&SliceAddedEvent{},
 		"slice_added_event_2.xml",
 	},
+	{
+		"TaskAddedEvent_WithArgs",
+		&TaskAddedEvent{
+			JobID:     "620b8251-52a1-4ecd-8adc-4fb280214bba",
+			File:      taskFileUrl,
+			SliceSize: 120,
+			Args:      []string{"arg1", "arg with space"},
+		},
+		"task_added_event_1.xml",
+	},
 	{
 		"SliceCompletedEvent_WithStreams_OneLine",
 		&SliceCompletedEvent{
@@ -45,7 +60,6 @@ var serializationTests = []struct {
 				{FD: StdOutFileDescriptor, Line: "This is from stdout"},
 			},
 		},
-		&SliceCompletedEvent{},
 		"slice_completed_event_1.xml",
 	},
 	{
@@ -57,7 +71,6 @@ var serializationTests = []struct {
 				{FD: StdOutFileDescriptor, Line: "This is from stdout"},
 			},
 		},
-		&SliceCompletedEvent{},
 		"slice_completed_event_2.xml",
 	},
 	{
@@ -65,9 +78,18 @@ var serializationTests = []struct {
 		&SliceCompletedEvent{
 			JobID: "620b8251-52a1-4ecd-8adc-4fb280214bba",
 		},
-		&SliceCompletedEvent{},
 		"slice_completed_event_3.xml",
 	},
+	{
+		"SliceCompletedEvent_WithEscapedStreams",
+		&SliceCompletedEvent{
+			JobID: "620b8251-52a1-4ecd-8adc-4fb280214bba",
+			StdStreams: []StdStream{
+				{FD: StdErrFileDescriptor, Line: "Input #0, matroska,webm, from 'a <b> & c.mkv':"},
+			},
+		},
+		"slice_completed_event_4.xml",
+	},
 }
 
 func TestSerializeXml(t *testing.T) {
@@ -90,7 +112,7 @@ func TestSerializeXml(t *testing.T) {
 }
 
 func TestDeserializeXml(t *testing.T) {
-	Validator = schema.NewXmlValidator("../schema/clustercode_v1.xsd")
+	Validator = schema.NewVersionedXmlValidator("", "../schema/clustercode_v2.xsd", "../schema/clustercode_v%d.xsd")
 	for _, tt := range serializationTests {
 		t.Run(tt.name, func(t *testing.T) {
 
@@ -101,19 +123,147 @@ func TestDeserializeXml(t *testing.T) {
 			xml := string(rawXmlBytes)
 
 			// deserialize
-			xmlErr := FromXml(xml, tt.result)
+			result := reflect.New(reflect.TypeOf(tt.expected).Elem()).Interface()
+			xmlErr := FromXml(xml, result)
 			assert.NoError(t, xmlErr)
 
 			// verify
-			assert.Equal(t, tt.expected, tt.result)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestGeneratedTypes_ShouldKeepAllFields(t *testing.T) {
+	for _, tt := range serializationTests {
+		t.Run(tt.name, func(t *testing.T) {
+			rawXmlBytes, ioErr := ioutil.ReadFile(filepath.Join("testdata", tt.testFile))
+			assert.NoError(t, ioErr)
+
+			// a field that the generated type drops is not declared in the schema
+			generated := v2.Messages[reflect.TypeOf(tt.expected).Elem().Name()]()
+			assert.NoError(t, encoding.Unmarshal(rawXmlBytes, generated))
+			generatedXml, err := encoding.Marshal(generated)
+			assert.NoError(t, err)
+
+			result := reflect.New(reflect.TypeOf(tt.expected).Elem()).Interface()
+			assert.NoError(t, encoding.Unmarshal(generatedXml, result))
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+// entityTypes are the types that the gateway serializes, by the root element of the generated type they mirror.
+var entityTypes = map[string]reflect.Type{
+	"SliceAddedEvent":     reflect.TypeOf(SliceAddedEvent{}),
+	"SliceCompletedEvent": reflect.TypeOf(SliceCompletedEvent{}),
+	"TaskAddedEvent":      reflect.TypeOf(taskAddedEventXml{}),
+	"TaskCancelledEvent":  reflect.TypeOf(TaskCancelledEvent{}),
+	"TaskCompletedEvent":  reflect.TypeOf(TaskCompletedEvent{}),
+}
+
+func TestGeneratedTypes_ShouldBeOfLatestSchemaVersion(t *testing.T) {
+	files, err := schema.ReadFiles("", "../schema/clustercode_v%d.xsd")
+	require.NoError(t, err)
+	versions := files.Versions()
+	require.NotEmpty(t, versions)
+
+	latest, _ := files.Version(versions[len(versions)-1])
+	assert.Equal(t, latest.Version, v2.SchemaVersion, "entities must be compared with the latest generated package")
+	assert.Equal(t, latest.Digest, v2.SchemaDigest, "generated types are outdated, run go generate")
+}
+
+func TestGeneratedTypes_ShouldMatchEntities(t *testing.T) {
+	assert.Len(t, entityTypes, len(v2.Messages))
+	for name, newMessage := range v2.Messages {
+		t.Run(name, func(t *testing.T) {
+			entityType, exists := entityTypes[name]
+			require.True(t, exists, "no entity for %s", name)
+			assertSameXmlFields(t, name, reflect.TypeOf(newMessage()).Elem(), entityType)
 		})
 	}
 }
 
+// assertSameXmlFields asserts that both struct types serialize the same elements and attributes with the same
+// options. The root element name and version are left out, since ToXml sets them.
+func assertSameXmlFields(t *testing.T, path string, generated, entity reflect.Type) {
+	generatedFields, entityFields := xmlFields(generated), xmlFields(entity)
+	for name, field := range generatedFields {
+		entityField, exists := entityFields[name]
+		if !assert.True(t, exists, "%s: %s is missing in %s", path, name, entity) {
+			continue
+		}
+		assert.Equal(t, field.omitEmpty, entityField.omitEmpty, "%s: omitempty of %s", path, name)
+		assertSameXmlType(t, path+"/"+name, field.typ, entityField.typ)
+	}
+	for name := range entityFields {
+		_, exists := generatedFields[name]
+		assert.True(t, exists, "%s: %s of %s is not declared in the schema", path, name, entity)
+	}
+}
+
+func assertSameXmlType(t *testing.T, path string, generated, entity reflect.Type) {
+	if !assert.Equal(t, generated.Kind(), entity.Kind(), "%s: kind", path) {
+		return
+	}
+	switch generated.Kind() {
+	case reflect.Slice, reflect.Ptr:
+		assertSameXmlType(t, path, generated.Elem(), entity.Elem())
+	case reflect.Struct:
+		assertSameXmlFields(t, path, generated, entity)
+	}
+}
+
+type xmlField struct {
+	typ       reflect.Type
+	omitEmpty bool
+}
+
+// xmlFields returns the exported fields of a struct type by their xml name and mode, e.g. "JobId", "fd,attr" or
+// ",chardata".
+func xmlFields(typ reflect.Type) map[string]xmlField {
+	fields := make(map[string]xmlField)
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.PkgPath != "" || field.Name == "XMLName" {
+			continue
+		}
+		options := strings.Split(field.Tag.Get("xml"), ",")
+		name, mode, omitEmpty := options[0], "", false
+		for _, option := range options[1:] {
+			if option == "omitempty" {
+				omitEmpty = true
+			} else {
+				mode = option
+			}
+		}
+		if name == "" && (mode == "" || mode == "attr") {
+			name = field.Name
+		}
+		if mode != "" {
+			name += "," + mode
+		}
+		if name == "version,attr" {
+			continue
+		}
+		fields[name] = xmlField{typ: field.Type, omitEmpty: omitEmpty}
+	}
+	return fields
+}
+
+func TestNewJobID_ShouldMatchSchema(t *testing.T) {
+	Validator = schema.NewXmlValidator("../schema/clustercode_v1.xsd")
+	xml, err := ToXml(&TaskCancelledEvent{JobID: NewJobID()})
+	assert.NoError(t, err)
+
+	valid, err := Validator.ValidateXml(&xml)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+}
+
 func TestTaskAddedEvent_Priority_ShouldReturnPort(t *testing.T) {
 	cc_url, err := url.Parse("clustercode://base_dir:12/path")
 	assert.NoError(t, err)
-	subject := TaskAddedEvent{File: cc_url,}
+	subject := TaskAddedEvent{File: cc_url}
 
 	result := subject.Priority()
 	assert.Equal(t, 12, result)
@@ -122,7 +272,7 @@ func TestTaskAddedEvent_Priority_ShouldReturnPort(t *testing.T) {
 func TestTaskAddedEvent_Priority_ShouldReturnZero(t *testing.T) {
 	cc_url, err := url.Parse("clustercode://base_dir/path")
 	assert.NoError(t, err)
-	subject := TaskAddedEvent{File: cc_url,}
+	subject := TaskAddedEvent{File: cc_url}
 
 	result := subject.Priority()
 	assert.Equal(t, 0, result)
@@ -136,3 +286,14 @@ func updateGoldenFileIfNecessary(t *testing.T, content string, path string) {
 		}
 	}
 }
+
+func TestDeserialize_ShouldUseSchemaVersionHeader(t *testing.T) {
+	Validator = schema.NewVersionedXmlValidator("", "../schema/clustercode_v1.xsd", "../schema/clustercode_v%d.xsd")
+	body := []byte(`<TaskCancelledEvent><JobId>620b8251-52a1-4ecd-8adc-4fb280214bba</JobId></TaskCancelledEvent>`)
+
+	_, err := DeserializeTaskCancelledEvent(&messaging.Delivery{Body: body, Headers: map[string]interface{}{HeaderSchemaVersion: int32(1)}})
+	assert.NoError(t, err)
+
+	_, err = DeserializeTaskCancelledEvent(&messaging.Delivery{Body: body, Headers: map[string]interface{}{HeaderSchemaVersion: "3"}})
+	assert.EqualError(t, err, "schema version 3 is not supported")
+}
@@ -0,0 +1,77 @@
+package entities
+
+import (
+	"context"
+	"github.com/ccremer/clustercode-api-gateway/messaging"
+	"github.com/ccremer/clustercode-api-gateway/schema"
+	"github.com/micro/go-config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+// The gateway runs against the in-memory broker with the default topology, the test acts as worker.
+func TestGateway_EndToEnd(t *testing.T) {
+	require.NoError(t, config.LoadFile("../defaults.yaml"))
+	Validator = schema.NewXmlValidator("../schema/clustercode_v1.xsd")
+	broker := messaging.NewMemoryBroker()
+	events := make(chan Message, 10)
+	AddEventListener(func(event Message) {
+		select {
+		case events <- event:
+		default:
+			// the listener of a previous run (-count) stays registered
+		}
+	})
+	Connect(broker)
+	defer broker.Stop(context.Background())
+
+	t.Run("PublishTaskAdded_ShouldReachWorkersAndObserver", func(t *testing.T) {
+		event := &TaskAddedEvent{JobID: NewJobID(), File: taskFileUrl}
+		payload, err := ToValidXml(event)
+		require.NoError(t, err)
+
+		require.NoError(t, PublishTaskAdded(context.Background(), payload))
+
+		observed, ok := receiveEvent(t, events).(*TaskAddedEvent)
+		require.True(t, ok, "expected a TaskAddedEvent")
+		assert.Equal(t, event.JobID, observed.JobID)
+		assert.Equal(t, 1, broker.QueueLength("task-added"), "task should wait for a worker in the durable queue")
+	})
+
+	t.Run("SliceCompletedFromWorker_ShouldBeObserved", func(t *testing.T) {
+		payload, err := ioutil.ReadFile("testdata/slice_completed_event_1.xml")
+		require.NoError(t, err)
+
+		require.NoError(t, broker.Publish(topology.Channel("slice.completed"), string(payload)))
+
+		observed, ok := receiveEvent(t, events).(*SliceCompletedEvent)
+		require.True(t, ok, "expected a SliceCompletedEvent")
+		assert.NotEmpty(t, observed.StdStreams)
+	})
+
+	t.Run("InvalidMessage_ShouldBeDeadLettered", func(t *testing.T) {
+		require.NoError(t, broker.Publish(topology.Channel("task.cancelled"), "<TaskCancelledEvent><JobId>invalid</JobId></TaskCancelledEvent>"))
+
+		var messages []messaging.DeadLetterMessage
+		for deadline := time.Now().Add(time.Second); len(messages) == 0 && time.Now().Before(deadline); {
+			time.Sleep(10 * time.Millisecond)
+			messages, _ = broker.PeekDeadLetters(10)
+		}
+		require.Len(t, messages, 1)
+		assert.Equal(t, "task-cancelled", messages[0].Exchange)
+		assert.NotEmpty(t, messages[0].Error)
+	})
+}
+
+func receiveEvent(t *testing.T, events <-chan Message) Message {
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(time.Second):
+		require.FailNow(t, "no event received")
+		return nil
+	}
+}
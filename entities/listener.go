@@ -0,0 +1,78 @@
+package entities
+
+import (
+	"github.com/ccremer/clustercode-api-gateway/messaging"
+	log "github.com/sirupsen/logrus"
+	"reflect"
+	"sync"
+)
+
+type (
+	// EventListener gets notified for each event consumed by the gateway. The event is one of the *Event pointer types.
+	EventListener func(event Message)
+	deserializer  func(d *messaging.Delivery) (Message, error)
+)
+
+var (
+	listeners      []EventListener
+	listenersMutex = &sync.RWMutex{}
+)
+
+// AddEventListener registers a listener that is invoked for every consumed event.
+func AddEventListener(listener EventListener) {
+	listenersMutex.Lock()
+	defer listenersMutex.Unlock()
+	listeners = append(listeners, listener)
+}
+
+// EventType returns the name of the event, which is also the root element of its XML representation.
+func EventType(event Message) string {
+	return reflect.Indirect(reflect.ValueOf(event)).Type().Name()
+}
+
+// JobIDOf returns the JobId of the given event or an empty string for unknown types.
+func JobIDOf(event Message) string {
+	switch e := event.(type) {
+	case *TaskAddedEvent:
+		return e.JobID
+	case *TaskCompletedEvent:
+		return e.JobID
+	case *TaskCancelledEvent:
+		return e.JobID
+	case *SliceAddedEvent:
+		return e.JobID
+	case *SliceCompletedEvent:
+		return e.JobID
+	}
+	return ""
+}
+
+func notifyListeners(event Message) {
+	listenersMutex.RLock()
+	defer listenersMutex.RUnlock()
+	for _, listener := range listeners {
+		listener(event)
+	}
+}
+
+// newObserverConfig binds an exclusive queue to the exchange of the source channel, so the gateway sees
+// every event without taking work away from the durable queue of the source channel.
+func newObserverConfig(source *messaging.ChannelConfig) *messaging.ChannelConfig {
+	if source.ExchangeOptions == nil {
+		log.WithFields(log.Fields{
+			"channel": source.Name,
+			"help":    "The gateway can only observe events that are published to an exchange",
+		}).Fatal("channel has no exchange")
+	}
+	eConfig := *source.ExchangeOptions
+	eConfig.QueueName = ""
+	return &messaging.ChannelConfig{
+		Name:            source.Name + ".observer",
+		ExchangeOptions: &eConfig,
+		QueueOptions: &messaging.QueueOptions{
+			Exclusive:  true,
+			AutoDelete: true,
+		},
+		Consumer: DefaultDispatcher.Consume,
+	}
+}
@@ -1,27 +1,60 @@
 module github.com/ccremer/clustercode-api-gateway
 
+go 1.27.1
+
+require (
+	github.com/efritz/backoff v1.0.0
+	github.com/efritz/watchdog v0.0.0-20181228234521-84cf7cb74656
+	github.com/gorilla/mux v1.6.2
+	github.com/gorilla/websocket v1.4.0
+	github.com/jbussdieker/golibxml v0.0.0-20140917070152-a643db2327cb
+	github.com/krolaw/xsd v0.0.0-20181003005531-6e00d9d069d0
+	github.com/micro/go-config v0.13.1
+	github.com/prometheus/client_golang v0.9.1
+	github.com/sirupsen/logrus v1.2.0
+	github.com/streadway/amqp v0.0.0-20181205114330-a314942b2fd9
+	github.com/stretchr/testify v1.2.2
+)
+
 require (
 	github.com/BurntSushi/toml v0.3.1 // indirect
+	github.com/aphistic/sweet v0.0.0-20180618201346-68e18ab55a67 // indirect
+	github.com/aphistic/sweet-junit v0.0.0-20171005212431-6b78f7014f7c // indirect
 	github.com/beorn7/perks v0.0.0-20180321164747-3a771d992973 // indirect
 	github.com/bitly/go-simplejson v0.5.0 // indirect
 	github.com/bmizerany/assert v0.0.0-20160611221934-b7ed37b82869 // indirect
-	github.com/efritz/backoff v1.0.0
-	github.com/efritz/watchdog v0.0.0-20181228234521-84cf7cb74656
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/efritz/glock v0.0.0-20180604185841-7e95e8b27a61 // indirect
+	github.com/fsnotify/fsnotify v1.4.7 // indirect
 	github.com/ghodss/yaml v1.0.0 // indirect
 	github.com/gogo/protobuf v1.1.1 // indirect
+	github.com/golang/protobuf v1.2.0 // indirect
 	github.com/gorilla/context v1.1.1 // indirect
-	github.com/gorilla/mux v1.6.2
 	github.com/hashicorp/hcl v1.0.0 // indirect
+	github.com/hpcloud/tail v1.0.0 // indirect
 	github.com/imdario/mergo v0.3.6 // indirect
-	github.com/jbussdieker/golibxml v0.0.0-20140917070152-a643db2327cb
-	github.com/krolaw/xsd v0.0.0-20181003005531-6e00d9d069d0
+	github.com/konsorten/go-windows-terminal-sequences v1.0.1 // indirect
+	github.com/kr/pretty v0.1.0 // indirect
+	github.com/kr/pty v1.1.1 // indirect
+	github.com/kr/text v0.1.0 // indirect
+	github.com/mattn/go-colorable v0.0.9 // indirect
+	github.com/mattn/go-isatty v0.0.4 // indirect
 	github.com/matttproud/golang_protobuf_extensions v1.0.1 // indirect
-	github.com/micro/go-config v0.13.1
-	github.com/prometheus/client_golang v0.9.1
+	github.com/mgutz/ansi v0.0.0-20170206155736-9520e82c474b // indirect
+	github.com/onsi/ginkgo v1.7.0 // indirect
+	github.com/onsi/gomega v1.4.3 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/prometheus/client_model v0.0.0-20180712105110-5c3871d89910 // indirect
 	github.com/prometheus/common v0.0.0-20181116084131-1f2c4f3cd6db // indirect
 	github.com/prometheus/procfs v0.0.0-20181005140218-185b4288413d // indirect
-	github.com/sirupsen/logrus v1.2.0
-	github.com/streadway/amqp v0.0.0-20181205114330-a314942b2fd9
-	github.com/stretchr/testify v1.2.2
+	github.com/stretchr/objx v0.1.1 // indirect
+	golang.org/x/crypto v0.0.0-20181203042331-505ab145d0a9 // indirect
+	golang.org/x/net v0.0.0-20181220203305-927f97764cc3 // indirect
+	golang.org/x/sync v0.0.0-20181221193216-37e7f081c4d4 // indirect
+	golang.org/x/sys v0.0.0-20181228144115-9a3f9b0469bb // indirect
+	golang.org/x/text v0.3.0 // indirect
+	gopkg.in/check.v1 v1.0.0-20180628173108-788fd7840127 // indirect
+	gopkg.in/fsnotify.v1 v1.4.7 // indirect
+	gopkg.in/tomb.v1 v1.0.0-20141024135613-dd632973f1e7 // indirect
+	gopkg.in/yaml.v2 v2.2.2 // indirect
 )
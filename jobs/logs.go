@@ -0,0 +1,79 @@
+package jobs
+
+import (
+	"errors"
+	"github.com/ccremer/clustercode-api-gateway/entities"
+)
+
+const (
+	// MaxLogLines is the number of lines per job that are kept for clients resuming a stream.
+	MaxLogLines = 1000
+	// Subscribers that fall behind by more than this many lines get dropped and have to resume.
+	logSubscriptionBuffer = 100
+)
+
+var ErrJobNotFound = errors.New("job not found")
+
+type (
+	LogLine struct {
+		ID      uint64 `json:"id"`
+		SliceNr int    `json:"sliceNr"`
+		FD      int    `json:"fd"`
+		Line    string `json:"line"`
+	}
+	logSubscription struct {
+		lines chan LogLine
+	}
+)
+
+// SubscribeLogs returns the buffered lines of the given job newer than lastID and a channel that receives new lines.
+// The channel is closed if the subscriber falls behind. Call cancel once the subscription is not needed anymore.
+// Returns ErrJobNotFound if the job is not known, subscribing does not create it.
+func (t *Tracker) SubscribeLogs(jobID string, lastID uint64) (backlog []LogLine, lines <-chan LogLine, cancel func(), err error) {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	j, exists := t.jobs[jobID]
+	if !exists {
+		return nil, nil, nil, ErrJobNotFound
+	}
+	for _, line := range j.logs {
+		if line.ID > lastID {
+			backlog = append(backlog, line)
+		}
+	}
+	s := &logSubscription{lines: make(chan LogLine, logSubscriptionBuffer)}
+	j.subscriptions[s] = true
+	return backlog, s.lines, func() {
+		t.m.Lock()
+		defer t.m.Unlock()
+		if j.subscriptions[s] {
+			delete(j.subscriptions, s)
+			close(s.lines)
+		}
+	}, nil
+}
+
+func (j *job) appendLogs(e *entities.SliceCompletedEvent) {
+	for _, stream := range e.StdStreams {
+		j.lastLogID++
+		line := LogLine{
+			ID:      j.lastLogID,
+			SliceNr: e.SliceNr,
+			FD:      stream.FD,
+			Line:    stream.Line,
+		}
+		j.logs = append(j.logs, line)
+		for s := range j.subscriptions {
+			select {
+			case s.lines <- line:
+			default:
+				delete(j.subscriptions, s)
+				close(s.lines)
+			}
+		}
+	}
+	if overflow := len(j.logs) - MaxLogLines; overflow > 0 {
+		j.logs = append(j.logs[:0:0], j.logs[overflow:]...)
+	}
+}
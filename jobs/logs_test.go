@@ -0,0 +1,95 @@
+package jobs
+
+import (
+	"github.com/ccremer/clustercode-api-gateway/entities"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func sliceCompleted(sliceNr int, lines ...string) *entities.SliceCompletedEvent {
+	event := &entities.SliceCompletedEvent{JobID: jobID, SliceNr: sliceNr}
+	for _, line := range lines {
+		event.StdStreams = append(event.StdStreams, entities.StdStream{FD: entities.StdOutFileDescriptor, Line: line})
+	}
+	return event
+}
+
+func TestTracker_SubscribeLogs_ShouldResumeAfterLastID(t *testing.T) {
+	subject := NewTracker()
+	subject.Apply(sliceCompleted(0, "line 1", "line 2", "line 3"))
+
+	backlog, _, cancel, err := subject.SubscribeLogs(jobID, 1)
+	assert.NoError(t, err)
+	defer cancel()
+
+	assert.Equal(t, []LogLine{
+		{ID: 2, SliceNr: 0, FD: entities.StdOutFileDescriptor, Line: "line 2"},
+		{ID: 3, SliceNr: 0, FD: entities.StdOutFileDescriptor, Line: "line 3"},
+	}, backlog)
+}
+
+func TestTracker_SubscribeLogs_ShouldReceiveNewLines(t *testing.T) {
+	subject := NewTracker()
+	subject.Apply(sliceCompleted(3))
+	backlog, lines, cancel, err := subject.SubscribeLogs(jobID, 0)
+	assert.NoError(t, err)
+	defer cancel()
+
+	subject.Apply(sliceCompleted(4, "line 1"))
+
+	assert.Empty(t, backlog)
+	assert.Equal(t, LogLine{ID: 1, SliceNr: 4, FD: entities.StdOutFileDescriptor, Line: "line 1"}, <-lines)
+}
+
+func TestTracker_SubscribeLogs_ShouldDropSlowSubscriber(t *testing.T) {
+	subject := NewTracker()
+	subject.Apply(sliceCompleted(0))
+	_, lines, cancel, err := subject.SubscribeLogs(jobID, 0)
+	assert.NoError(t, err)
+	defer cancel()
+
+	for i := 0; i <= logSubscriptionBuffer; i++ {
+		subject.Apply(sliceCompleted(i, "line"))
+	}
+
+	count := 0
+	for range lines {
+		count++
+	}
+	assert.Equal(t, logSubscriptionBuffer, count)
+}
+
+func TestTracker_Apply_ShouldKeepLogsOfLateSlices(t *testing.T) {
+	subject := NewTracker()
+	subject.Apply(&entities.TaskCancelledEvent{JobID: jobID})
+	subject.Apply(sliceCompleted(0, "late line"))
+
+	backlog, _, cancel, err := subject.SubscribeLogs(jobID, 0)
+	assert.NoError(t, err)
+	defer cancel()
+
+	assert.Equal(t, []LogLine{{ID: 1, SliceNr: 0, FD: entities.StdOutFileDescriptor, Line: "late line"}}, backlog)
+}
+
+func TestTracker_Apply_ShouldLimitLogLines(t *testing.T) {
+	subject := NewTracker()
+	for i := 0; i < MaxLogLines+10; i++ {
+		subject.Apply(sliceCompleted(i, "line"))
+	}
+
+	backlog, _, cancel, err := subject.SubscribeLogs(jobID, 0)
+	assert.NoError(t, err)
+	defer cancel()
+
+	assert.Len(t, backlog, MaxLogLines)
+	assert.Equal(t, uint64(11), backlog[0].ID)
+}
+
+func TestTracker_SubscribeLogs_ShouldNotCreateUnknownJob(t *testing.T) {
+	subject := NewTracker()
+
+	_, _, _, err := subject.SubscribeLogs(jobID, 0)
+
+	assert.Equal(t, ErrJobNotFound, err)
+	assert.Empty(t, subject.List())
+}
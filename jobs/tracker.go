@@ -0,0 +1,233 @@
+package jobs
+
+import (
+	"github.com/ccremer/clustercode-api-gateway/entities"
+	log "github.com/sirupsen/logrus"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	Queued    State = "queued"
+	Slicing   State = "slicing"
+	Encoding  State = "encoding"
+	Completed State = "completed"
+	Cancelled State = "cancelled"
+	Failed    State = "failed"
+
+	SlicePending   SliceState = "pending"
+	SliceCompleted SliceState = "completed"
+
+	// DefaultRetention is how long the tracker keeps jobs that stopped changing, see Tracker.Retention.
+	DefaultRetention = 24 * time.Hour
+	// Expired jobs are looked for at most this often.
+	evictionInterval = time.Minute
+)
+
+type (
+	State      string
+	SliceState string
+	Job        struct {
+		JobID     string    `json:"jobId"`
+		State     State     `json:"state"`
+		File      string    `json:"file,omitempty"`
+		Slices    []Slice   `json:"slices"`
+		CreatedAt time.Time `json:"createdAt"`
+		UpdatedAt time.Time `json:"updatedAt"`
+	}
+	Slice struct {
+		SliceNr int        `json:"sliceNr"`
+		State   SliceState `json:"state"`
+	}
+	// Tracker maintains the state of each job based on the events consumed by the gateway.
+	Tracker struct {
+		// Retention is how long a terminal job is kept after its last update. A completed task whose slices don't
+		// all arrive within this duration is failed.
+		Retention time.Duration
+		jobs      map[string]*job
+		m         *sync.Mutex
+		now       func() time.Time
+		lastSweep time.Time
+	}
+	job struct {
+		Job
+		// taskCompleted is true once the task completed, its slices may still be reported afterwards.
+		taskCompleted bool
+		slices        map[int]SliceState
+		logs          []LogLine
+		lastLogID     uint64
+		subscriptions map[*logSubscription]bool
+	}
+)
+
+func NewTracker() *Tracker {
+	return &Tracker{
+		Retention: DefaultRetention,
+		jobs:      make(map[string]*job),
+		m:         &sync.Mutex{},
+		now:       time.Now,
+	}
+}
+
+func (s State) IsTerminal() bool {
+	return s == Completed || s == Cancelled || s == Failed
+}
+
+// Apply advances the state machine of the affected job. It is meant to be registered as entities.EventListener.
+// Slices that complete after their job was cancelled or failed are still recorded, along with their logs.
+func (t *Tracker) Apply(event entities.Message) {
+	t.m.Lock()
+	defer t.m.Unlock()
+	t.evictExpired()
+
+	switch e := event.(type) {
+	case *entities.TaskAddedEvent:
+		j := t.getOrCreate(e.JobID)
+		if e.File != nil {
+			j.File = e.File.String()
+		}
+	case *entities.SliceAddedEvent:
+		j := t.getOrCreate(e.JobID)
+		if j.State.IsTerminal() {
+			return
+		}
+		if _, exists := j.slices[e.SliceNr]; !exists {
+			j.slices[e.SliceNr] = SlicePending
+		}
+		if j.State == Queued {
+			t.transition(j, Slicing)
+		}
+	case *entities.SliceCompletedEvent:
+		j := t.getOrCreate(e.JobID)
+		j.slices[e.SliceNr] = SliceCompleted
+		j.appendLogs(e)
+		switch {
+		case j.State.IsTerminal():
+		case j.taskCompleted && !j.hasPendingSlices():
+			t.transition(j, Completed)
+		case j.State != Encoding:
+			t.transition(j, Encoding)
+		}
+	case *entities.TaskCompletedEvent:
+		j := t.getOrCreate(e.JobID)
+		if j.State.IsTerminal() {
+			return
+		}
+		// Slices are reported through their own queue, so the last of them may still be on the way.
+		j.taskCompleted = true
+		if !j.hasPendingSlices() {
+			t.transition(j, Completed)
+		}
+	case *entities.TaskCancelledEvent:
+		j := t.getOrCreate(e.JobID)
+		if j.State.IsTerminal() {
+			return
+		}
+		t.transition(j, Cancelled)
+	default:
+		log.WithField("event", event).Warn("event type is not supported by the job tracker")
+	}
+}
+
+// Get returns a snapshot of the job with the given ID, if it is known.
+func (t *Tracker) Get(jobID string) (Job, bool) {
+	t.m.Lock()
+	defer t.m.Unlock()
+	t.evictExpired()
+	if j, exists := t.jobs[jobID]; exists {
+		return j.snapshot(), true
+	}
+	return Job{}, false
+}
+
+// List returns a snapshot of all known jobs, oldest first.
+func (t *Tracker) List() []Job {
+	t.m.Lock()
+	defer t.m.Unlock()
+	t.evictExpired()
+	list := make([]Job, 0, len(t.jobs))
+	for _, j := range t.jobs {
+		list = append(list, j.snapshot())
+	}
+	sort.Slice(list, func(i, k int) bool {
+		return list[i].CreatedAt.Before(list[k].CreatedAt)
+	})
+	return list
+}
+
+func (t *Tracker) getOrCreate(jobID string) *job {
+	if j, exists := t.jobs[jobID]; exists {
+		j.UpdatedAt = t.now()
+		return j
+	}
+	now := t.now()
+	j := &job{
+		Job: Job{
+			JobID:     jobID,
+			State:     Queued,
+			CreatedAt: now,
+			UpdatedAt: now,
+		},
+		slices:        make(map[int]SliceState),
+		subscriptions: make(map[*logSubscription]bool),
+	}
+	t.jobs[jobID] = j
+	return j
+}
+
+// evictExpired fails completed tasks that still wait for slices and removes terminal jobs, once they have not been
+// updated for the retention. Subscribers of evicted jobs are closed.
+func (t *Tracker) evictExpired() {
+	now := t.now()
+	if now.Sub(t.lastSweep) < evictionInterval {
+		return
+	}
+	t.lastSweep = now
+	for jobID, j := range t.jobs {
+		if now.Sub(j.UpdatedAt) < t.Retention {
+			continue
+		}
+		switch {
+		case j.State.IsTerminal():
+			for s := range j.subscriptions {
+				delete(j.subscriptions, s)
+				close(s.lines)
+			}
+			delete(t.jobs, jobID)
+		case j.taskCompleted:
+			t.transition(j, Failed)
+			j.UpdatedAt = now
+		}
+	}
+}
+
+func (t *Tracker) transition(j *job, state State) {
+	log.WithFields(log.Fields{
+		"job_id": j.JobID,
+		"from":   j.State,
+		"to":     state,
+	}).Debug("job state changed")
+	j.State = state
+}
+
+func (j *job) hasPendingSlices() bool {
+	for _, state := range j.slices {
+		if state == SlicePending {
+			return true
+		}
+	}
+	return false
+}
+
+func (j *job) snapshot() Job {
+	snapshot := j.Job
+	snapshot.Slices = make([]Slice, 0, len(j.slices))
+	for nr, state := range j.slices {
+		snapshot.Slices = append(snapshot.Slices, Slice{SliceNr: nr, State: state})
+	}
+	sort.Slice(snapshot.Slices, func(i, k int) bool {
+		return snapshot.Slices[i].SliceNr < snapshot.Slices[k].SliceNr
+	})
+	return snapshot
+}
@@ -0,0 +1,174 @@
+package jobs
+
+import (
+	"github.com/ccremer/clustercode-api-gateway/entities"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+const jobID = "620b8251-52a1-4ecd-8adc-4fb280214bba"
+
+var stateTests = []struct {
+	name          string
+	events        []entities.Message
+	expectedState State
+	expected      []Slice
+}{
+	{
+		"TaskAdded_ShouldBeQueued",
+		[]entities.Message{
+			&entities.TaskAddedEvent{JobID: jobID},
+		},
+		Queued,
+		[]Slice{},
+	},
+	{
+		"SliceAdded_ShouldBeSlicing",
+		[]entities.Message{
+			&entities.TaskAddedEvent{JobID: jobID},
+			&entities.SliceAddedEvent{JobID: jobID, SliceNr: 1},
+			&entities.SliceAddedEvent{JobID: jobID, SliceNr: 0},
+		},
+		Slicing,
+		[]Slice{{0, SlicePending}, {1, SlicePending}},
+	},
+	{
+		"SliceCompleted_ShouldBeEncoding",
+		[]entities.Message{
+			&entities.TaskAddedEvent{JobID: jobID},
+			&entities.SliceAddedEvent{JobID: jobID, SliceNr: 0},
+			&entities.SliceAddedEvent{JobID: jobID, SliceNr: 1},
+			&entities.SliceCompletedEvent{JobID: jobID, SliceNr: 0},
+		},
+		Encoding,
+		[]Slice{{0, SliceCompleted}, {1, SlicePending}},
+	},
+	{
+		"TaskCompleted_ShouldBeCompleted",
+		[]entities.Message{
+			&entities.TaskAddedEvent{JobID: jobID},
+			&entities.SliceAddedEvent{JobID: jobID, SliceNr: 0},
+			&entities.SliceCompletedEvent{JobID: jobID, SliceNr: 0},
+			&entities.TaskCompletedEvent{JobID: jobID},
+		},
+		Completed,
+		[]Slice{{0, SliceCompleted}},
+	},
+	{
+		"TaskCompleted_WithPendingSlices_ShouldAwaitSlices",
+		[]entities.Message{
+			&entities.TaskAddedEvent{JobID: jobID},
+			&entities.SliceAddedEvent{JobID: jobID, SliceNr: 0},
+			&entities.TaskCompletedEvent{JobID: jobID},
+		},
+		Slicing,
+		[]Slice{{0, SlicePending}},
+	},
+	{
+		"TaskCompleted_BeforeLastSlice_ShouldBeCompleted",
+		[]entities.Message{
+			&entities.TaskAddedEvent{JobID: jobID},
+			&entities.SliceAddedEvent{JobID: jobID, SliceNr: 0},
+			&entities.SliceAddedEvent{JobID: jobID, SliceNr: 1},
+			&entities.SliceCompletedEvent{JobID: jobID, SliceNr: 0},
+			&entities.TaskCompletedEvent{JobID: jobID},
+			&entities.SliceCompletedEvent{JobID: jobID, SliceNr: 1},
+		},
+		Completed,
+		[]Slice{{0, SliceCompleted}, {1, SliceCompleted}},
+	},
+	{
+		"TaskCancelled_ShouldKeepLateSliceCompletions",
+		[]entities.Message{
+			&entities.TaskAddedEvent{JobID: jobID},
+			&entities.SliceAddedEvent{JobID: jobID, SliceNr: 0},
+			&entities.TaskCancelledEvent{JobID: jobID},
+			&entities.SliceCompletedEvent{JobID: jobID, SliceNr: 0},
+		},
+		Cancelled,
+		[]Slice{{0, SliceCompleted}},
+	},
+	{
+		"TaskCancelled_ShouldIgnoreLaterEvents",
+		[]entities.Message{
+			&entities.TaskAddedEvent{JobID: jobID},
+			&entities.TaskCancelledEvent{JobID: jobID},
+			&entities.SliceAddedEvent{JobID: jobID, SliceNr: 0},
+			&entities.TaskCompletedEvent{JobID: jobID},
+		},
+		Cancelled,
+		[]Slice{},
+	},
+	{
+		"UnknownJob_ShouldBeCreated",
+		[]entities.Message{
+			&entities.SliceCompletedEvent{JobID: jobID, SliceNr: 3},
+		},
+		Encoding,
+		[]Slice{{3, SliceCompleted}},
+	},
+}
+
+func TestTracker_Apply(t *testing.T) {
+	for _, tt := range stateTests {
+		t.Run(tt.name, func(t *testing.T) {
+			subject := NewTracker()
+			for _, event := range tt.events {
+				subject.Apply(event)
+			}
+
+			result, found := subject.Get(jobID)
+			assert.True(t, found)
+			assert.Equal(t, tt.expectedState, result.State)
+			assert.Equal(t, tt.expected, result.Slices)
+		})
+	}
+}
+
+func TestTracker_Get_ShouldReturnFalse_IfUnknown(t *testing.T) {
+	subject := NewTracker()
+
+	_, found := subject.Get(jobID)
+	assert.False(t, found)
+}
+
+func TestTracker_ShouldEvictTerminalJobsAfterRetention(t *testing.T) {
+	now := time.Now()
+	subject := NewTracker()
+	subject.now = func() time.Time { return now }
+	subject.Apply(&entities.TaskCancelledEvent{JobID: jobID})
+	_, lines, cancel, err := subject.SubscribeLogs(jobID, 0)
+	assert.NoError(t, err)
+	defer cancel()
+	subject.Apply(&entities.TaskAddedEvent{JobID: "running"})
+
+	now = now.Add(subject.Retention - time.Second)
+	_, found := subject.Get(jobID)
+	assert.True(t, found, "job should be kept within the retention")
+
+	now = now.Add(time.Minute)
+	_, found = subject.Get(jobID)
+	assert.False(t, found)
+	_, found = subject.Get("running")
+	assert.True(t, found, "jobs that are not terminal should be kept")
+	_, open := <-lines
+	assert.False(t, open, "subscribers of evicted jobs should be closed")
+}
+
+func TestTracker_ShouldFailTaskIfSlicesDontArriveWithinRetention(t *testing.T) {
+	now := time.Now()
+	subject := NewTracker()
+	subject.now = func() time.Time { return now }
+	subject.Apply(&entities.SliceAddedEvent{JobID: jobID, SliceNr: 0})
+	subject.Apply(&entities.TaskCompletedEvent{JobID: jobID})
+
+	now = now.Add(subject.Retention)
+	result, found := subject.Get(jobID)
+	assert.True(t, found)
+	assert.Equal(t, Failed, result.State)
+
+	now = now.Add(subject.Retention)
+	_, found = subject.Get(jobID)
+	assert.False(t, found)
+}
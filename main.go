@@ -1,8 +1,12 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"github.com/ccremer/clustercode-api-gateway/api"
 	"github.com/ccremer/clustercode-api-gateway/entities"
+	"github.com/ccremer/clustercode-api-gateway/jobs"
+	"github.com/ccremer/clustercode-api-gateway/messaging"
 	"github.com/ccremer/clustercode-api-gateway/schema"
 	"github.com/gorilla/mux"
 	"github.com/micro/go-config"
@@ -12,16 +16,31 @@ import (
 	log "github.com/sirupsen/logrus"
 	"net/http"
 	"os"
-	"strconv"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "compare-schemas" {
+		os.Exit(compareSchemas(os.Args[2:], os.Stdout))
+	}
+
 	LoadConfig()
 	ConfigureLogging()
+	// Installed before anything else starts, so that a signal during startup shuts down gracefully as well.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
 	ConfigureMessaging()
 
-	entities.Initialize()
-	//healthCheckQueue = messaging.OpenHealthCheckServer()
+	api.Tracker = jobs.NewTracker()
+	api.Tracker.Retention = config.Get("api", "jobs", "retention").Duration(api.Tracker.Retention)
+	entities.AddEventListener(api.Tracker.Apply)
+	api.Events = api.NewEventHub()
+	entities.AddEventListener(api.Events.Broadcast)
+	api.Messaging = entities.Initialize()
+
+	api.PublishTimeout = config.Get("api", "http", "publishTimeout").Duration(api.PublishTimeout)
 
 	addr := config.Get("http", "addr").String(":8080")
 	r := mux.NewRouter()
@@ -31,18 +50,103 @@ func main() {
 	}
 
 	r.HandleFunc("/", handleRoot)
-	r.HandleFunc("/schema/v{version:\\d+}/clustercode.xsd", handleSchema)
-	http.Handle("/", r)
+	r.HandleFunc("/health", api.HandleHealth).Methods(http.MethodGet)
+	r.HandleFunc("/ready", api.HandleReady).Methods(http.MethodGet)
+	r.HandleFunc("/schema", api.HandleSchemaIndex).Methods(http.MethodGet)
+	r.HandleFunc("/schema/latest/clustercode.xsd", api.HandleLatestSchema).Methods(http.MethodGet, http.MethodHead)
+	r.HandleFunc("/schema/v{version:\\d+}/clustercode.xsd", api.HandleGetSchema).Methods(http.MethodGet, http.MethodHead)
+	r.HandleFunc("/api/v1/tasks", api.HandleAddTask).Methods(http.MethodPost)
+	r.HandleFunc("/api/v1/tasks", api.HandleListTasks).Methods(http.MethodGet)
+	r.HandleFunc("/api/v1/tasks/{jobId}", api.HandleGetTask).Methods(http.MethodGet)
+	r.HandleFunc("/api/v1/tasks/{jobId}", api.HandleCancelTask).Methods(http.MethodDelete)
+	r.HandleFunc("/api/v1/tasks/{jobId}/logs/stream", api.HandleStreamLogs).Methods(http.MethodGet)
+	r.HandleFunc("/api/v1/events", api.HandleEvents)
+	r.HandleFunc("/api/v1/validate", api.HandleValidate).Methods(http.MethodPost)
+	r.HandleFunc("/admin/deadletters", api.HandleListDeadLetters).Methods(http.MethodGet)
+	r.HandleFunc("/admin/deadletters/{id}/replay", api.HandleReplayDeadLetter).Methods(http.MethodPost)
+	r.HandleFunc("/admin/deadletters/{id}", api.HandleDropDeadLetter).Methods(http.MethodDelete)
+
+	server := &http.Server{Addr: addr, Handler: r}
+	server.RegisterOnShutdown(api.CloseStreams)
+	go func() {
+		log.WithField("port", addr).Info("Starting http server")
+		if err := server.ListenAndServe(); err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	waitForShutdown(signals, server, api.Messaging)
+}
+
+// waitForShutdown blocks until SIGINT or SIGTERM is received, then stops accepting requests, drains the handlers in
+// flight and the AMQP consumers, each within the configured timeout.
+func waitForShutdown(signals <-chan os.Signal, server *http.Server, service messaging.Broker) {
+	sig := <-signals
+	timeout := config.Get("api", "http", "shutdownTimeout").Duration(30 * time.Second)
+	log.WithFields(log.Fields{
+		"signal":  sig,
+		"timeout": timeout,
+	}).Info("Shutting down")
 
-	log.WithField("port", addr).Info("Starting http server")
-	err := http.ListenAndServe(addr, nil)
-	log.Error(err)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.WithField("error", err).Warn("http server did not shut down gracefully")
+	}
+	if err := service.Stop(ctx); err != nil {
+		log.WithField("error", err).Warn("RabbitMQ did not shut down gracefully")
+	}
+	log.Info("Shutdown complete")
 }
 
 func ConfigureMessaging() {
-	entities.Validator = schema.NewXmlValidator(config.
-		Get("api", "schema", "latest").
-		String("schema/clustercode_v1.xsd"))
+	latest := config.Get("api", "schema", "latest").String("schema/clustercode_v2.xsd")
+	pattern := config.Get("api", "schema", "filepattern").String("schema/clustercode_v%d.xsd")
+	read := schema.ReadFiles
+	if config.Get("api", "schema", "embedded").Bool(false) {
+		read = schema.EmbeddedFiles
+	}
+	files, err := read(latest, pattern)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := checkLatestSchema(files, config.Get("api", "schema", "allowIncompatible").Bool(false)); err != nil {
+		log.WithField("help", "Set api.schema.allowIncompatible to load it anyway").Fatal(err)
+	}
+	api.Schemas = files
+	api.SchemaMaxAge = config.Get("api", "schema", "maxAge").Duration(api.SchemaMaxAge)
+	entities.Validator = schema.NewFilesValidator(config.Get("api", "schema", "backend").String(schema.DefaultBackend), files)
+}
+
+// checkLatestSchema returns an error if the latest schema rejects messages of the version before it, since
+// producers that don't declare a version would break, unless allowIncompatible is set. The same applies if the
+// compatibility can't be checked.
+func checkLatestSchema(files *schema.Files, allowIncompatible bool) error {
+	previous, compatibility, err := files.CompareLatest()
+	if err != nil && !allowIncompatible {
+		return fmt.Errorf("could not check the compatibility of the latest schema: %s", err)
+	}
+	if err != nil {
+		log.WithField("error", err).Warn("Could not check the compatibility of the latest schema")
+		return nil
+	}
+	if previous == nil || compatibility.IsBackwardCompatible() {
+		return nil
+	}
+	for _, change := range compatibility.Changes {
+		if change.Backward {
+			log.WithFields(log.Fields{
+				"version": previous.Version,
+				"element": change.Element,
+				"path":    change.Path,
+			}).Warn(change.Description)
+		}
+	}
+	if !allowIncompatible {
+		return fmt.Errorf("the latest schema is not backward compatible with version %d", previous.Version)
+	}
+	log.WithField("version", previous.Version).Warn("The latest schema is not backward compatible with the previous version")
+	return nil
 }
 
 func handleRoot(writer http.ResponseWriter, request *http.Request) {
@@ -52,18 +156,6 @@ func handleRoot(writer http.ResponseWriter, request *http.Request) {
 	}
 }
 
-func handleSchema(writer http.ResponseWriter, request *http.Request) {
-	version, _ := strconv.Atoi(mux.Vars(request)["version"])
-	pattern := config.Get("api", "schema", "filepattern").String("schema/clustercode_v%d.xsd")
-	path := fmt.Sprintf(pattern, version)
-
-	log.WithFields(log.Fields{
-		"path": path,
-		"uri":  request.RequestURI,
-	}).Debug("Accessing schema")
-	http.ServeFile(writer, request, path)
-}
-
 func LoadConfig() {
 	if err := config.Load(
 		file.NewSource(file.WithPath("defaults.yaml")),
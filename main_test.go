@@ -0,0 +1,61 @@
+package main
+
+import (
+	"github.com/ccremer/clustercode-api-gateway/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// readSchemaVersions writes the given schemas as consecutive versions into dir, the last one being the latest.
+func readSchemaVersions(t *testing.T, dir string, schemas ...[]byte) *schema.Files {
+	latest := ""
+	for i, content := range schemas {
+		latest = filepath.Join(dir, "event_v"+strconv.Itoa(i+1)+".xsd")
+		require.NoError(t, ioutil.WriteFile(latest, content, 0644))
+	}
+	files, err := schema.ReadFiles(latest, filepath.Join(dir, "event_v%d.xsd"))
+	require.NoError(t, err)
+	return files
+}
+
+func TestCheckLatestSchema(t *testing.T) {
+	v1, err := ioutil.ReadFile(eventV1)
+	require.NoError(t, err)
+	v2, err := ioutil.ReadFile(eventV2)
+	require.NoError(t, err)
+	broken := []byte("<xs:schema")
+	tests := []struct {
+		name              string
+		versions          [][]byte
+		allowIncompatible bool
+		expectedErr       string
+	}{
+		{"Compatible", [][]byte{v1, v2}, false, ""},
+		{"SingleVersion", [][]byte{v1}, false, ""},
+		{"Incompatible", [][]byte{v2, v1}, false, "the latest schema is not backward compatible with version 1"},
+		{"IncompatibleButAllowed", [][]byte{v2, v1}, true, ""},
+		{"NotComparable", [][]byte{v1, broken}, false, "could not check the compatibility of the latest schema: "},
+		{"NotComparableButAllowed", [][]byte{v1, broken}, true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "schemas")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			err = checkLatestSchema(readSchemaVersions(t, dir, tt.versions...), tt.allowIncompatible)
+
+			if tt.expectedErr == "" {
+				assert.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expectedErr)
+			}
+		})
+	}
+}
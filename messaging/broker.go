@@ -0,0 +1,88 @@
+package messaging
+
+import (
+	"context"
+	"github.com/streadway/amqp"
+)
+
+type (
+	// Broker is implemented by RabbitMqService and MemoryBroker. Deliveries are settled through the broker they have
+	// been consumed from.
+	Broker interface {
+		// Start declares the given channels. Channels with a Consumer start consuming. It does not wait for the broker
+		// to become reachable, see Status.
+		Start(configs ...*ChannelConfig)
+		// Declare sets up the queue, exchange, bindings and QoS of the channel.
+		Declare(config *ChannelConfig) error
+		// Subscribe declares the channel and delivers its messages to the consumer.
+		Subscribe(config *ChannelConfig, consumer Consumer) error
+		Publish(config *ChannelConfig, payload string) error
+		PublishContext(ctx context.Context, config *ChannelConfig, payload string) error
+		Ack(d *Delivery) error
+		Nack(d *Delivery, requeue bool) error
+		DeadLetter(d *Delivery, reason error) error
+		Requeue(d *Delivery, reason error) error
+		EnableDeadLetters(o *DeadLetterOptions) *ChannelConfig
+		PeekDeadLetters(limit int) ([]DeadLetterMessage, error)
+		ReplayDeadLetter(ctx context.Context, id string, edit Editor) error
+		DropDeadLetter(id string) error
+		Status() ServiceStatus
+		Stop(ctx context.Context) error
+	}
+	// Delivery is a message consumed from a Broker. It has to be settled with Ack, Nack, DeadLetter or Requeue of
+	// the same Broker.
+	Delivery struct {
+		Body        []byte
+		ContentType string
+		// Type is the type property of the message, e.g. "TaskAddedEvent"
+		Type          string
+		Headers       map[string]interface{}
+		MessageId     string
+		CorrelationId string
+		Exchange      string
+		RoutingKey    string
+		// Queue is the name of the queue the message has been consumed from.
+		Queue       string
+		Redelivered bool
+		delivery    *amqp.Delivery
+	}
+)
+
+var (
+	_ Broker = &RabbitMqService{}
+	_ Broker = &MemoryBroker{}
+)
+
+// Declare initializes the channel, which is reinitialized after each reconnect.
+func (s *RabbitMqService) Declare(config *ChannelConfig) error {
+	return s.AddChannelConfig(config)
+}
+
+func (s *RabbitMqService) Subscribe(config *ChannelConfig, consumer Consumer) error {
+	config.Consumer = consumer
+	return s.AddChannelConfig(config)
+}
+
+func (s *RabbitMqService) Ack(d *Delivery) error {
+	return d.delivery.Ack(false)
+}
+
+func (s *RabbitMqService) Nack(d *Delivery, requeue bool) error {
+	return d.delivery.Nack(false, requeue)
+}
+
+func newDelivery(queue string, d *amqp.Delivery) *Delivery {
+	return &Delivery{
+		Body:          d.Body,
+		ContentType:   d.ContentType,
+		Type:          d.Type,
+		Headers:       d.Headers,
+		MessageId:     d.MessageId,
+		CorrelationId: d.CorrelationId,
+		Exchange:      d.Exchange,
+		RoutingKey:    d.RoutingKey,
+		Queue:         queue,
+		Redelivered:   d.Redelivered,
+		delivery:      d,
+	}
+}
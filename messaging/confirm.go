@@ -0,0 +1,109 @@
+package messaging
+
+import (
+	"errors"
+	"github.com/streadway/amqp"
+	"sync"
+)
+
+var (
+	ErrNack          = errors.New("message has been rejected by the broker")
+	ErrChannelClosed = errors.New("channel has been closed before the broker confirmed the message")
+)
+
+type (
+	// confirmer matches publisher confirms of a channel in confirm mode to the waiting publishers.
+	// The broker numbers the messages of a channel sequentially starting at 1.
+	confirmer struct {
+		// publishing keeps the numbering in the order the messages are written to the channel. The channel
+		// serializes its writes anyway, but confirms and forgotten publishes are not held up by a slow write.
+		publishing *sync.Mutex
+		m          *sync.Mutex
+		seq        uint64
+		waiters    map[uint64]chan bool
+		closed     bool
+	}
+)
+
+func newConfirmer(ch *amqp.Channel) (*confirmer, error) {
+	if err := ch.Confirm(false); err != nil {
+		return nil, err
+	}
+	return startConfirmer(ch.NotifyPublish(make(chan amqp.Confirmation, 16))), nil
+}
+
+// startConfirmer dispatches the given confirms until the channel is closed.
+func startConfirmer(confirms <-chan amqp.Confirmation) *confirmer {
+	c := &confirmer{
+		publishing: &sync.Mutex{},
+		m:          &sync.Mutex{},
+		waiters:    make(map[uint64]chan bool),
+	}
+	go c.dispatch(confirms)
+	return c
+}
+
+// publish invokes fn and returns a channel that receives whether the broker acknowledged the message.
+// The channel is closed without value if the AMQP channel closes before.
+func (c *confirmer) publish(fn func() error) (<-chan bool, uint64, error) {
+	c.publishing.Lock()
+	defer c.publishing.Unlock()
+	waiter, tag, err := c.register()
+	if err != nil {
+		return nil, 0, err
+	}
+	// The waiter is registered before, since the confirm may arrive before fn returns.
+	if err := fn(); err != nil {
+		c.unregister(tag)
+		return nil, 0, err
+	}
+	return waiter, tag, nil
+}
+
+func (c *confirmer) register() (chan bool, uint64, error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if c.closed {
+		return nil, 0, ErrChannelClosed
+	}
+	c.seq++
+	waiter := make(chan bool, 1)
+	c.waiters[c.seq] = waiter
+	return waiter, c.seq, nil
+}
+
+// unregister takes back the tag of a message that could not be published, so the broker did not number it.
+// Only valid while publishing is locked, otherwise a later message could have taken the next tag already.
+func (c *confirmer) unregister(tag uint64) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	delete(c.waiters, tag)
+	if c.seq == tag {
+		c.seq--
+	}
+}
+
+func (c *confirmer) forget(tag uint64) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	delete(c.waiters, tag)
+}
+
+func (c *confirmer) dispatch(confirms <-chan amqp.Confirmation) {
+	for confirm := range confirms {
+		c.m.Lock()
+		if waiter, exists := c.waiters[confirm.DeliveryTag]; exists {
+			waiter <- confirm.Ack
+			delete(c.waiters, confirm.DeliveryTag)
+		}
+		c.m.Unlock()
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.closed = true
+	for tag, waiter := range c.waiters {
+		close(waiter)
+		delete(c.waiters, tag)
+	}
+}
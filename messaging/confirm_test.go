@@ -0,0 +1,127 @@
+package messaging
+
+import (
+	"errors"
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func publishNothing() error {
+	return nil
+}
+
+func receiveConfirm(t *testing.T, confirmed <-chan bool) (ack bool, ok bool) {
+	select {
+	case ack, ok = <-confirmed:
+		return ack, ok
+	case <-time.After(time.Second):
+		require.FailNow(t, "no confirm received")
+		return false, false
+	}
+}
+
+func TestConfirmer_ShouldMatchConfirmsByDeliveryTag(t *testing.T) {
+	confirms := make(chan amqp.Confirmation)
+	defer close(confirms)
+	c := startConfirmer(confirms)
+
+	first, firstTag, err := c.publish(publishNothing)
+	require.NoError(t, err)
+	second, secondTag, err := c.publish(publishNothing)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), firstTag)
+	assert.Equal(t, uint64(2), secondTag)
+
+	confirms <- amqp.Confirmation{DeliveryTag: 2, Ack: false}
+	confirms <- amqp.Confirmation{DeliveryTag: 1, Ack: true}
+
+	ack, ok := receiveConfirm(t, first)
+	assert.True(t, ok)
+	assert.True(t, ack)
+	ack, ok = receiveConfirm(t, second)
+	assert.True(t, ok)
+	assert.False(t, ack)
+}
+
+func TestConfirmer_ShouldNotNumberFailedPublishes(t *testing.T) {
+	confirms := make(chan amqp.Confirmation)
+	defer close(confirms)
+	c := startConfirmer(confirms)
+	publishErr := errors.New("write failed")
+
+	_, _, err := c.publish(func() error {
+		return publishErr
+	})
+	assert.Equal(t, publishErr, err)
+
+	confirmed, tag, err := c.publish(publishNothing)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), tag, "the broker did not number the failed message")
+	confirms <- amqp.Confirmation{DeliveryTag: 1, Ack: true}
+	ack, _ := receiveConfirm(t, confirmed)
+	assert.True(t, ack)
+}
+
+func TestConfirmer_ShouldForgetTag(t *testing.T) {
+	confirms := make(chan amqp.Confirmation)
+	defer close(confirms)
+	c := startConfirmer(confirms)
+
+	confirmed, tag, err := c.publish(publishNothing)
+	require.NoError(t, err)
+	c.forget(tag)
+	confirms <- amqp.Confirmation{DeliveryTag: tag, Ack: true}
+
+	c.m.Lock()
+	assert.Empty(t, c.waiters)
+	c.m.Unlock()
+	assert.Len(t, confirmed, 0, "forgotten publishers should not receive the confirm")
+}
+
+func TestConfirmer_ShouldReleaseWaitersWhenChannelCloses(t *testing.T) {
+	confirms := make(chan amqp.Confirmation)
+	c := startConfirmer(confirms)
+
+	confirmed, _, err := c.publish(publishNothing)
+	require.NoError(t, err)
+	close(confirms)
+
+	_, ok := receiveConfirm(t, confirmed)
+	assert.False(t, ok)
+	_, _, err = c.publish(publishNothing)
+	assert.Equal(t, ErrChannelClosed, err)
+}
+
+func TestConfirmer_ShouldDispatchConfirmsWhilePublishing(t *testing.T) {
+	confirms := make(chan amqp.Confirmation)
+	defer close(confirms)
+	c := startConfirmer(confirms)
+	first, _, err := c.publish(publishNothing)
+	require.NoError(t, err)
+
+	writing := make(chan struct{})
+	release := make(chan struct{})
+	published := make(chan struct{})
+	go func() {
+		defer close(published)
+		c.publish(func() error {
+			close(writing)
+			<-release
+			return nil
+		})
+	}()
+	<-writing
+
+	select {
+	case confirms <- amqp.Confirmation{DeliveryTag: 1, Ack: true}:
+	case <-time.After(time.Second):
+		require.FailNow(t, "confirms are not dispatched during a slow write")
+	}
+	ack, _ := receiveConfirm(t, first)
+	assert.True(t, ack)
+	close(release)
+	<-published
+}
@@ -0,0 +1,233 @@
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"github.com/streadway/amqp"
+	"time"
+)
+
+const (
+	// HeaderError holds the reason why the gateway dead-lettered the message.
+	HeaderError              = "x-clustercode-error"
+	HeaderOriginalExchange   = "x-original-exchange"
+	HeaderOriginalRoutingKey = "x-original-routing-key"
+	HeaderOriginalQueue      = "x-original-queue"
+	// HeaderDeadLetterID identifies a dead-lettered message in the admin API.
+	HeaderDeadLetterID = "x-clustercode-deadletter-id"
+	// HeaderRedeliveries counts the requeues done by the gateway, which are not recorded in x-death.
+	HeaderRedeliveries = "x-clustercode-redeliveries"
+	// HeaderErrorDetails holds structured details about the reason as JSON, e.g. the schema violations.
+	HeaderErrorDetails = "x-clustercode-error-details"
+
+	deadLetterTimeout     = 10 * time.Second
+	deadLetterChannelName = "deadletter"
+)
+
+type (
+	DeadLetterOptions struct {
+		ExchangeName string
+		QueueName    string
+		// MaxAttempts is the number of deliveries after which a requeued message is dead-lettered. 0 never gives up.
+		MaxAttempts int
+	}
+	// deadLetterer implements dead-lettering and counted requeues on top of the publish function of a broker.
+	// A nil deadLetterer falls back to plain rejects.
+	deadLetterer struct {
+		config  *ChannelConfig
+		options *DeadLetterOptions
+		publish func(options *ExchangeOptions, msg amqp.Publishing) error
+	}
+	// detailedError is implemented by reasons that provide details, which are recorded in HeaderErrorDetails.
+	detailedError interface {
+		Details() interface{}
+	}
+)
+
+func NewDeadLetterOptions() *DeadLetterOptions {
+	return &DeadLetterOptions{
+		ExchangeName: "dead-letters",
+		QueueName:    "dead-letters",
+		MaxAttempts:  5,
+	}
+}
+
+// EnableDeadLetters returns the channel config that declares the dead-letter exchange and queue.
+// The config has to be started along with the other channels.
+func (s *RabbitMqService) EnableDeadLetters(o *DeadLetterOptions) *ChannelConfig {
+	s.deadLetters = newDeadLetterer(o, func(options *ExchangeOptions, msg amqp.Publishing) error {
+		ctx, cancel := context.WithTimeout(context.Background(), deadLetterTimeout)
+		defer cancel()
+		return s.publishConfirmed(ctx, s.deadLetters.config, options, msg)
+	})
+	return s.deadLetters.config
+}
+
+// DeadLetter publishes the delivery to the dead-letter exchange, annotated with the reason and its origin, and
+// acknowledges it. Without dead-letter exchange or if publishing fails, the delivery is rejected so the broker may
+// dead-letter it instead.
+func (s *RabbitMqService) DeadLetter(d *Delivery, reason error) error {
+	return s.deadLetters.deadLetter(d, reason)
+}
+
+// Requeue puts the delivery back to the queue it has been consumed from, unless it reached the maximum attempts.
+// Then it is dead-lettered instead of looping forever.
+func (s *RabbitMqService) Requeue(d *Delivery, reason error) error {
+	return s.deadLetters.requeue(d, reason)
+}
+
+func newDeadLetterer(o *DeadLetterOptions, publish func(options *ExchangeOptions, msg amqp.Publishing) error) *deadLetterer {
+	eConfig := NewExchangeOptions()
+	eConfig.ExchangeName = o.ExchangeName
+	eConfig.Durable = true
+	return &deadLetterer{
+		config: &ChannelConfig{
+			Name: deadLetterChannelName,
+			QueueOptions: &QueueOptions{
+				QueueName: o.QueueName,
+				Durable:   true,
+			},
+			ExchangeOptions: eConfig,
+		},
+		options: o,
+		publish: publish,
+	}
+}
+
+// Attempts returns how often the delivery has been attempted, including the current one.
+// Dead-lettering by the broker is recorded in the x-death header, requeues by the gateway in HeaderRedeliveries.
+func Attempts(d *Delivery) int {
+	return attempts(d.Headers)
+}
+
+func attempts(headers amqp.Table) int {
+	attempts := 1 + int(toInt64(headers[HeaderRedeliveries]))
+	deaths, _ := headers["x-death"].([]interface{})
+	for _, death := range deaths {
+		if table, ok := death.(amqp.Table); ok {
+			attempts += int(toInt64(table["count"]))
+		}
+	}
+	return attempts
+}
+
+func (l *deadLetterer) deadLetter(d *Delivery, reason error) error {
+	logEntry := log.WithFields(log.Fields{
+		"routing_key": d.RoutingKey,
+		"queue_name":  d.Queue,
+		"reason":      reason,
+	})
+	if l == nil {
+		logEntry.Warn("dead-letter exchange is not enabled, discarding message")
+		return d.delivery.Nack(false, false)
+	}
+
+	headers := withOrigin(d)
+	headers[HeaderError] = fmt.Sprint(reason)
+	delete(headers, HeaderErrorDetails)
+	if detailed, ok := reason.(detailedError); ok {
+		if details, err := json.Marshal(detailed.Details()); err == nil {
+			headers[HeaderErrorDetails] = string(details)
+		}
+	}
+	headers[HeaderDeadLetterID] = newCorrelationID()
+
+	options := *l.config.ExchangeOptions
+	options.RoutingKey, _ = headers[HeaderOriginalRoutingKey].(string)
+	if err := l.publish(&options, republishing(d.delivery, headers)); err != nil {
+		// Requeueing would redeliver the message right away and fail again. The x-dead-letter-exchange argument of
+		// the queue may still route it, otherwise it is dropped.
+		logEntry.WithField("error", err).Error("could not dead-letter message, rejecting it")
+		d.delivery.Nack(false, false)
+		return err
+	}
+	logEntry.Warn("dead-lettered message")
+	return d.delivery.Ack(false)
+}
+
+func (l *deadLetterer) requeue(d *Delivery, reason error) error {
+	if l == nil {
+		// Without confirmed republishing, the redeliveries can't be counted.
+		return d.delivery.Nack(false, true)
+	}
+	attempts := attempts(d.Headers)
+	if maxAttempts := l.options.MaxAttempts; maxAttempts > 0 && attempts >= maxAttempts {
+		return l.deadLetter(d, fmt.Errorf("giving up after %d attempts: %s", attempts, reason))
+	}
+
+	headers := withOrigin(d)
+	headers[HeaderRedeliveries] = toInt64(d.Headers[HeaderRedeliveries]) + 1
+
+	// The default exchange routes to the queue with the same name as the routing key.
+	options := NewExchangeOptions()
+	options.ExchangeName = ""
+	options.RoutingKey = d.Queue
+	if err := l.publish(options, republishing(d.delivery, headers)); err != nil {
+		log.WithFields(log.Fields{
+			"queue_name": d.Queue,
+			"error":      err,
+		}).Warn("could not requeue message with redelivery count")
+		return d.delivery.Nack(false, true)
+	}
+	log.WithFields(log.Fields{
+		"queue_name": d.Queue,
+		"attempts":   attempts,
+		"reason":     reason,
+	}).Debug("requeued message")
+	return d.delivery.Ack(false)
+}
+
+func republishing(d *amqp.Delivery, headers amqp.Table) amqp.Publishing {
+	return amqp.Publishing{
+		Headers:         headers,
+		ContentType:     d.ContentType,
+		ContentEncoding: d.ContentEncoding,
+		DeliveryMode:    amqp.Persistent,
+		Priority:        d.Priority,
+		CorrelationId:   d.CorrelationId,
+		ReplyTo:         d.ReplyTo,
+		MessageId:       d.MessageId,
+		Timestamp:       d.Timestamp,
+		Type:            d.Type,
+		AppId:           d.AppId,
+		Body:            d.Body,
+	}
+}
+
+// withOrigin copies the headers and records where the delivery came from, unless a requeue already did.
+// Requeued messages arrive through the default exchange, which is not where they have to be replayed to.
+func withOrigin(d *Delivery) amqp.Table {
+	headers := copyHeaders(d.Headers)
+	if _, exists := headers[HeaderOriginalExchange]; !exists {
+		headers[HeaderOriginalExchange] = d.Exchange
+		headers[HeaderOriginalRoutingKey] = d.RoutingKey
+		headers[HeaderOriginalQueue] = d.Queue
+	}
+	return headers
+}
+
+func copyHeaders(headers amqp.Table) amqp.Table {
+	copied := make(amqp.Table, len(headers)+4)
+	for key, value := range headers {
+		copied[key] = value
+	}
+	return copied
+}
+
+func toInt64(value interface{}) int64 {
+	switch v := value.(type) {
+	case int64:
+		return v
+	case int32:
+		return int64(v)
+	case int:
+		return int64(v)
+	case int16:
+		return int64(v)
+	case int8:
+		return int64(v)
+	}
+	return 0
+}
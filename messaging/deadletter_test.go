@@ -0,0 +1,223 @@
+package messaging
+
+import (
+	"errors"
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestAttempts(t *testing.T) {
+	tests := []struct {
+		name     string
+		headers  amqp.Table
+		expected int
+	}{
+		{
+			name:     "FirstDelivery",
+			headers:  nil,
+			expected: 1,
+		},
+		{
+			name:     "RequeuedByGateway",
+			headers:  amqp.Table{HeaderRedeliveries: int64(2)},
+			expected: 3,
+		},
+		{
+			name: "DeadLetteredByBroker",
+			headers: amqp.Table{"x-death": []interface{}{
+				amqp.Table{"count": int64(2), "queue": "task-added", "reason": "rejected"},
+				amqp.Table{"count": int64(1), "queue": "task-added-retry", "reason": "expired"},
+			}},
+			expected: 4,
+		},
+		{
+			name: "Both",
+			headers: amqp.Table{
+				HeaderRedeliveries: int32(1),
+				"x-death":          []interface{}{amqp.Table{"count": int64(1)}},
+			},
+			expected: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, Attempts(&Delivery{Headers: tt.headers}))
+		})
+	}
+}
+
+func TestNewDeadLetterMessage_ShouldReadGatewayHeaders(t *testing.T) {
+	message := newDeadLetterMessage(&amqp.Delivery{
+		Exchange:   "dead-letters",
+		RoutingKey: "task-cancelled",
+		Headers: amqp.Table{
+			HeaderDeadLetterID:       "abc",
+			HeaderError:              "element JobId is not valid",
+			HeaderOriginalExchange:   "task-cancelled",
+			HeaderOriginalRoutingKey: "",
+			HeaderOriginalQueue:      "amq.gen-123",
+		},
+		Body: []byte("<TaskCancelledEvent/>"),
+	})
+
+	assert.Equal(t, "abc", message.ID)
+	assert.Equal(t, "task-cancelled", message.Exchange)
+	assert.Equal(t, "", message.RoutingKey)
+	assert.Equal(t, "amq.gen-123", message.Queue)
+	assert.Equal(t, "element JobId is not valid", message.Error)
+	assert.Equal(t, "<TaskCancelledEvent/>", message.Body)
+}
+
+func TestNewDeadLetterMessage_ShouldReadLatestDeath(t *testing.T) {
+	message := newDeadLetterMessage(&amqp.Delivery{
+		Exchange:  "dead-letters",
+		MessageId: "msg-1",
+		Headers: amqp.Table{"x-death": []interface{}{
+			amqp.Table{"count": int64(1), "exchange": "slice-added", "queue": "slice-added", "reason": "expired",
+				"routing-keys": []interface{}{"slice"}},
+			amqp.Table{"count": int64(1), "exchange": "other", "queue": "other", "reason": "rejected"},
+		}},
+	})
+
+	assert.Equal(t, "msg-1", message.ID)
+	assert.Equal(t, "slice-added", message.Exchange)
+	assert.Equal(t, "slice", message.RoutingKey)
+	assert.Equal(t, "expired", message.Error)
+	assert.Equal(t, 3, message.Attempts)
+}
+
+func TestDeadLetterID_ShouldFallBackToContent(t *testing.T) {
+	first := deadLetterID(&amqp.Delivery{Body: []byte("a")})
+	assert.Equal(t, first, deadLetterID(&amqp.Delivery{Body: []byte("a")}))
+	assert.NotEqual(t, first, deadLetterID(&amqp.Delivery{Body: []byte("b")}))
+}
+
+// recordingAcknowledger records how a delivery has been settled.
+type recordingAcknowledger struct {
+	acked    bool
+	rejected bool
+	requeued bool
+}
+
+func (a *recordingAcknowledger) Ack(tag uint64, multiple bool) error {
+	a.acked = true
+	return nil
+}
+
+func (a *recordingAcknowledger) Nack(tag uint64, multiple bool, requeue bool) error {
+	a.rejected = !requeue
+	a.requeued = requeue
+	return nil
+}
+
+func (a *recordingAcknowledger) Reject(tag uint64, requeue bool) error {
+	return a.Nack(tag, false, requeue)
+}
+
+type publishedMessage struct {
+	options *ExchangeOptions
+	msg     amqp.Publishing
+}
+
+// newRecordingDeadLetterer returns a dead-letterer that records its publishings, failing them with publishErr.
+func newRecordingDeadLetterer(maxAttempts int, publishErr error) (*deadLetterer, *[]publishedMessage) {
+	options := NewDeadLetterOptions()
+	options.MaxAttempts = maxAttempts
+	var published []publishedMessage
+	l := newDeadLetterer(options, func(options *ExchangeOptions, msg amqp.Publishing) error {
+		published = append(published, publishedMessage{options: options, msg: msg})
+		return publishErr
+	})
+	return l, &published
+}
+
+// newTestDelivery returns a delivery whose consumer tag differs from the queue, as with custom initializers.
+func newTestDelivery(headers amqp.Table) (*Delivery, *recordingAcknowledger) {
+	acknowledger := &recordingAcknowledger{}
+	return newDelivery("work", &amqp.Delivery{
+		Acknowledger: acknowledger,
+		ConsumerTag:  "ctag-1",
+		Exchange:     "work-exchange",
+		RoutingKey:   "work-key",
+		Headers:      headers,
+		Body:         []byte("payload"),
+	}), acknowledger
+}
+
+func TestDeadLetterer_DeadLetter_ShouldPublishWithOriginAndAck(t *testing.T) {
+	l, published := newRecordingDeadLetterer(0, nil)
+	d, acknowledger := newTestDelivery(nil)
+
+	require.NoError(t, l.deadLetter(d, errors.New("invalid")))
+
+	require.Len(t, *published, 1)
+	p := (*published)[0]
+	assert.Equal(t, l.options.ExchangeName, p.options.ExchangeName)
+	assert.Equal(t, "work-key", p.options.RoutingKey)
+	assert.Equal(t, "work-exchange", p.msg.Headers[HeaderOriginalExchange])
+	assert.Equal(t, "work", p.msg.Headers[HeaderOriginalQueue])
+	assert.Equal(t, "invalid", p.msg.Headers[HeaderError])
+	assert.Equal(t, "payload", string(p.msg.Body))
+	assert.True(t, acknowledger.acked)
+}
+
+func TestDeadLetterer_DeadLetter_ShouldRejectWithoutRequeueIfPublishFails(t *testing.T) {
+	publishErr := errors.New("NOT_FOUND - no exchange 'dead-letters'")
+	l, _ := newRecordingDeadLetterer(0, publishErr)
+	d, acknowledger := newTestDelivery(nil)
+
+	assert.Equal(t, publishErr, l.deadLetter(d, errors.New("invalid")))
+
+	assert.False(t, acknowledger.acked)
+	assert.True(t, acknowledger.rejected)
+	assert.False(t, acknowledger.requeued, "requeueing would redeliver the message in a loop")
+}
+
+func TestDeadLetterer_DeadLetter_ShouldRejectIfDisabled(t *testing.T) {
+	var l *deadLetterer
+	d, acknowledger := newTestDelivery(nil)
+
+	require.NoError(t, l.deadLetter(d, errors.New("invalid")))
+
+	assert.True(t, acknowledger.rejected)
+}
+
+func TestDeadLetterer_Requeue_ShouldPublishToConsumedQueue(t *testing.T) {
+	l, published := newRecordingDeadLetterer(3, nil)
+	d, acknowledger := newTestDelivery(amqp.Table{HeaderRedeliveries: int64(1)})
+
+	require.NoError(t, l.requeue(d, errors.New("try again")))
+
+	require.Len(t, *published, 1)
+	p := (*published)[0]
+	assert.Equal(t, "", p.options.ExchangeName)
+	assert.Equal(t, "work", p.options.RoutingKey)
+	assert.Equal(t, int64(2), p.msg.Headers[HeaderRedeliveries])
+	assert.Equal(t, "work", p.msg.Headers[HeaderOriginalQueue])
+	assert.True(t, acknowledger.acked)
+}
+
+func TestDeadLetterer_Requeue_ShouldDeadLetterAtMaxAttempts(t *testing.T) {
+	l, published := newRecordingDeadLetterer(3, nil)
+	d, acknowledger := newTestDelivery(amqp.Table{HeaderRedeliveries: int64(2)})
+
+	require.NoError(t, l.requeue(d, errors.New("try again")))
+
+	require.Len(t, *published, 1)
+	p := (*published)[0]
+	assert.Equal(t, l.options.ExchangeName, p.options.ExchangeName)
+	assert.Equal(t, "giving up after 3 attempts: try again", p.msg.Headers[HeaderError])
+	assert.True(t, acknowledger.acked)
+}
+
+func TestDeadLetterer_Requeue_ShouldFallBackToBrokerRequeue(t *testing.T) {
+	l, _ := newRecordingDeadLetterer(3, errors.New("channel closed"))
+	d, acknowledger := newTestDelivery(nil)
+
+	require.NoError(t, l.requeue(d, errors.New("try again")))
+
+	assert.False(t, acknowledger.acked)
+	assert.True(t, acknowledger.requeued)
+}
@@ -0,0 +1,270 @@
+package messaging
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/streadway/amqp"
+)
+
+// Stops searching the dead-letter queue after this many messages, since all of them are held unacknowledged.
+const deadLetterScanLimit = 10000
+
+var (
+	ErrDeadLettersDisabled = errors.New("dead-letter exchange is not enabled")
+	ErrDeadLetterNotFound  = errors.New("dead-lettered message not found")
+	ErrUnknownExchange     = errors.New("no channel publishes to the original exchange of the message")
+	ErrUnknownQueue        = errors.New("the original queue of the message does not exist anymore")
+)
+
+type (
+	// DeadLetterMessage is a message in the dead-letter queue.
+	DeadLetterMessage struct {
+		ID           string          `json:"id"`
+		Exchange     string          `json:"exchange"`
+		RoutingKey   string          `json:"routingKey"`
+		Queue        string          `json:"queue,omitempty"`
+		Error        string          `json:"error,omitempty"`
+		ErrorDetails json.RawMessage `json:"errorDetails,omitempty"`
+		Attempts     int             `json:"attempts"`
+		ContentType  string          `json:"contentType,omitempty"`
+		Headers      amqp.Table      `json:"headers,omitempty"`
+		Body         string          `json:"body"`
+	}
+	// Editor returns the payload to replay for the given message. A returned error aborts the replay.
+	Editor func(message *DeadLetterMessage) (string, error)
+)
+
+// PeekDeadLetters returns up to limit messages from the head of the dead-letter queue without removing them.
+func (s *RabbitMqService) PeekDeadLetters(limit int) ([]DeadLetterMessage, error) {
+	ch, err := s.openDeadLetterChannel()
+	if err != nil {
+		return nil, err
+	}
+	// Closing the channel puts all unacknowledged messages back into the queue.
+	defer ch.Close()
+
+	messages := make([]DeadLetterMessage, 0)
+	for len(messages) < limit {
+		d, ok, err := ch.Get(s.deadLetters.options.QueueName, false)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		messages = append(messages, newDeadLetterMessage(&d))
+	}
+	return messages, nil
+}
+
+// ReplayDeadLetter republishes the message with the given ID to its original queue, see replayTarget, and removes it
+// from the dead-letter queue once the broker confirmed it or ctx is done. The payload is given by the editor, which
+// may return the body unchanged. The headers are replayed as well, see newReplayPublishing.
+func (s *RabbitMqService) ReplayDeadLetter(ctx context.Context, id string, edit Editor) error {
+	return s.withDeadLetter(id, func(message *DeadLetterMessage) error {
+		options, err := replayTarget(s.getChannels(), message)
+		if err != nil {
+			return err
+		}
+		if options.ExchangeName == "" {
+			if err := s.checkQueue(options.RoutingKey); err != nil {
+				return err
+			}
+		}
+		payload, err := edit(message)
+		if err != nil {
+			return err
+		}
+		return s.publishConfirmed(ctx, s.deadLetters.config, options, newReplayPublishing(options, message, payload))
+	})
+}
+
+// newReplayPublishing keeps the headers of the message, e.g. the schema version, except for the records of its
+// previous attempts, so that the attempts start over.
+func newReplayPublishing(options *ExchangeOptions, message *DeadLetterMessage, payload string) amqp.Publishing {
+	publishing := newPublishing(options, payload)
+	publishing.Headers = copyHeaders(message.Headers)
+	for _, header := range []string{"x-death", HeaderRedeliveries, HeaderError, HeaderErrorDetails, HeaderDeadLetterID} {
+		delete(publishing.Headers, header)
+	}
+	return publishing
+}
+
+// checkQueue returns ErrUnknownQueue if the queue does not exist, e.g. the exclusive queue of a restarted observer.
+// The broker drops messages to unknown queues silently.
+func (s *RabbitMqService) checkQueue(name string) error {
+	ch, err := s.tryCreateChannel()
+	if err != nil {
+		return err
+	}
+	// A failed passive declaration closes the channel, closing it again just returns an error.
+	defer ch.Close()
+	if _, err := ch.QueueDeclarePassive(name, false, false, false, false, nil); err != nil {
+		if amqpErr, ok := err.(*amqp.Error); ok && amqpErr.Code == amqp.NotFound {
+			return ErrUnknownQueue
+		}
+		return err
+	}
+	return nil
+}
+
+// DropDeadLetter removes the message with the given ID from the dead-letter queue.
+func (s *RabbitMqService) DropDeadLetter(id string) error {
+	return s.withDeadLetter(id, func(message *DeadLetterMessage) error {
+		return nil
+	})
+}
+
+// withDeadLetter fetches messages with basic.get until it finds the one with the given ID. The message is only
+// acknowledged if fn succeeds. If the gateway stops in between, the broker puts all messages back into the queue.
+func (s *RabbitMqService) withDeadLetter(id string, fn func(message *DeadLetterMessage) error) error {
+	ch, err := s.openDeadLetterChannel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+
+	for i := 0; i < deadLetterScanLimit; i++ {
+		d, ok, err := ch.Get(s.deadLetters.options.QueueName, false)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrDeadLetterNotFound
+		}
+		message := newDeadLetterMessage(&d)
+		if message.ID != id {
+			continue
+		}
+		if err := fn(&message); err != nil {
+			return err
+		}
+		log.WithFields(log.Fields{
+			"id":       id,
+			"exchange": message.Exchange,
+		}).Info("removed message from dead-letter queue")
+		return d.Ack(false)
+	}
+	return ErrDeadLetterNotFound
+}
+
+func (s *RabbitMqService) openDeadLetterChannel() (*amqp.Channel, error) {
+	if s.deadLetters == nil {
+		return nil, ErrDeadLettersDisabled
+	}
+	if !s.IsConnected() {
+		return nil, ErrNotConnected
+	}
+	return s.tryCreateChannel()
+}
+
+// replayTarget returns where to replay the message to. If the queue it has been consumed from is known, it is routed
+// there through the default exchange. Replaying it to a fanout exchange would duplicate it for every other queue bound
+// to it, like those of observers. Otherwise, it is replayed to its original exchange.
+func replayTarget(channels []*ChannelConfig, message *DeadLetterMessage) (*ExchangeOptions, error) {
+	if message.Queue != "" {
+		options := NewExchangeOptions()
+		options.ExchangeName = ""
+		options.RoutingKey = message.Queue
+		return options, nil
+	}
+	config := findPublishingChannel(channels, message.Exchange, message.RoutingKey)
+	if config == nil {
+		return nil, ErrUnknownExchange
+	}
+	return publishOptions(config), nil
+}
+
+// findPublishingChannel returns the first channel that publishes to the given exchange. Messages from the default
+// exchange are matched by the queue name, which is their routing key.
+func findPublishingChannel(channels []*ChannelConfig, exchange string, routingKey string) *ChannelConfig {
+	for _, config := range channels {
+		if config.Name == deadLetterChannelName {
+			continue
+		}
+		if exchange == "" {
+			if config.ExchangeOptions == nil && config.QueueOptions != nil && config.QueueOptions.QueueName == routingKey {
+				return config
+			}
+			continue
+		}
+		if config.ExchangeOptions != nil && config.ExchangeOptions.ExchangeName == exchange {
+			return config
+		}
+	}
+	return nil
+}
+
+func newDeadLetterMessage(d *amqp.Delivery) DeadLetterMessage {
+	message := DeadLetterMessage{
+		ID:          deadLetterID(d),
+		Exchange:    d.Exchange,
+		RoutingKey:  d.RoutingKey,
+		Attempts:    attempts(d.Headers),
+		ContentType: d.ContentType,
+		Headers:     d.Headers,
+		Body:        string(d.Body),
+	}
+	// Messages dead-lettered by the gateway carry their origin in headers, the delivery itself is from the dead-letter exchange.
+	if exchange, ok := d.Headers[HeaderOriginalExchange].(string); ok {
+		message.Exchange = exchange
+	}
+	if routingKey, ok := d.Headers[HeaderOriginalRoutingKey].(string); ok {
+		message.RoutingKey = routingKey
+	}
+	if queue, ok := d.Headers[HeaderOriginalQueue].(string); ok {
+		message.Queue = queue
+	}
+	if reason, ok := d.Headers[HeaderError].(string); ok {
+		message.Error = reason
+	}
+	if details, ok := d.Headers[HeaderErrorDetails].(string); ok && json.Valid([]byte(details)) {
+		message.ErrorDetails = json.RawMessage(details)
+	}
+	if _, ok := d.Headers[HeaderOriginalExchange]; !ok {
+		applyLatestDeath(&message, d.Headers)
+	}
+	return message
+}
+
+// Messages dead-lettered by the broker carry their origin in the most recent x-death entry.
+func applyLatestDeath(message *DeadLetterMessage, headers amqp.Table) {
+	deaths, _ := headers["x-death"].([]interface{})
+	if len(deaths) == 0 {
+		return
+	}
+	death, ok := deaths[0].(amqp.Table)
+	if !ok {
+		return
+	}
+	if exchange, ok := death["exchange"].(string); ok {
+		message.Exchange = exchange
+	}
+	if keys, ok := death["routing-keys"].([]interface{}); ok && len(keys) > 0 {
+		if routingKey, ok := keys[0].(string); ok {
+			message.RoutingKey = routingKey
+		}
+	}
+	if queue, ok := death["queue"].(string); ok {
+		message.Queue = queue
+	}
+	if reason, ok := death["reason"].(string); ok {
+		message.Error = reason
+	}
+}
+
+// Messages dead-lettered by the broker don't have our ID header, they are identified by message ID or content.
+func deadLetterID(d *amqp.Delivery) string {
+	if id, ok := d.Headers[HeaderDeadLetterID].(string); ok {
+		return id
+	}
+	if d.MessageId != "" {
+		return d.MessageId
+	}
+	hash := sha1.Sum(d.Body)
+	return hex.EncodeToString(hash[:])
+}
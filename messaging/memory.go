@@ -0,0 +1,559 @@
+package messaging
+
+import (
+	"context"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"github.com/streadway/amqp"
+	"sort"
+	"sync"
+)
+
+type (
+	// MemoryBroker is an in-process Broker, e.g. for end-to-end tests without RabbitMQ. It supports the default,
+	// fanout and direct exchanges, prefetch limits, concurrent consumers, requeues and dead-lettering with the
+	// "x-dead-letter-exchange" queue argument. Custom Initializers are not supported, every channel is declared
+	// like the default initializer does.
+	MemoryBroker struct {
+		m           *sync.Mutex
+		cond        *sync.Cond
+		exchanges   map[string]*memoryExchange
+		queues      map[string]*memoryQueue
+		channels    []*ChannelConfig
+		subscribers []*memoryConsumer
+		consumers   *consumerGroup
+		deadLetters *deadLetterer
+		queueSeq    int
+		// generatedQueues remembers the server-named queue of each channel, so that declaring it again reuses it.
+		generatedQueues map[*ChannelConfig]string
+		stopped         bool
+	}
+	memoryExchange struct {
+		kind     string
+		bindings []memoryBinding
+	}
+	memoryBinding struct {
+		queue      string
+		routingKey string
+	}
+	memoryQueue struct {
+		name    string
+		args    amqp.Table
+		ready   []amqp.Delivery
+		unacked map[uint64]*memoryDelivery
+		tagSeq  uint64
+		// consumers holds the channels consuming from the queue, so that declaring them again doesn't add consumers.
+		consumers map[*ChannelConfig]*memoryConsumer
+	}
+	memoryDelivery struct {
+		delivery amqp.Delivery
+		consumer *memoryConsumer
+	}
+	memoryConsumer struct {
+		tag       string
+		queue     *memoryQueue
+		prefetch  int
+		inFlight  int
+		cancelled bool
+	}
+	// memoryAcknowledger settles the deliveries of one queue, like a channel does for RabbitMQ.
+	memoryAcknowledger struct {
+		broker *MemoryBroker
+		queue  *memoryQueue
+	}
+)
+
+func NewMemoryBroker() *MemoryBroker {
+	m := &sync.Mutex{}
+	return &MemoryBroker{
+		m:         m,
+		cond:      sync.NewCond(m),
+		exchanges: make(map[string]*memoryExchange),
+		queues:    make(map[string]*memoryQueue),
+		consumers: newConsumerGroup(),
+
+		generatedQueues: make(map[*ChannelConfig]string),
+	}
+}
+
+func (b *MemoryBroker) Start(configs ...*ChannelConfig) {
+	for _, config := range configs {
+		if err := b.Declare(config); err != nil {
+			log.WithFields(log.Fields{
+				"channel": config.Name,
+				"error":   err,
+			}).Warn("could not declare channel")
+		}
+	}
+}
+
+func (b *MemoryBroker) Declare(config *ChannelConfig) error {
+	b.m.Lock()
+	defer b.m.Unlock()
+	if b.stopped {
+		return ErrNotConnected
+	}
+	if config.stats == nil {
+		config.stats = newChannelStats()
+		b.channels = append(b.channels, config)
+	}
+	err := b.declare(config)
+	config.stats.setError(err)
+	config.stats.setOpen(err == nil)
+	return err
+}
+
+func (b *MemoryBroker) Subscribe(config *ChannelConfig, consumer Consumer) error {
+	config.Consumer = consumer
+	return b.Declare(config)
+}
+
+func (b *MemoryBroker) declare(config *ChannelConfig) error {
+	if config.ExchangeOptions != nil {
+		if err := b.declareExchange(config.ExchangeOptions); err != nil {
+			return err
+		}
+	}
+	if config.QueueOptions == nil {
+		return nil
+	}
+
+	q := b.declareQueue(config)
+	if config.ExchangeOptions != nil {
+		b.bind(q.name, config.ExchangeOptions.ExchangeName, config.ExchangeOptions.RoutingKey)
+	}
+	for _, binding := range config.Bindings {
+		if _, exists := b.exchanges[binding.ExchangeName]; !exists {
+			return fmt.Errorf("failed to bind queue '%s' to exchange '%s': no such exchange", q.name, binding.ExchangeName)
+		}
+		b.bind(q.name, binding.ExchangeName, binding.RoutingKey)
+	}
+
+	if _, consuming := q.consumers[config]; config.Consumer != nil && !consuming {
+		return b.consume(config, &memoryConsumer{
+			tag:      q.name,
+			queue:    q,
+			prefetch: prefetchCount(config),
+		})
+	}
+	return nil
+}
+
+func (b *MemoryBroker) declareExchange(o *ExchangeOptions) error {
+	if o.ExchangeName == "" {
+		// The default exchange always exists.
+		return nil
+	}
+	if o.ExchangeType != "fanout" && o.ExchangeType != "direct" {
+		return fmt.Errorf("failed to create exchange '%s': type '%s' is not supported", o.ExchangeName, o.ExchangeType)
+	}
+	if existing, exists := b.exchanges[o.ExchangeName]; exists {
+		if existing.kind != o.ExchangeType {
+			return fmt.Errorf("failed to create exchange '%s': already declared as '%s'", o.ExchangeName, existing.kind)
+		}
+		return nil
+	}
+	b.exchanges[o.ExchangeName] = &memoryExchange{kind: o.ExchangeType}
+	return nil
+}
+
+func (b *MemoryBroker) declareQueue(config *ChannelConfig) *memoryQueue {
+	o := config.QueueOptions
+	name := o.QueueName
+	if generated, exists := b.generatedQueues[config]; name == "" && exists {
+		name = generated
+	} else if name == "" {
+		b.queueSeq++
+		name = fmt.Sprintf("amq.gen-%d", b.queueSeq)
+		b.generatedQueues[config] = name
+	}
+	if q, exists := b.queues[name]; exists {
+		return q
+	}
+	q := &memoryQueue{
+		name:      name,
+		args:      o.Args,
+		unacked:   make(map[uint64]*memoryDelivery),
+		consumers: make(map[*ChannelConfig]*memoryConsumer),
+	}
+	b.queues[name] = q
+	return q
+}
+
+func (b *MemoryBroker) bind(queue string, exchange string, routingKey string) {
+	ex, exists := b.exchanges[exchange]
+	if !exists {
+		return
+	}
+	for _, binding := range ex.bindings {
+		if binding.queue == queue && binding.routingKey == routingKey {
+			return
+		}
+	}
+	ex.bindings = append(ex.bindings, memoryBinding{queue: queue, routingKey: routingKey})
+}
+
+// consume starts the workers of the consumer, all or none of them like beginConsuming.
+func (b *MemoryBroker) consume(config *ChannelConfig, c *memoryConsumer) error {
+	workers := workerCount(config)
+	if !b.consumers.add(workers) {
+		return ErrStopping
+	}
+	b.subscribers = append(b.subscribers, c)
+	c.queue.consumers[config] = c
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer b.consumers.done()
+			for {
+				d, ok := b.next(c)
+				if !ok {
+					return
+				}
+				config.stats.consumed()
+				config.Consumer(newDelivery(c.queue.name, &d))
+			}
+		}()
+	}
+	return nil
+}
+
+// next blocks until a message is ready and the consumer is within its prefetch limit, or the consumer got cancelled.
+func (b *MemoryBroker) next(c *memoryConsumer) (amqp.Delivery, bool) {
+	b.m.Lock()
+	defer b.m.Unlock()
+	for {
+		if c.cancelled {
+			return amqp.Delivery{}, false
+		}
+		q := c.queue
+		if len(q.ready) > 0 && (c.prefetch <= 0 || c.inFlight < c.prefetch) {
+			d := q.ready[0]
+			q.ready = q.ready[1:]
+			q.tagSeq++
+			d.DeliveryTag = q.tagSeq
+			d.ConsumerTag = c.tag
+			d.Acknowledger = &memoryAcknowledger{broker: b, queue: q}
+			q.unacked[d.DeliveryTag] = &memoryDelivery{delivery: d, consumer: c}
+			c.inFlight++
+			return d, true
+		}
+		b.cond.Wait()
+	}
+}
+
+func (b *MemoryBroker) Publish(config *ChannelConfig, payload string) error {
+	return b.PublishContext(context.Background(), config, payload)
+}
+
+// PublishContext routes the payload to the bound queues. Like RabbitMQ, unroutable messages are dropped.
+func (b *MemoryBroker) PublishContext(ctx context.Context, config *ChannelConfig, payload string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	options := publishOptions(config)
+	if err := b.publish(options, newPublishing(options, payload)); err != nil {
+		return err
+	}
+	if config.stats != nil {
+		config.stats.published()
+	}
+	return nil
+}
+
+func (b *MemoryBroker) publish(options *ExchangeOptions, msg amqp.Publishing) error {
+	b.m.Lock()
+	defer b.m.Unlock()
+	if b.stopped {
+		return ErrNotConnected
+	}
+	return b.route(options.ExchangeName, options.RoutingKey, msg)
+}
+
+func (b *MemoryBroker) route(exchange string, routingKey string, msg amqp.Publishing) error {
+	if exchange == "" {
+		if q, exists := b.queues[routingKey]; exists {
+			b.enqueue(q, exchange, routingKey, msg)
+		}
+		return nil
+	}
+	ex, exists := b.exchanges[exchange]
+	if !exists {
+		return fmt.Errorf("NOT_FOUND - no exchange '%s'", exchange)
+	}
+	routed := make(map[string]bool)
+	for _, binding := range ex.bindings {
+		if routed[binding.queue] || (ex.kind == "direct" && binding.routingKey != routingKey) {
+			continue
+		}
+		if q, exists := b.queues[binding.queue]; exists {
+			routed[binding.queue] = true
+			b.enqueue(q, exchange, routingKey, msg)
+		}
+	}
+	return nil
+}
+
+func (b *MemoryBroker) enqueue(q *memoryQueue, exchange string, routingKey string, msg amqp.Publishing) {
+	q.ready = append(q.ready, amqp.Delivery{
+		Headers:         copyHeaders(msg.Headers),
+		ContentType:     msg.ContentType,
+		ContentEncoding: msg.ContentEncoding,
+		DeliveryMode:    msg.DeliveryMode,
+		Priority:        msg.Priority,
+		CorrelationId:   msg.CorrelationId,
+		ReplyTo:         msg.ReplyTo,
+		Expiration:      msg.Expiration,
+		MessageId:       msg.MessageId,
+		Timestamp:       msg.Timestamp,
+		Type:            msg.Type,
+		UserId:          msg.UserId,
+		AppId:           msg.AppId,
+		Exchange:        exchange,
+		RoutingKey:      routingKey,
+		Body:            msg.Body,
+	})
+	b.cond.Broadcast()
+}
+
+func (b *MemoryBroker) Ack(d *Delivery) error {
+	return d.delivery.Ack(false)
+}
+
+func (b *MemoryBroker) Nack(d *Delivery, requeue bool) error {
+	return d.delivery.Nack(false, requeue)
+}
+
+func (a *memoryAcknowledger) Ack(tag uint64, multiple bool) error {
+	return a.broker.settle(a.queue, tag, multiple, true, false)
+}
+
+func (a *memoryAcknowledger) Nack(tag uint64, multiple bool, requeue bool) error {
+	return a.broker.settle(a.queue, tag, multiple, false, requeue)
+}
+
+func (a *memoryAcknowledger) Reject(tag uint64, requeue bool) error {
+	return a.broker.settle(a.queue, tag, false, false, requeue)
+}
+
+// settle completes the delivery with the given tag. With multiple, all unacknowledged deliveries up to and
+// including the tag are completed, as RabbitMQ does.
+func (b *MemoryBroker) settle(q *memoryQueue, tag uint64, multiple bool, ack bool, requeue bool) error {
+	b.m.Lock()
+	defer b.m.Unlock()
+	if _, exists := q.unacked[tag]; !exists {
+		return fmt.Errorf("PRECONDITION_FAILED - unknown delivery tag %d", tag)
+	}
+	tags := []uint64{tag}
+	if multiple {
+		tags = tags[:0]
+		for pendingTag := range q.unacked {
+			if pendingTag <= tag {
+				tags = append(tags, pendingTag)
+			}
+		}
+		sort.Slice(tags, func(i, j int) bool { return tags[i] < tags[j] })
+	}
+	defer b.cond.Broadcast()
+
+	var requeued []amqp.Delivery
+	for _, pendingTag := range tags {
+		pending := q.unacked[pendingTag]
+		delete(q.unacked, pendingTag)
+		pending.consumer.inFlight--
+		if ack {
+			continue
+		}
+		d := pending.delivery
+		if requeue {
+			d.Redelivered = true
+			requeued = append(requeued, d)
+			continue
+		}
+		if err := b.deadLetterByQueue(q, &d); err != nil {
+			return err
+		}
+	}
+	if len(requeued) > 0 {
+		q.ready = append(requeued, q.ready...)
+	}
+	return nil
+}
+
+// deadLetterByQueue routes a rejected message to the dead-letter exchange of the queue and records it in x-death,
+// as RabbitMQ does. Without dead-letter exchange, the message is dropped.
+func (b *MemoryBroker) deadLetterByQueue(q *memoryQueue, d *amqp.Delivery) error {
+	exchange, ok := q.args["x-dead-letter-exchange"].(string)
+	if !ok {
+		return nil
+	}
+	routingKey := d.RoutingKey
+	if key, ok := q.args["x-dead-letter-routing-key"].(string); ok {
+		routingKey = key
+	}
+
+	headers := copyHeaders(d.Headers)
+	deaths, _ := headers["x-death"].([]interface{})
+	updated := make([]interface{}, 0, len(deaths)+1)
+	death := amqp.Table{
+		"count":        int64(1),
+		"reason":       "rejected",
+		"queue":        q.name,
+		"exchange":     d.Exchange,
+		"routing-keys": []interface{}{d.RoutingKey},
+	}
+	for _, entry := range deaths {
+		table, ok := entry.(amqp.Table)
+		if ok && table["queue"] == q.name && table["reason"] == "rejected" {
+			death["count"] = toInt64(table["count"]) + 1
+			continue
+		}
+		updated = append(updated, entry)
+	}
+	headers["x-death"] = append([]interface{}{death}, updated...)
+
+	msg := republishing(d, headers)
+	msg.DeliveryMode = d.DeliveryMode
+	return b.route(exchange, routingKey, msg)
+}
+
+func (b *MemoryBroker) EnableDeadLetters(o *DeadLetterOptions) *ChannelConfig {
+	b.deadLetters = newDeadLetterer(o, b.publish)
+	return b.deadLetters.config
+}
+
+func (b *MemoryBroker) DeadLetter(d *Delivery, reason error) error {
+	return b.deadLetters.deadLetter(d, reason)
+}
+
+func (b *MemoryBroker) Requeue(d *Delivery, reason error) error {
+	return b.deadLetters.requeue(d, reason)
+}
+
+func (b *MemoryBroker) PeekDeadLetters(limit int) ([]DeadLetterMessage, error) {
+	b.m.Lock()
+	defer b.m.Unlock()
+	q, err := b.deadLetterQueue()
+	if err != nil {
+		return nil, err
+	}
+	messages := make([]DeadLetterMessage, 0)
+	for i := 0; i < len(q.ready) && len(messages) < limit; i++ {
+		messages = append(messages, newDeadLetterMessage(&q.ready[i]))
+	}
+	return messages, nil
+}
+
+func (b *MemoryBroker) ReplayDeadLetter(ctx context.Context, id string, edit Editor) error {
+	return b.withDeadLetter(id, func(message *DeadLetterMessage) error {
+		b.m.Lock()
+		options, err := replayTarget(b.channels, message)
+		if err == nil && options.ExchangeName == "" {
+			if _, exists := b.queues[options.RoutingKey]; !exists {
+				err = ErrUnknownQueue
+			}
+		}
+		b.m.Unlock()
+		if err != nil {
+			return err
+		}
+		payload, err := edit(message)
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return b.publish(options, newReplayPublishing(options, message, payload))
+	})
+}
+
+func (b *MemoryBroker) DropDeadLetter(id string) error {
+	return b.withDeadLetter(id, func(message *DeadLetterMessage) error {
+		return nil
+	})
+}
+
+// withDeadLetter takes the message out of the queue while fn runs and puts it back if fn fails.
+func (b *MemoryBroker) withDeadLetter(id string, fn func(message *DeadLetterMessage) error) error {
+	b.m.Lock()
+	q, err := b.deadLetterQueue()
+	if err != nil {
+		b.m.Unlock()
+		return err
+	}
+	index := -1
+	for i := range q.ready {
+		if deadLetterID(&q.ready[i]) == id {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		b.m.Unlock()
+		return ErrDeadLetterNotFound
+	}
+	d := q.ready[index]
+	q.ready = append(q.ready[:index:index], q.ready[index+1:]...)
+	b.m.Unlock()
+
+	message := newDeadLetterMessage(&d)
+	if err := fn(&message); err != nil {
+		b.m.Lock()
+		q.ready = append([]amqp.Delivery{d}, q.ready...)
+		b.m.Unlock()
+		return err
+	}
+	return nil
+}
+
+func (b *MemoryBroker) deadLetterQueue() (*memoryQueue, error) {
+	if b.deadLetters == nil {
+		return nil, ErrDeadLettersDisabled
+	}
+	if b.stopped {
+		return nil, ErrNotConnected
+	}
+	q, exists := b.queues[b.deadLetters.options.QueueName]
+	if !exists {
+		return &memoryQueue{}, nil
+	}
+	return q, nil
+}
+
+func (b *MemoryBroker) Status() ServiceStatus {
+	b.m.Lock()
+	connected := !b.stopped
+	channels := make([]*ChannelConfig, len(b.channels))
+	copy(channels, b.channels)
+	b.m.Unlock()
+	return newServiceStatus(connected, channels)
+}
+
+// Stop cancels all consumers and waits until the deliveries in flight have been handled or ctx is done.
+func (b *MemoryBroker) Stop(ctx context.Context) error {
+	b.m.Lock()
+	b.stopped = true
+	for _, c := range b.subscribers {
+		c.cancelled = true
+	}
+	b.cond.Broadcast()
+	b.m.Unlock()
+	b.consumers.stop()
+
+	select {
+	case <-b.consumers.drained():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// QueueLength returns the number of messages that are ready for delivery in the given queue.
+func (b *MemoryBroker) QueueLength(queue string) int {
+	b.m.Lock()
+	defer b.m.Unlock()
+	if q, exists := b.queues[queue]; exists {
+		return len(q.ready)
+	}
+	return 0
+}
@@ -0,0 +1,508 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func newExchangeConfig(name string, exchangeName string, exchangeType string) *ChannelConfig {
+	exchange := NewExchangeOptions()
+	exchange.ExchangeName = exchangeName
+	exchange.ExchangeType = exchangeType
+	return &ChannelConfig{Name: name, ExchangeOptions: exchange}
+}
+
+func newQueueConfig(name string, queueName string, exchangeName string, routingKey string) *ChannelConfig {
+	config := newExchangeConfig(name, exchangeName, "fanout")
+	config.ExchangeOptions.RoutingKey = routingKey
+	config.QueueOptions = &QueueOptions{QueueName: queueName}
+	return config
+}
+
+func receive(t *testing.T, deliveries <-chan *Delivery) *Delivery {
+	select {
+	case d := <-deliveries:
+		return d
+	case <-time.After(time.Second):
+		require.FailNow(t, "no message received")
+		return nil
+	}
+}
+
+func assertNothingReceived(t *testing.T, deliveries <-chan *Delivery) {
+	select {
+	case d := <-deliveries:
+		assert.Fail(t, "unexpected message", string(d.Body))
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func subscribe(t *testing.T, b *MemoryBroker, config *ChannelConfig) <-chan *Delivery {
+	deliveries := make(chan *Delivery, 10)
+	require.NoError(t, b.Subscribe(config, func(d *Delivery) {
+		deliveries <- d
+	}))
+	return deliveries
+}
+
+func TestMemoryBroker_ShouldRouteFanout(t *testing.T) {
+	b := NewMemoryBroker()
+	defer b.Stop(context.Background())
+	first := subscribe(t, b, newQueueConfig("first", "", "events", ""))
+	second := subscribe(t, b, newQueueConfig("second", "", "events", ""))
+
+	require.NoError(t, b.Publish(newExchangeConfig("publisher", "events", "fanout"), "payload"))
+
+	assert.Equal(t, "payload", string(receive(t, first).Body))
+	assert.Equal(t, "payload", string(receive(t, second).Body))
+}
+
+func TestMemoryBroker_ShouldRouteDirect(t *testing.T) {
+	b := NewMemoryBroker()
+	defer b.Stop(context.Background())
+	red := newQueueConfig("red", "red", "colors", "red")
+	red.ExchangeOptions.ExchangeType = "direct"
+	blue := newQueueConfig("blue", "blue", "colors", "blue")
+	blue.ExchangeOptions.ExchangeType = "direct"
+	redDeliveries := subscribe(t, b, red)
+	blueDeliveries := subscribe(t, b, blue)
+
+	publisher := newExchangeConfig("publisher", "colors", "direct")
+	publisher.ExchangeOptions.RoutingKey = "blue"
+	require.NoError(t, b.Publish(publisher, "payload"))
+
+	assert.Equal(t, "blue", receive(t, blueDeliveries).RoutingKey)
+	assertNothingReceived(t, redDeliveries)
+}
+
+func TestMemoryBroker_ShouldRouteDefaultExchangeByQueueName(t *testing.T) {
+	b := NewMemoryBroker()
+	defer b.Stop(context.Background())
+	deliveries := subscribe(t, b, &ChannelConfig{Name: "direct", QueueOptions: &QueueOptions{QueueName: "work"}})
+
+	require.NoError(t, b.Publish(&ChannelConfig{QueueOptions: &QueueOptions{QueueName: "work"}}, "payload"))
+
+	d := receive(t, deliveries)
+	assert.Equal(t, "", d.Exchange)
+	assert.Equal(t, "work", d.Queue)
+}
+
+func TestMemoryBroker_ShouldRejectUnknownExchange(t *testing.T) {
+	b := NewMemoryBroker()
+	defer b.Stop(context.Background())
+
+	assert.Error(t, b.Publish(newExchangeConfig("publisher", "unknown", "fanout"), "payload"))
+	assert.Error(t, b.Declare(newExchangeConfig("topic", "topic", "topic")))
+}
+
+func TestMemoryBroker_ShouldRespectPrefetch(t *testing.T) {
+	b := NewMemoryBroker()
+	defer b.Stop(context.Background())
+	config := newQueueConfig("work", "work", "work", "")
+	config.QosOptions = &QosOptions{PrefetchCount: 1}
+	deliveries := subscribe(t, b, config)
+
+	require.NoError(t, b.Publish(config, "first"))
+	require.NoError(t, b.Publish(config, "second"))
+
+	first := receive(t, deliveries)
+	assertNothingReceived(t, deliveries)
+	require.NoError(t, b.Ack(first))
+	assert.Equal(t, "second", string(receive(t, deliveries).Body))
+}
+
+func TestMemoryBroker_ShouldRequeueAtHead(t *testing.T) {
+	b := NewMemoryBroker()
+	defer b.Stop(context.Background())
+	config := newQueueConfig("work", "work", "work", "")
+	config.QosOptions = &QosOptions{PrefetchCount: 1}
+	deliveries := subscribe(t, b, config)
+
+	require.NoError(t, b.Publish(config, "first"))
+	require.NoError(t, b.Publish(config, "second"))
+
+	first := receive(t, deliveries)
+	assert.False(t, first.Redelivered)
+	require.NoError(t, b.Nack(first, true))
+
+	redelivered := receive(t, deliveries)
+	assert.Equal(t, "first", string(redelivered.Body))
+	assert.True(t, redelivered.Redelivered)
+	assert.Error(t, b.Ack(first), "delivery tag has already been settled")
+}
+
+func TestMemoryBroker_ShouldDeadLetterRejectedMessagesWithXDeath(t *testing.T) {
+	b := NewMemoryBroker()
+	defer b.Stop(context.Background())
+	b.Start(newQueueConfig("parking", "parking", "parking", ""))
+	config := newQueueConfig("work", "work", "work", "")
+	config.QueueOptions.Args = amqp.Table{"x-dead-letter-exchange": "parking"}
+	deliveries := subscribe(t, b, config)
+
+	require.NoError(t, b.Publish(config, "payload"))
+	require.NoError(t, b.Nack(receive(t, deliveries), false))
+
+	assert.Equal(t, 1, b.QueueLength("parking"))
+	assert.Equal(t, 0, b.QueueLength("work"))
+}
+
+func TestMemoryBroker_DeadLetter_ShouldFallBackToQueueDeadLetterExchange(t *testing.T) {
+	b := NewMemoryBroker()
+	defer b.Stop(context.Background())
+	// The dead-letter exchange of the gateway is not declared, so publishing to it fails.
+	b.EnableDeadLetters(NewDeadLetterOptions())
+	b.Start(newQueueConfig("parking", "parking", "parking", ""))
+	config := newQueueConfig("work", "work", "work", "")
+	config.QueueOptions.Args = amqp.Table{"x-dead-letter-exchange": "parking"}
+	deliveries := subscribe(t, b, config)
+
+	require.NoError(t, b.Publish(config, "payload"))
+	assert.Error(t, b.DeadLetter(receive(t, deliveries), errors.New("invalid")))
+
+	assertNothingReceived(t, deliveries)
+	assert.Equal(t, 1, b.QueueLength("parking"))
+}
+
+func TestMemoryBroker_ShouldRequeueUntilMaxAttempts(t *testing.T) {
+	b := NewMemoryBroker()
+	defer b.Stop(context.Background())
+	options := NewDeadLetterOptions()
+	options.MaxAttempts = 3
+	b.Start(b.EnableDeadLetters(options))
+	config := newQueueConfig("work", "work", "work", "")
+	deliveries := subscribe(t, b, config)
+
+	require.NoError(t, b.Publish(config, "payload"))
+	for attempt := 1; attempt <= 3; attempt++ {
+		d := receive(t, deliveries)
+		assert.Equal(t, attempt, Attempts(d))
+		require.NoError(t, b.Requeue(d, errors.New("failed")))
+	}
+	assertNothingReceived(t, deliveries)
+
+	messages, err := b.PeekDeadLetters(10)
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+	assert.Equal(t, "work", messages[0].Exchange)
+	assert.Equal(t, "work", messages[0].Queue)
+	assert.Contains(t, messages[0].Error, "giving up after 3 attempts")
+}
+
+func TestMemoryBroker_ShouldReplayAndDropDeadLetters(t *testing.T) {
+	b := NewMemoryBroker()
+	defer b.Stop(context.Background())
+	b.Start(b.EnableDeadLetters(NewDeadLetterOptions()))
+	config := newQueueConfig("work", "work", "work", "")
+	deliveries := subscribe(t, b, config)
+
+	require.NoError(t, b.Publish(config, "first"))
+	require.NoError(t, b.DeadLetter(receive(t, deliveries), errors.New("invalid")))
+	require.NoError(t, b.Publish(config, "second"))
+	require.NoError(t, b.DeadLetter(receive(t, deliveries), errors.New("invalid")))
+
+	messages, err := b.PeekDeadLetters(10)
+	require.NoError(t, err)
+	require.Len(t, messages, 2)
+
+	editErr := errors.New("still invalid")
+	assert.Equal(t, editErr, b.ReplayDeadLetter(context.Background(), messages[0].ID, func(message *DeadLetterMessage) (string, error) {
+		return "", editErr
+	}))
+	assert.Equal(t, 2, b.QueueLength("dead-letters"), "message should be kept if the replay fails")
+
+	require.NoError(t, b.ReplayDeadLetter(context.Background(), messages[0].ID, func(message *DeadLetterMessage) (string, error) {
+		return "edited", nil
+	}))
+	replayed := receive(t, deliveries)
+	assert.Equal(t, "edited", string(replayed.Body))
+	assert.Nil(t, replayed.Headers[HeaderError])
+
+	require.NoError(t, b.DropDeadLetter(messages[1].ID))
+	assert.Equal(t, 0, b.QueueLength("dead-letters"))
+	assert.Equal(t, ErrDeadLetterNotFound, b.DropDeadLetter(messages[1].ID))
+}
+
+func TestMemoryBroker_ReplayDeadLetter_ShouldKeepHeaders(t *testing.T) {
+	b := NewMemoryBroker()
+	defer b.Stop(context.Background())
+	b.Start(b.EnableDeadLetters(NewDeadLetterOptions()))
+	config := newQueueConfig("work", "work", "work", "")
+	deliveries := subscribe(t, b, config)
+
+	require.NoError(t, b.publish(config.ExchangeOptions, amqp.Publishing{
+		Body: []byte("payload"),
+		Headers: amqp.Table{
+			"x-clustercode-schema-version": "1",
+			"x-death":                      []interface{}{amqp.Table{"count": int64(1)}},
+		},
+	}))
+	require.NoError(t, b.Requeue(receive(t, deliveries), errors.New("failed")))
+	require.NoError(t, b.DeadLetter(receive(t, deliveries), errors.New("invalid")))
+	messages, err := b.PeekDeadLetters(1)
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+
+	require.NoError(t, b.ReplayDeadLetter(context.Background(), messages[0].ID, func(message *DeadLetterMessage) (string, error) {
+		return message.Body, nil
+	}))
+
+	replayed := receive(t, deliveries)
+	assert.Equal(t, "1", replayed.Headers["x-clustercode-schema-version"])
+	assert.Equal(t, "work", replayed.Headers[HeaderOriginalQueue])
+	for _, header := range []string{"x-death", HeaderRedeliveries, HeaderError, HeaderDeadLetterID} {
+		assert.NotContains(t, replayed.Headers, header)
+	}
+	assert.Equal(t, 1, Attempts(replayed))
+}
+
+func TestMemoryBroker_ReplayDeadLetter_ShouldNotDuplicateToOtherQueues(t *testing.T) {
+	b := NewMemoryBroker()
+	defer b.Stop(context.Background())
+	b.Start(b.EnableDeadLetters(NewDeadLetterOptions()))
+	work := subscribe(t, b, newQueueConfig("work", "work", "events", ""))
+	observer := subscribe(t, b, newQueueConfig("observer", "", "events", ""))
+
+	require.NoError(t, b.Publish(newExchangeConfig("publisher", "events", "fanout"), "payload"))
+	receive(t, work)
+	require.NoError(t, b.DeadLetter(receive(t, observer), errors.New("invalid")))
+	messages, err := b.PeekDeadLetters(10)
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+
+	require.NoError(t, b.ReplayDeadLetter(context.Background(), messages[0].ID, func(message *DeadLetterMessage) (string, error) {
+		return message.Body, nil
+	}))
+
+	assert.Equal(t, "payload", string(receive(t, observer).Body))
+	assertNothingReceived(t, work)
+}
+
+func TestMemoryBroker_ReplayDeadLetter_ShouldKeepMessage(t *testing.T) {
+	tests := []struct {
+		name          string
+		originalQueue string
+		ctx           func() context.Context
+		expectedErr   error
+	}{
+		{
+			name:          "QueueIsGone",
+			originalQueue: "amq.gen-restarted",
+			ctx:           context.Background,
+			expectedErr:   ErrUnknownQueue,
+		},
+		{
+			name:          "ContextIsDone",
+			originalQueue: "work",
+			ctx: func() context.Context {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				return ctx
+			},
+			expectedErr: context.Canceled,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewMemoryBroker()
+			defer b.Stop(context.Background())
+			options := NewDeadLetterOptions()
+			b.Start(b.EnableDeadLetters(options))
+			subscribe(t, b, newQueueConfig("work", "work", "work", ""))
+			exchange := NewExchangeOptions()
+			exchange.ExchangeName = options.ExchangeName
+			require.NoError(t, b.publish(exchange, amqp.Publishing{
+				Headers: amqp.Table{
+					HeaderDeadLetterID:     "abc",
+					HeaderOriginalExchange: "work",
+					HeaderOriginalQueue:    tt.originalQueue,
+				},
+				Body: []byte("payload"),
+			}))
+
+			err := b.ReplayDeadLetter(tt.ctx(), "abc", func(message *DeadLetterMessage) (string, error) {
+				return message.Body, nil
+			})
+
+			assert.Equal(t, tt.expectedErr, err)
+			assert.Equal(t, 1, b.QueueLength(options.QueueName))
+		})
+	}
+}
+
+func TestMemoryBroker_Stop_ShouldWaitForDeliveriesInFlight(t *testing.T) {
+	b := NewMemoryBroker()
+	config := newQueueConfig("work", "work", "work", "")
+	handled := make(chan struct{})
+	require.NoError(t, b.Subscribe(config, func(d *Delivery) {
+		time.Sleep(20 * time.Millisecond)
+		b.Ack(d)
+		close(handled)
+	}))
+	require.NoError(t, b.Publish(config, "payload"))
+	time.Sleep(5 * time.Millisecond)
+
+	require.NoError(t, b.Stop(context.Background()))
+
+	select {
+	case <-handled:
+	default:
+		assert.Fail(t, "Stop returned before the delivery was handled")
+	}
+	assert.Equal(t, ErrNotConnected, b.Publish(config, "payload"))
+	assert.False(t, b.Status().Connected)
+}
+
+func TestMemoryBroker_ShouldBoundConcurrencyByPrefetch(t *testing.T) {
+	b := NewMemoryBroker()
+	defer b.Stop(context.Background())
+	config := newQueueConfig("work", "work", "work", "")
+	config.Concurrency = 3
+	config.QosOptions = &QosOptions{PrefetchCount: 2}
+	started := make(chan *Delivery, 10)
+	release := make(chan struct{})
+	require.NoError(t, b.Subscribe(config, func(d *Delivery) {
+		started <- d
+		<-release
+		b.Ack(d)
+	}))
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, b.Publish(config, "payload"))
+	}
+
+	receive(t, started)
+	receive(t, started)
+	assertNothingReceived(t, started)
+	close(release)
+	receive(t, started)
+}
+
+type detailedTestError struct{}
+
+func (detailedTestError) Error() string {
+	return "invalid"
+}
+
+func (detailedTestError) Details() interface{} {
+	return []string{"first", "second"}
+}
+
+func TestMemoryBroker_ShouldRecordErrorDetails(t *testing.T) {
+	b := NewMemoryBroker()
+	defer b.Stop(context.Background())
+	b.Start(b.EnableDeadLetters(NewDeadLetterOptions()))
+	config := newQueueConfig("work", "work", "work", "")
+	deliveries := subscribe(t, b, config)
+
+	require.NoError(t, b.Publish(config, "payload"))
+	require.NoError(t, b.DeadLetter(receive(t, deliveries), detailedTestError{}))
+
+	messages, err := b.PeekDeadLetters(10)
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+	assert.Equal(t, "invalid", messages[0].Error)
+	assert.JSONEq(t, `["first","second"]`, string(messages[0].ErrorDetails))
+}
+
+func TestMemoryBroker_ShouldNotDuplicateConsumersWhenDeclaredAgain(t *testing.T) {
+	b := NewMemoryBroker()
+	defer b.Stop(context.Background())
+	config := newQueueConfig("work", "work", "work", "")
+	config.QosOptions = &QosOptions{PrefetchCount: 1}
+	deliveries := subscribe(t, b, config)
+	require.NoError(t, b.Declare(config))
+	b.Start(config)
+
+	require.NoError(t, b.Publish(config, "first"))
+	require.NoError(t, b.Publish(config, "second"))
+
+	d := receive(t, deliveries)
+	assert.Equal(t, "first", string(d.Body))
+	assertNothingReceived(t, deliveries)
+	require.NoError(t, b.Ack(d))
+	assert.Equal(t, "second", string(receive(t, deliveries).Body))
+}
+
+func TestMemoryBroker_ShouldReuseGeneratedQueueWhenDeclaredAgain(t *testing.T) {
+	b := NewMemoryBroker()
+	defer b.Stop(context.Background())
+	config := newQueueConfig("observer", "", "events", "")
+	deliveries := subscribe(t, b, config)
+	require.NoError(t, b.Declare(config))
+	b.Start(config)
+
+	require.NoError(t, b.Publish(config, "payload"))
+
+	d := receive(t, deliveries)
+	assert.Equal(t, "amq.gen-1", d.Queue)
+	assertNothingReceived(t, deliveries)
+	assert.Len(t, b.queues, 1)
+	assert.Len(t, b.exchanges["events"].bindings, 1)
+}
+
+func TestMemoryBroker_ShouldSettleMultipleDeliveries(t *testing.T) {
+	tests := []struct {
+		name          string
+		settle        func(d *Delivery) error
+		expectedReady []string
+	}{
+		{
+			name: "Ack",
+			settle: func(d *Delivery) error {
+				return d.delivery.Ack(true)
+			},
+			expectedReady: []string{"third"},
+		},
+		{
+			name: "NackWithRequeue",
+			settle: func(d *Delivery) error {
+				return d.delivery.Nack(true, true)
+			},
+			expectedReady: []string{"first", "second", "third"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewMemoryBroker()
+			config := newQueueConfig("work", "work", "work", "")
+			config.Concurrency = 2
+			deliveries := subscribe(t, b, config)
+			for _, payload := range []string{"first", "second", "third"} {
+				require.NoError(t, b.Publish(config, payload))
+			}
+			receive(t, deliveries)
+			second := receive(t, deliveries)
+			assertNothingReceived(t, deliveries)
+
+			require.NoError(t, b.Stop(context.Background()))
+			require.NoError(t, tt.settle(second))
+
+			b.m.Lock()
+			defer b.m.Unlock()
+			q := b.queues["work"]
+			assert.Empty(t, q.unacked)
+			ready := make([]string, 0)
+			for _, d := range q.ready {
+				ready = append(ready, string(d.Body))
+			}
+			assert.Equal(t, tt.expectedReady, ready)
+		})
+	}
+}
+
+func TestMemoryBroker_ShouldRefuseConsumersOnceStopped(t *testing.T) {
+	b := NewMemoryBroker()
+	require.NoError(t, b.Stop(context.Background()))
+
+	err := b.Subscribe(newQueueConfig("work", "work", "work", ""), func(d *Delivery) {})
+
+	assert.Equal(t, ErrNotConnected, err)
+	b.m.Lock()
+	defer b.m.Unlock()
+	assert.Empty(t, b.subscribers)
+}
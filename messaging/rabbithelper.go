@@ -1,36 +1,87 @@
 package messaging
 
 import (
+	"errors"
+	"fmt"
 	log "github.com/sirupsen/logrus"
 	"github.com/streadway/amqp"
+	"sync"
 )
 
-func (s *RabbitMqService) createChannelOrFail() *amqp.Channel {
-	if channel, err := s.tryCreateChannel(); err == nil {
-		return channel
-	} else {
-		log.WithFields(log.Fields{
-			"error": err,
-		}).Fatal("failed to open channel")
-		return channel
+var ErrStopping = errors.New("consumers are being stopped, no new consumer can be started")
+
+type (
+	// consumerGroup tracks the workers of all consumers. Once stopping, no workers can be added anymore, so that
+	// waiting for the group does not race with a reconnect or channel recovery starting new consumers.
+	consumerGroup struct {
+		m        *sync.Mutex
+		wg       *sync.WaitGroup
+		stopping bool
+	}
+)
+
+func newConsumerGroup() *consumerGroup {
+	return &consumerGroup{
+		m:  &sync.Mutex{},
+		wg: &sync.WaitGroup{},
+	}
+}
+
+// add reserves the given number of workers. Returns false if the group is stopping.
+func (g *consumerGroup) add(workers int) bool {
+	g.m.Lock()
+	defer g.m.Unlock()
+	if g.stopping {
+		return false
+	}
+	g.wg.Add(workers)
+	return true
+}
+
+func (g *consumerGroup) done() {
+	g.wg.Done()
+}
+
+// stop refuses new workers from now on.
+func (g *consumerGroup) stop() {
+	g.m.Lock()
+	defer g.m.Unlock()
+	g.stopping = true
+}
+
+// drained returns a channel that is closed once all workers are done. Only valid after stop.
+func (g *consumerGroup) drained() <-chan struct{} {
+	drained := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(drained)
+	}()
+	return drained
+}
+
+func (s *RabbitMqService) createChannel() (*amqp.Channel, error) {
+	channel, err := s.tryCreateChannel()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open channel: %s", err)
 	}
+	return channel, nil
 }
 
 func (s *RabbitMqService) tryCreateChannel() (*amqp.Channel, error) {
 	log.Debugf("opening a new channel")
-	return s.getConnection().Channel()
+	conn := s.getConnection()
+	if conn == nil {
+		return nil, ErrNotConnected
+	}
+	return conn.Channel()
 }
 
-func createQueueOrFail(o *QueueOptions, channel *amqp.Channel) amqp.Queue {
-	if q, err := tryCreateQueue(o, channel); err == nil {
-		return q
-	} else {
-		log.WithFields(log.Fields{
-			"queue_name": o.QueueName,
-			"error":      err,
-		}).Fatal("failed to create queue")
-		return q
+func createQueue(o *QueueOptions, channel *amqp.Channel) (amqp.Queue, error) {
+	q, err := tryCreateQueue(o, channel)
+	if err != nil {
+		return q, fmt.Errorf("failed to create queue '%s': %s", o.QueueName, err)
 	}
+	return q, nil
 }
 
 func tryCreateQueue(o *QueueOptions, channel *amqp.Channel) (amqp.Queue, error) {
@@ -45,13 +96,11 @@ func tryCreateQueue(o *QueueOptions, channel *amqp.Channel) (amqp.Queue, error)
 	)
 }
 
-func createExchangeOrFail(o *ExchangeOptions, channel *amqp.Channel) {
+func createExchange(o *ExchangeOptions, channel *amqp.Channel) error {
 	if err := tryCreateExchange(o, channel); err != nil {
-		log.WithFields(log.Fields{
-			"exchange_name": o.ExchangeName,
-			"error":         err,
-		}).Fatal("failed to create exchange")
+		return fmt.Errorf("failed to create exchange '%s': %s", o.ExchangeName, err)
 	}
+	return nil
 }
 
 func tryCreateExchange(o *ExchangeOptions, channel *amqp.Channel) error {
@@ -66,7 +115,7 @@ func tryCreateExchange(o *ExchangeOptions, channel *amqp.Channel) error {
 		o.Args)
 }
 
-func bindToExchange(o *ExchangeOptions, channel *amqp.Channel) {
+func bindToExchange(o *ExchangeOptions, channel *amqp.Channel) error {
 	log.WithFields(log.Fields{
 		"queue_name":    o.QueueName,
 		"exchange_name": o.ExchangeName,
@@ -80,24 +129,30 @@ func bindToExchange(o *ExchangeOptions, channel *amqp.Channel) {
 		o.Args)
 
 	if err != nil {
-		log.WithFields(log.Fields{
-			"queue_name":    o.QueueName,
-			"exchange_name": o.ExchangeName,
-			"error":         err,
-		}).Fatal("failed to bind queue")
+		return fmt.Errorf("failed to bind queue '%s' to exchange '%s': %s", o.QueueName, o.ExchangeName, err)
 	}
+	return nil
 }
 
-func createConsumerOrFail(o *QueueOptions, channel *amqp.Channel) <-chan amqp.Delivery {
-	if msgs, err := tryCreateConsumer(o, channel); err == nil {
-		return msgs
-	} else {
-		log.WithFields(log.Fields{
-			"queue_name": o.QueueName,
-			"error":      err,
-		}).Fatal("failed to consume queue")
-		return msgs
+func bindQueue(queueName string, o *BindingOptions, channel *amqp.Channel) error {
+	log.WithFields(log.Fields{
+		"queue_name":    queueName,
+		"exchange_name": o.ExchangeName,
+		"routing_key":   o.RoutingKey,
+	}).Debug("binding queue to exchange")
+
+	if err := channel.QueueBind(queueName, o.RoutingKey, o.ExchangeName, o.NoWait, o.Args); err != nil {
+		return fmt.Errorf("failed to bind queue '%s' to exchange '%s': %s", queueName, o.ExchangeName, err)
 	}
+	return nil
+}
+
+func createConsumer(o *QueueOptions, channel *amqp.Channel) (<-chan amqp.Delivery, error) {
+	msgs, err := tryCreateConsumer(o, channel)
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume queue '%s': %s", o.QueueName, err)
+	}
+	return msgs, nil
 }
 
 func tryCreateConsumer(o *QueueOptions, channel *amqp.Channel) (<-chan amqp.Delivery, error) {
@@ -112,7 +167,7 @@ func tryCreateConsumer(o *QueueOptions, channel *amqp.Channel) (<-chan amqp.Deli
 	)
 }
 
-func setQos(o *QosOptions, channel *amqp.Channel) {
+func setQos(o *QosOptions, channel *amqp.Channel) error {
 	global := false
 	err := channel.Qos(
 		o.PrefetchCount,
@@ -120,53 +175,129 @@ func setQos(o *QosOptions, channel *amqp.Channel) {
 		global,
 	)
 	if err != nil {
-		log.WithField("error", err).Fatal("failed to set QoS")
+		return fmt.Errorf("failed to set QoS: %s", err)
 	}
+	return nil
 }
 
-func beginConsuming(msgs <-chan amqp.Delivery, callback messageReceivedCallback) {
-	go func(msgs <-chan amqp.Delivery) {
-		for msg := range msgs {
-			log.WithFields(log.Fields{
-				"routing_key": msg.RoutingKey,
-				"correlation_id": msg.CorrelationId,
-				"reply_to": msg.ReplyTo,
-				"consumer_tag": msg.ConsumerTag,
-			}).Debug("received message")
-			callback(&msg)
-		}
-	}(msgs)
+// Deliveries are fanned out to the given number of workers. They are acknowledged individually, so the order in
+// which the workers complete them does not matter.
+// The workers are done once the consumer got cancelled and all deliveries have been handled. Returns ErrStopping
+// without starting any worker if the group is stopping.
+func beginConsuming(group *consumerGroup, msgs <-chan amqp.Delivery, workers int, callback messageReceivedCallback) error {
+	if !group.add(workers) {
+		return ErrStopping
+	}
+	for i := 0; i < workers; i++ {
+		go func(msgs <-chan amqp.Delivery) {
+			defer group.done()
+			for msg := range msgs {
+				log.WithFields(log.Fields{
+					"routing_key":    msg.RoutingKey,
+					"correlation_id": msg.CorrelationId,
+					"reply_to":       msg.ReplyTo,
+					"consumer_tag":   msg.ConsumerTag,
+				}).Debug("received message")
+				callback(&msg)
+			}
+		}(msgs)
+	}
+	return nil
 }
 
-func publishOnChannel(options *ExchangeOptions, channel *amqp.Channel, payload string) error {
+// workerCount returns the configured concurrency, bounded by the prefetch count so that no worker idles.
+func workerCount(config *ChannelConfig) int {
+	n := config.Concurrency
+	if n < 1 {
+		n = 1
+	}
+	if prefetch := prefetchCount(config); prefetch > 0 && n > prefetch {
+		n = prefetch
+	}
+	return n
+}
+
+// prefetchCount returns the configured prefetch count. Without one, concurrent consumers are limited to one
+// unacknowledged delivery per worker, otherwise the broker would push the whole queue into memory.
+func prefetchCount(config *ChannelConfig) int {
+	if config.QosOptions != nil && config.QosOptions.PrefetchCount > 0 {
+		return config.QosOptions.PrefetchCount
+	}
+	if config.Concurrency > 1 {
+		return config.Concurrency
+	}
+	return 0
+}
+
+func publishMessage(options *ExchangeOptions, channel *amqp.Channel, msg amqp.Publishing) error {
 	return channel.Publish(
 		options.ExchangeName,
 		options.RoutingKey,
 		options.Mandatory,
 		options.Immediate,
-		amqp.Publishing{
-			DeliveryMode: amqp.Persistent,
-			ContentType:  "application/xml",
-			Body:         []byte(payload),
-		})
+		msg)
 }
 
-var defaultChannelInitializer = func(config *ChannelConfig, ch *amqp.Channel) {
-	log.Debug("initializing channel")
+func newPublishing(options *ExchangeOptions, payload string) amqp.Publishing {
+	msg := amqp.Publishing{
+		DeliveryMode:  options.DeliveryMode,
+		ContentType:   options.ContentType,
+		CorrelationId: options.CorrelationId,
+		Body:          []byte(payload),
+	}
+	if msg.DeliveryMode == 0 {
+		msg.DeliveryMode = amqp.Persistent
+	}
+	if msg.ContentType == "" {
+		msg.ContentType = "application/xml"
+	}
+	return msg
+}
+
+var defaultChannelInitializer = func(config *ChannelConfig, ch *amqp.Channel) error {
+	log.WithField("channel", config.Name).Debug("initializing channel")
+
+	if config.QueueOptions == nil {
+		// Publishing only, there is nothing to bind or consume.
+		if config.ExchangeOptions == nil {
+			return nil
+		}
+		exOptions := *config.ExchangeOptions
+		return createExchange(&exOptions, ch)
+	}
 
 	qOptions := *config.QueueOptions
 	consumer := config.Consumer
 
-	q := createQueueOrFail(&qOptions, ch)
+	q, err := createQueue(&qOptions, ch)
+	if err != nil {
+		return err
+	}
 
-	if qos := config.QosOptions; qos != nil {
-		setQos(qos, ch)
+	if qos := config.QosOptions; qos != nil || config.Concurrency > 1 {
+		qosOptions := QosOptions{PrefetchCount: prefetchCount(config)}
+		if qos != nil {
+			qosOptions.PrefetchSize = qos.PrefetchSize
+		}
+		if err := setQos(&qosOptions, ch); err != nil {
+			return err
+		}
 	}
 
 	if config.ExchangeOptions != nil {
 		exOptions := *config.ExchangeOptions
-		createExchangeOrFail(&exOptions, ch)
-		bindToExchange(&exOptions, ch)
+		if err := createExchange(&exOptions, ch); err != nil {
+			return err
+		}
+		if err := bindToExchange(&exOptions, ch); err != nil {
+			return err
+		}
+	}
+
+	for _, binding := range config.Bindings {
+		if err := bindQueue(q.Name, binding, ch); err != nil {
+			return err
+		}
 	}
 
 	qOptions.QueueName = q.Name
@@ -175,11 +306,20 @@ var defaultChannelInitializer = func(config *ChannelConfig, ch *amqp.Channel) {
 
 		qOptions.ConsumerName = q.Name
 
-		msgs := createConsumerOrFail(&qOptions, ch)
+		msgs, err := createConsumer(&qOptions, ch)
+		if err != nil {
+			return err
+		}
+		config.consumerTag = qOptions.ConsumerName
 
-		beginConsuming(msgs, func(d *amqp.Delivery) {
-			config.Consumer(d)
+		err = beginConsuming(config.consumers, msgs, workerCount(config), func(d *amqp.Delivery) {
+			config.stats.consumed()
+			config.Consumer(newDelivery(q.Name, d))
 		})
+		if err != nil {
+			return err
+		}
 	}
 
+	return nil
 }
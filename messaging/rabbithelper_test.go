@@ -0,0 +1,108 @@
+package messaging
+
+import (
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWorkerCount(t *testing.T) {
+	tests := []struct {
+		name             string
+		concurrency      int
+		qos              *QosOptions
+		expectedWorkers  int
+		expectedPrefetch int
+	}{
+		{"Default", 0, nil, 1, 0},
+		{"WithoutPrefetch", 4, nil, 4, 4},
+		{"BoundedByPrefetch", 4, &QosOptions{PrefetchCount: 2}, 2, 2},
+		{"BelowPrefetch", 2, &QosOptions{PrefetchCount: 10}, 2, 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &ChannelConfig{Concurrency: tt.concurrency, QosOptions: tt.qos}
+			assert.Equal(t, tt.expectedWorkers, workerCount(config))
+			assert.Equal(t, tt.expectedPrefetch, prefetchCount(config))
+		})
+	}
+}
+
+func TestBeginConsuming_ShouldHandleDeliveriesConcurrently(t *testing.T) {
+	msgs := make(chan amqp.Delivery, 10)
+	group := newConsumerGroup()
+	var running, maxRunning, handled int32
+	err := beginConsuming(group, msgs, 3, func(d *amqp.Delivery) {
+		current := atomic.AddInt32(&running, 1)
+		for {
+			max := atomic.LoadInt32(&maxRunning)
+			if current <= max || atomic.CompareAndSwapInt32(&maxRunning, max, current) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		atomic.AddInt32(&handled, 1)
+	})
+	assert.NoError(t, err)
+	for i := 0; i < 6; i++ {
+		msgs <- amqp.Delivery{}
+	}
+	close(msgs)
+	group.stop()
+
+	<-group.drained()
+
+	assert.Equal(t, int32(6), atomic.LoadInt32(&handled), "all deliveries should be handled before the group is drained")
+	assert.Equal(t, int32(3), atomic.LoadInt32(&maxRunning))
+}
+
+func TestBeginConsuming_ShouldRefuseWorkersOnceStopping(t *testing.T) {
+	msgs := make(chan amqp.Delivery, 1)
+	msgs <- amqp.Delivery{}
+	group := newConsumerGroup()
+	group.stop()
+	var handled int32
+
+	err := beginConsuming(group, msgs, 2, func(d *amqp.Delivery) {
+		atomic.AddInt32(&handled, 1)
+	})
+
+	assert.Equal(t, ErrStopping, err)
+	select {
+	case <-group.drained():
+	case <-time.After(time.Second):
+		assert.Fail(t, "group should be drained without any worker")
+	}
+	assert.Equal(t, int32(0), atomic.LoadInt32(&handled))
+	assert.Len(t, msgs, 1, "the delivery should not have been consumed")
+}
+
+// Run with -race: consumers started by a reconnect may race with Stop waiting for the group.
+func TestBeginConsuming_ShouldNotRaceWithStop(t *testing.T) {
+	group := newConsumerGroup()
+	var started, refused int32
+	done := make(chan struct{})
+	for i := 0; i < 10; i++ {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			msgs := make(chan amqp.Delivery)
+			close(msgs)
+			if err := beginConsuming(group, msgs, 3, func(d *amqp.Delivery) {}); err != nil {
+				atomic.AddInt32(&refused, 1)
+				return
+			}
+			atomic.AddInt32(&started, 1)
+		}()
+	}
+	group.stop()
+	<-group.drained()
+	for i := 0; i < 10; i++ {
+		<-done
+	}
+
+	assert.Equal(t, int32(10), atomic.LoadInt32(&started)+atomic.LoadInt32(&refused))
+	assert.Equal(t, ErrStopping, beginConsuming(group, make(chan amqp.Delivery), 3, func(d *amqp.Delivery) {}))
+}
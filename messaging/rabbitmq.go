@@ -1,25 +1,29 @@
 package messaging
 
 import (
-	"github.com/efritz/backoff"
 	"github.com/efritz/watchdog"
-	log "github.com/sirupsen/logrus"
 	"github.com/streadway/amqp"
 	"net/url"
 	"sync"
 	"sync/atomic"
-	"time"
 )
 
 type (
 	RabbitMqService struct {
 		Url         *url.URL
 		connection  *amqp.Connection
+		connectionM *sync.RWMutex
 		watcher     watchdog.Watcher
 		channels    []*ChannelConfig
+		channelsM   *sync.RWMutex
+		openChannel channelOpener
+		rpc         *rpcClient
+		consumers   *consumerGroup
 		m           *sync.Mutex
-		ready       chan bool
 		isConnected *atomic.Value
+		retry       *RetryPolicy
+		// Optional, see EnableDeadLetters
+		deadLetters *deadLetterer
 	}
 	QueueOptions struct {
 		Exclusive    bool
@@ -49,21 +53,32 @@ type (
 		Args          amqp.Table
 	}
 	messageReceivedCallback func(delivery *amqp.Delivery)
-	ChannelConfig struct {
-		Consumer        Consumer         `yaml:"-"`
-		QueueOptions    *QueueOptions    `yaml:"queue,omitempty,flow"`
-		ExchangeOptions *ExchangeOptions `yaml:"exchange,omitempty,flow"`
-		QosOptions      *QosOptions      `yaml:"qos,omitempty,flow"`
-		channel         *atomic.Value
-		channelMutex    *sync.Mutex
-		Initializer     Initializer
+	ChannelConfig           struct {
+		// Name identifies the channel in logs and status reports, e.g. "task.added"
+		Name            string            `yaml:"-" json:"-"`
+		Consumer        Consumer          `yaml:"-" json:"-"`
+		QueueOptions    *QueueOptions     `yaml:"queue,omitempty,flow" json:"queue,omitempty"`
+		ExchangeOptions *ExchangeOptions  `yaml:"exchange,omitempty,flow" json:"exchange,omitempty"`
+		QosOptions      *QosOptions       `yaml:"qos,omitempty,flow" json:"qos,omitempty"`
+		Bindings        []*BindingOptions `yaml:"bindings,omitempty,flow" json:"bindings,omitempty"`
+		// Concurrency is the number of deliveries handled in parallel, at most the prefetch count. Defaults to 1.
+		Concurrency int `yaml:"concurrency,omitempty" json:"concurrency,omitempty"`
+		channel     *atomic.Value
+		confirmer   *atomic.Value
+		stats       *channelStats
+		consumerTag string
+		connection  *amqp.Connection
+		consumers   *consumerGroup
+		Initializer Initializer `yaml:"-" json:"-"`
 	}
 	QosOptions struct {
 		PrefetchCount int
 		PrefetchSize  int
 	}
-	Consumer func(d *amqp.Delivery)
-	Initializer func(config *ChannelConfig, channel *amqp.Channel)
+	Consumer func(d *Delivery)
+	// Initializer declares the topology of the channel and starts consuming, if needed.
+	// A returned error causes a reconnect with backoff.
+	Initializer func(config *ChannelConfig, channel *amqp.Channel) error
 )
 
 func NewQueueOptions() *QueueOptions {
@@ -75,26 +90,36 @@ func NewQueueOptions() *QueueOptions {
 
 func NewExchangeOptions() *ExchangeOptions {
 	return &ExchangeOptions{
-		Args: nil,
+		Args:         nil,
 		ExchangeType: "fanout",
 		DeliveryMode: amqp.Persistent,
+		ContentType:  "application/xml",
 	}
 }
 
-func NewRabbitMqService(serverUrl string) *RabbitMqService {
+// NewRabbitMqService creates a service for the given URL. If policy is nil, NewRetryPolicy is used.
+func NewRabbitMqService(serverUrl string, policy *RetryPolicy) (*RabbitMqService, error) {
+	if policy == nil {
+		policy = NewRetryPolicy()
+	}
 	s := &RabbitMqService{
 		m:           &sync.Mutex{},
+		connectionM: &sync.RWMutex{},
+		channelsM:   &sync.RWMutex{},
+		consumers:   newConsumerGroup(),
 		isConnected: &atomic.Value{},
+		retry:       policy,
 	}
 	s.isConnected.Store(false)
+	s.openChannel = s.openAmqpChannel
+	s.rpc = newRpcClient(s.openRpcChannel)
 
 	urlParsed, err := url.ParseRequestURI(serverUrl)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 	s.Url = urlParsed
 
-	s.watcher = watchdog.NewWatcher(s, backoff.NewConstantBackoff(10*time.Second))
-	s.ready = make(chan bool)
-	return s
+	s.watcher = watchdog.NewWatcher(s, policy.NewBackoff())
+	return s, nil
 }
@@ -0,0 +1,99 @@
+package messaging
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+	"github.com/streadway/amqp"
+	"time"
+)
+
+var (
+	channelClosures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "clustercode",
+		Subsystem: "rabbitmq",
+		Name:      "channel_closures_total",
+		Help:      "Number of channels closed or consumers cancelled by the broker.",
+	}, []string{"channel", "reason"})
+	channelRecoveries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "clustercode",
+		Subsystem: "rabbitmq",
+		Name:      "channel_recoveries_total",
+		Help:      "Number of attempts to re-create a channel after it has been closed by the broker.",
+	}, []string{"channel", "result"})
+)
+
+type (
+	// managedChannel is a channel in confirm mode with the notifications that watchChannel listens to. They are
+	// registered when the channel is opened, so that a close during the initialization is not missed.
+	managedChannel struct {
+		channel   *amqp.Channel
+		confirmer *confirmer
+		closed    <-chan *amqp.Error
+		cancelled <-chan string
+		close     func() error
+	}
+	// channelOpener returns a new channel on the current connection.
+	channelOpener func() (*managedChannel, error)
+)
+
+func init() {
+	prometheus.MustRegister(channelClosures, channelRecoveries)
+}
+
+// watchChannel re-creates the channel of the config if the broker closes it (e.g. PRECONDITION_FAILED) or cancels
+// its consumer (e.g. queue deleted). Channels closed by the gateway itself or by a lost connection are not recovered
+// here, the latter is handled by Retry.
+func (s *RabbitMqService) watchChannel(config *ChannelConfig, ch *managedChannel, conn *amqp.Connection) {
+	closed, cancelled := ch.closed, ch.cancelled
+	go func() {
+		logEntry := log.WithField("channel", config.Name)
+		select {
+		case err, ok := <-closed:
+			if !isChannelError(err, ok) {
+				return
+			}
+			logEntry.WithField("error", err).Warn("channel closed by broker")
+			channelClosures.WithLabelValues(config.Name, "closed").Inc()
+		case tag, ok := <-cancelled:
+			if !ok {
+				// the channel is shutting down, the close notification tells whether it was intended
+				err, ok := <-closed
+				if !isChannelError(err, ok) {
+					return
+				}
+				logEntry.WithField("error", err).Warn("channel closed by broker")
+				channelClosures.WithLabelValues(config.Name, "closed").Inc()
+				break
+			}
+			logEntry.WithField("consumer_tag", tag).Warn("consumer cancelled by broker")
+			channelClosures.WithLabelValues(config.Name, "cancelled").Inc()
+			ch.close()
+		}
+		config.stats.setOpen(false)
+		s.recoverChannel(config, conn)
+	}()
+}
+
+// Soft errors (e.g. PRECONDITION_FAILED) only close the channel. Hard errors close the whole connection.
+func isChannelError(err *amqp.Error, ok bool) bool {
+	return ok && err != nil && err.Recover
+}
+
+func (s *RabbitMqService) recoverChannel(config *ChannelConfig, conn *amqp.Connection) {
+	logEntry := log.WithField("channel", config.Name)
+	b := s.retry.NewBackoff()
+	for {
+		if s.getConnection() != conn {
+			logEntry.Debug("connection has been lost, channel will be recovered once reconnected")
+			return
+		}
+		logEntry.Info("recovering channel")
+		if err := s.createChannelAndInitialize(config); err == nil {
+			channelRecoveries.WithLabelValues(config.Name, "success").Inc()
+			logEntry.Info("recovered channel")
+			return
+		}
+		channelRecoveries.WithLabelValues(config.Name, "failure").Inc()
+		time.Sleep(b.NextInterval())
+	}
+}
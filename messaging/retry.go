@@ -0,0 +1,71 @@
+package messaging
+
+import (
+	"errors"
+	"github.com/efritz/backoff"
+	"math/rand"
+	"time"
+)
+
+var ErrMaxAttempts = errors.New("giving up after the maximum number of publish attempts")
+
+type (
+	// RetryPolicy configures the exponential backoff used for reconnects, channel recovery and publish retries.
+	RetryPolicy struct {
+		InitialInterval time.Duration
+		MaxInterval     time.Duration
+		Multiplier      float64
+		// Jitter randomizes each interval by +/- the given ratio, e.g. 0.2 for 20%.
+		Jitter float64
+		// MaxPublishAttempts limits the attempts of Publish. 0 retries until succeeded.
+		MaxPublishAttempts int
+	}
+	// jitteredBackoff randomizes every interval, the exponential backoff of the library neither randomizes
+	// constant intervals nor the maximum interval.
+	jitteredBackoff struct {
+		backoff.Backoff
+		jitter float64
+	}
+)
+
+func NewRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		InitialInterval:    1 * time.Second,
+		MaxInterval:        1 * time.Minute,
+		Multiplier:         2,
+		Jitter:             0.2,
+		MaxPublishAttempts: 0,
+	}
+}
+
+// NewBackoff returns a fresh backoff. Each retry loop needs its own, since the backoff keeps track of the attempts.
+func (p *RetryPolicy) NewBackoff() backoff.Backoff {
+	maxInterval := p.MaxInterval
+	if maxInterval < p.InitialInterval {
+		maxInterval = p.InitialInterval
+	}
+	var b backoff.Backoff
+	if p.Multiplier <= 1 || maxInterval == p.InitialInterval {
+		b = backoff.NewConstantBackoff(p.InitialInterval)
+	} else {
+		b = backoff.NewExponentialBackoff(p.InitialInterval, maxInterval, backoff.WithMultiplier(p.Multiplier))
+	}
+	if p.Jitter <= 0 {
+		return b
+	}
+	return &jitteredBackoff{Backoff: b, jitter: p.Jitter}
+}
+
+func (b *jitteredBackoff) NextInterval() time.Duration {
+	factor := 1 - b.jitter + 2*b.jitter*rand.Float64()
+	return time.Duration(float64(b.Backoff.NextInterval()) * factor)
+}
+
+func (b *jitteredBackoff) Clone() backoff.Backoff {
+	return &jitteredBackoff{Backoff: b.Backoff.Clone(), jitter: b.jitter}
+}
+
+// hasAttemptsLeft returns true if another publish attempt is allowed after the given number of attempts.
+func (p *RetryPolicy) hasAttemptsLeft(attempts int) bool {
+	return p.MaxPublishAttempts <= 0 || attempts < p.MaxPublishAttempts
+}
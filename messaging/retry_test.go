@@ -0,0 +1,91 @@
+package messaging
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy_NewBackoff(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   RetryPolicy
+		expected []time.Duration
+	}{
+		{
+			name: "Exponential",
+			policy: RetryPolicy{
+				InitialInterval: time.Second,
+				MaxInterval:     10 * time.Second,
+				Multiplier:      2,
+			},
+			expected: []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 10 * time.Second, 10 * time.Second},
+		},
+		{
+			name: "Constant_WhenMultiplierIsOne",
+			policy: RetryPolicy{
+				InitialInterval: time.Second,
+				MaxInterval:     5 * time.Second,
+				Multiplier:      1,
+			},
+			expected: []time.Duration{time.Second, time.Second, time.Second},
+		},
+		{
+			name: "Constant_WhenMaxIntervalIsSmaller",
+			policy: RetryPolicy{
+				InitialInterval: 2 * time.Second,
+				MaxInterval:     time.Second,
+				Multiplier:      2,
+			},
+			expected: []time.Duration{2 * time.Second, 2 * time.Second},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := tt.policy.NewBackoff()
+			for _, expected := range tt.expected {
+				assert.Equal(t, expected, b.NextInterval())
+			}
+		})
+	}
+}
+
+func TestRetryPolicy_NewBackoff_ShouldApplyJitter(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy RetryPolicy
+		base   []time.Duration
+	}{
+		{
+			name:   "Exponential",
+			policy: RetryPolicy{InitialInterval: time.Second, MaxInterval: 8 * time.Second, Multiplier: 2, Jitter: 0.5},
+			base:   []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 8 * time.Second},
+		},
+		{
+			name:   "Constant",
+			policy: RetryPolicy{InitialInterval: time.Second, MaxInterval: time.Minute, Multiplier: 1, Jitter: 0.5},
+			base:   []time.Duration{time.Second, time.Second, time.Second, time.Second, time.Second},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := tt.policy.NewBackoff()
+			randomized := false
+			for _, base := range tt.base {
+				interval := b.NextInterval()
+				assert.True(t, interval >= base/2 && interval <= base*3/2, "interval %s is not within jitter of %s", interval, base)
+				randomized = randomized || interval != base
+			}
+			assert.True(t, randomized, "intervals should be randomized")
+		})
+	}
+}
+
+func TestRetryPolicy_HasAttemptsLeft(t *testing.T) {
+	unlimited := RetryPolicy{}
+	assert.True(t, unlimited.hasAttemptsLeft(100))
+
+	limited := RetryPolicy{MaxPublishAttempts: 3}
+	assert.True(t, limited.hasAttemptsLeft(2))
+	assert.False(t, limited.hasAttemptsLeft(3))
+}
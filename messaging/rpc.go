@@ -0,0 +1,196 @@
+package messaging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/streadway/amqp"
+	"sync"
+)
+
+// RabbitMQ's pseudo queue for direct reply-to. Replies are delivered to the channel that published the request.
+const directReplyTo = "amq.rabbitmq.reply-to"
+
+var (
+	ErrNotConnected = errors.New("not connected to RabbitMQ server")
+	ErrReplyChannel = errors.New("reply channel has been closed before a reply was received")
+)
+
+type (
+	rpcClient struct {
+		m       *sync.Mutex
+		open    rpcChannelOpener
+		channel *rpcChannel
+		pending map[string]chan []byte
+	}
+	// rpcChannel publishes requests in confirm mode and consumes the replies to them.
+	rpcChannel struct {
+		confirmer *confirmer
+		publish   func(options *ExchangeOptions, msg amqp.Publishing) error
+		close     func() error
+	}
+	// rpcChannelOpener returns a new channel and the replies delivered to it.
+	rpcChannelOpener func() (*rpcChannel, <-chan amqp.Delivery, error)
+)
+
+func newRpcClient(open rpcChannelOpener) *rpcClient {
+	return &rpcClient{
+		m:       &sync.Mutex{},
+		open:    open,
+		pending: make(map[string]chan []byte),
+	}
+}
+
+// Call publishes the payload as request with a new correlation ID and returns the body of the matching reply.
+// The request is published to the exchange (or queue) of the given config, the reply is expected via direct reply-to.
+// Returns ErrNack if the broker rejected the request and ctx.Err() if the context is done before a reply arrives.
+func (s *RabbitMqService) Call(ctx context.Context, config *ChannelConfig, payload string) ([]byte, error) {
+	if !s.IsConnected() {
+		return nil, ErrNotConnected
+	}
+	options := publishOptions(config)
+	msg := newPublishing(options, payload)
+	msg.CorrelationId = newCorrelationID()
+	msg.ReplyTo = directReplyTo
+	return s.rpc.call(ctx, options, msg)
+}
+
+func (s *RabbitMqService) openRpcChannel() (*rpcChannel, <-chan amqp.Delivery, error) {
+	ch, err := s.tryCreateChannel()
+	if err != nil {
+		return nil, nil, err
+	}
+	c, err := newConfirmer(ch)
+	if err != nil {
+		ch.Close()
+		return nil, nil, err
+	}
+	replies, err := ch.Consume(directReplyTo, "", true, false, false, false, nil)
+	if err != nil {
+		ch.Close()
+		return nil, nil, err
+	}
+	return &rpcChannel{
+		confirmer: c,
+		publish: func(options *ExchangeOptions, msg amqp.Publishing) error {
+			return publishMessage(options, ch, msg)
+		},
+		close: ch.Close,
+	}, replies, nil
+}
+
+func (c *rpcClient) call(ctx context.Context, options *ExchangeOptions, msg amqp.Publishing) ([]byte, error) {
+	logEntry := log.WithFields(log.Fields{
+		"exchange_name":  options.ExchangeName,
+		"routing_key":    options.RoutingKey,
+		"correlation_id": msg.CorrelationId,
+	})
+
+	reply, ch, err := c.request(msg.CorrelationId)
+	if err != nil {
+		return nil, err
+	}
+	confirmed, tag, err := ch.confirmer.publish(func() error {
+		return ch.publish(options, msg)
+	})
+	if err != nil {
+		c.forget(msg.CorrelationId)
+		return nil, err
+	}
+	select {
+	case ack, ok := <-confirmed:
+		if !ok {
+			c.forget(msg.CorrelationId)
+			return nil, ErrChannelClosed
+		}
+		if !ack {
+			c.forget(msg.CorrelationId)
+			return nil, ErrNack
+		}
+	case <-ctx.Done():
+		ch.confirmer.forget(tag)
+		c.forget(msg.CorrelationId)
+		logEntry.WithField("error", ctx.Err()).Debug("gave up waiting for confirm")
+		return nil, ctx.Err()
+	}
+	logEntry.Debug("sent request, awaiting reply")
+
+	select {
+	case body, ok := <-reply:
+		if !ok {
+			return nil, ErrReplyChannel
+		}
+		logEntry.Debug("received reply")
+		return body, nil
+	case <-ctx.Done():
+		c.forget(msg.CorrelationId)
+		logEntry.WithField("error", ctx.Err()).Debug("gave up waiting for reply")
+		return nil, ctx.Err()
+	}
+}
+
+// request registers the call, so that a reply is matched even if it arrives before the confirm.
+func (c *rpcClient) request(correlationID string) (<-chan []byte, *rpcChannel, error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if c.channel == nil {
+		ch, replies, err := c.open()
+		if err != nil {
+			return nil, nil, err
+		}
+		c.channel = ch
+		go c.dispatch(ch, replies)
+	}
+	reply := make(chan []byte, 1)
+	c.pending[correlationID] = reply
+	return reply, c.channel, nil
+}
+
+func (c *rpcClient) forget(correlationID string) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	delete(c.pending, correlationID)
+}
+
+func (c *rpcClient) dispatch(ch *rpcChannel, replies <-chan amqp.Delivery) {
+	for reply := range replies {
+		c.m.Lock()
+		if pending, exists := c.pending[reply.CorrelationId]; exists {
+			delete(c.pending, reply.CorrelationId)
+			pending <- reply.Body
+		} else {
+			log.WithField("correlation_id", reply.CorrelationId).Warn("received reply for unknown request")
+		}
+		c.m.Unlock()
+	}
+
+	// The channel or connection has been closed, the pending requests will never get a reply.
+	c.m.Lock()
+	defer c.m.Unlock()
+	if c.channel == ch {
+		c.channel = nil
+	}
+	for correlationID, pending := range c.pending {
+		close(pending)
+		delete(c.pending, correlationID)
+	}
+}
+
+func (c *rpcClient) close() {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if c.channel != nil {
+		c.channel.close()
+	}
+}
+
+func newCorrelationID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		log.WithField("error", err).Panic("could not read random bytes")
+	}
+	return hex.EncodeToString(b)
+}
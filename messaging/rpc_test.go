@@ -0,0 +1,164 @@
+package messaging
+
+import (
+	"context"
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// fakeRpcBroker stands in for the channels opened by an rpcClient. Requests are recorded, confirms and replies are
+// sent by the test.
+type fakeRpcBroker struct {
+	opened   int
+	requests chan amqp.Publishing
+	confirms chan amqp.Confirmation
+	replies  chan amqp.Delivery
+}
+
+func newFakeRpcClient() (*rpcClient, *fakeRpcBroker) {
+	broker := &fakeRpcBroker{requests: make(chan amqp.Publishing, 10)}
+	return newRpcClient(func() (*rpcChannel, <-chan amqp.Delivery, error) {
+		broker.opened++
+		broker.confirms = make(chan amqp.Confirmation)
+		broker.replies = make(chan amqp.Delivery)
+		return &rpcChannel{
+			confirmer: startConfirmer(broker.confirms),
+			publish: func(options *ExchangeOptions, msg amqp.Publishing) error {
+				broker.requests <- msg
+				return nil
+			},
+			close: func() error {
+				close(broker.replies)
+				close(broker.confirms)
+				return nil
+			},
+		}, broker.replies, nil
+	}), broker
+}
+
+func (b *fakeRpcBroker) receiveRequest(t *testing.T) amqp.Publishing {
+	select {
+	case msg := <-b.requests:
+		return msg
+	case <-time.After(time.Second):
+		require.FailNow(t, "no request published")
+		return amqp.Publishing{}
+	}
+}
+
+type rpcResult struct {
+	body []byte
+	err  error
+}
+
+func callAsync(c *rpcClient, ctx context.Context, correlationID string) <-chan rpcResult {
+	result := make(chan rpcResult, 1)
+	go func() {
+		msg := amqp.Publishing{CorrelationId: correlationID, ReplyTo: directReplyTo}
+		body, err := c.call(ctx, NewExchangeOptions(), msg)
+		result <- rpcResult{body: body, err: err}
+	}()
+	return result
+}
+
+func receiveResult(t *testing.T, result <-chan rpcResult) rpcResult {
+	select {
+	case r := <-result:
+		return r
+	case <-time.After(time.Second):
+		require.FailNow(t, "call did not return")
+		return rpcResult{}
+	}
+}
+
+func assertNoPendingCalls(t *testing.T, c *rpcClient) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	assert.Empty(t, c.pending)
+}
+
+func TestRpcClient_ShouldMatchRepliesByCorrelationID(t *testing.T) {
+	c, broker := newFakeRpcClient()
+	defer c.close()
+
+	first := callAsync(c, context.Background(), "first")
+	broker.receiveRequest(t)
+	second := callAsync(c, context.Background(), "second")
+	broker.receiveRequest(t)
+	broker.confirms <- amqp.Confirmation{DeliveryTag: 1, Ack: true}
+	broker.confirms <- amqp.Confirmation{DeliveryTag: 2, Ack: true}
+
+	broker.replies <- amqp.Delivery{CorrelationId: "unknown", Body: []byte("ignored")}
+	broker.replies <- amqp.Delivery{CorrelationId: "second", Body: []byte("reply to second")}
+	broker.replies <- amqp.Delivery{CorrelationId: "first", Body: []byte("reply to first")}
+
+	r := receiveResult(t, first)
+	assert.NoError(t, r.err)
+	assert.Equal(t, "reply to first", string(r.body))
+	r = receiveResult(t, second)
+	assert.NoError(t, r.err)
+	assert.Equal(t, "reply to second", string(r.body))
+	assertNoPendingCalls(t, c)
+	assert.Equal(t, 1, broker.opened, "calls should share the channel")
+}
+
+func TestRpcClient_ShouldAcceptReplyBeforeConfirm(t *testing.T) {
+	c, broker := newFakeRpcClient()
+	defer c.close()
+
+	result := callAsync(c, context.Background(), "id")
+	broker.receiveRequest(t)
+	broker.replies <- amqp.Delivery{CorrelationId: "id", Body: []byte("reply")}
+	broker.confirms <- amqp.Confirmation{DeliveryTag: 1, Ack: true}
+
+	r := receiveResult(t, result)
+	assert.NoError(t, r.err)
+	assert.Equal(t, "reply", string(r.body))
+}
+
+func TestRpcClient_ShouldFailIfRequestIsRejected(t *testing.T) {
+	c, broker := newFakeRpcClient()
+	defer c.close()
+
+	result := callAsync(c, context.Background(), "id")
+	broker.receiveRequest(t)
+	broker.confirms <- amqp.Confirmation{DeliveryTag: 1, Ack: false}
+
+	assert.Equal(t, ErrNack, receiveResult(t, result).err)
+	assertNoPendingCalls(t, c)
+}
+
+func TestRpcClient_ShouldTimeOut(t *testing.T) {
+	c, broker := newFakeRpcClient()
+	defer c.close()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	result := callAsync(c, ctx, "id")
+	broker.receiveRequest(t)
+	broker.confirms <- amqp.Confirmation{DeliveryTag: 1, Ack: true}
+
+	assert.Equal(t, context.DeadlineExceeded, receiveResult(t, result).err)
+	assertNoPendingCalls(t, c)
+}
+
+func TestRpcClient_ShouldFailPendingCallsWhenChannelCloses(t *testing.T) {
+	c, broker := newFakeRpcClient()
+
+	result := callAsync(c, context.Background(), "id")
+	broker.receiveRequest(t)
+	broker.confirms <- amqp.Confirmation{DeliveryTag: 1, Ack: true}
+	c.close()
+
+	assert.Equal(t, ErrReplyChannel, receiveResult(t, result).err)
+	assertNoPendingCalls(t, c)
+
+	result = callAsync(c, context.Background(), "next")
+	broker.receiveRequest(t)
+	assert.Equal(t, 2, broker.opened, "a new channel should be opened for the next call")
+	c.close()
+	assert.Equal(t, ErrChannelClosed, receiveResult(t, result).err)
+}
@@ -1,15 +1,17 @@
 package messaging
 
 import (
-	"github.com/efritz/backoff"
+	"context"
+	"fmt"
 	log "github.com/sirupsen/logrus"
 	"github.com/streadway/amqp"
-	"sync"
 	"sync/atomic"
 	"time"
 )
 
 // This method is part of an interface, do not call it manually!
+// Returns false if either the connection or one of the channels could not be established, so that the watcher
+// backs off and tries again.
 func (s *RabbitMqService) Retry() bool {
 	conn, err := s.connect()
 	if err != nil {
@@ -20,33 +22,131 @@ func (s *RabbitMqService) Retry() bool {
 	go func() {
 		for msg := range errRec {
 			log.Error(msg)
-			s.connection = nil
-			s.watcher.Check()
+			if !s.replaceConnection(conn, nil) {
+				// already replaced by a reconnect
+				continue
+			}
 			s.isConnected.Store(false)
+			for _, config := range s.getChannels() {
+				config.stats.setOpen(false)
+			}
+			s.watcher.Check()
 		}
 	}()
 	conn.NotifyClose(errRec)
 
-	s.connection = conn
+	s.setConnection(conn)
 	s.isConnected.Store(true)
-	for _, config := range s.channels {
-		s.createChannelAndInitialize(config)
+	for _, config := range s.getChannels() {
+		if err := s.createChannelAndInitialize(config); err != nil {
+			s.isConnected.Store(false)
+			s.replaceConnection(conn, nil)
+			conn.Close()
+			return false
+		}
 	}
 	return true
 }
 
+func (s *RabbitMqService) getChannels() []*ChannelConfig {
+	s.channelsM.RLock()
+	defer s.channelsM.RUnlock()
+	return append([]*ChannelConfig{}, s.channels...)
+}
+
 func (s *RabbitMqService) getConnection() *amqp.Connection {
 	if !s.IsConnected() {
-		<-s.ready
+		return nil
 	}
+	return s.loadConnection()
+}
+
+// loadConnection returns the current connection, even if it is not established anymore.
+func (s *RabbitMqService) loadConnection() *amqp.Connection {
+	s.connectionM.RLock()
+	defer s.connectionM.RUnlock()
 	return s.connection
 }
 
+func (s *RabbitMqService) setConnection(conn *amqp.Connection) {
+	s.connectionM.Lock()
+	defer s.connectionM.Unlock()
+	s.connection = conn
+}
+
+// replaceConnection sets the connection to next, unless the current one is not old anymore. Then a concurrent
+// reconnect or Stop replaced it already and false is returned.
+func (s *RabbitMqService) replaceConnection(old *amqp.Connection, next *amqp.Connection) bool {
+	s.connectionM.Lock()
+	defer s.connectionM.Unlock()
+	if s.connection != old {
+		return false
+	}
+	s.connection = next
+	return true
+}
+
+// Start registers the channels and connects in the background, so that it does not block while the broker is
+// unavailable. The channels are initialized once connected and after each reconnect, until then Status reports
+// them as not open.
 func (s *RabbitMqService) Start(configs ...*ChannelConfig) {
-	<-s.watcher.Start()
 	for _, config := range configs {
-		s.AddChannelConfig(config)
+		s.registerChannel(config)
+	}
+	connected := s.watcher.Start()
+	// The watcher reports each successful (re)connect and blocks until it is received.
+	go func() {
+		for range connected {
+		}
+	}()
+}
+
+// Stop cancels all consumers, waits until the deliveries in flight have been handled and closes the connection.
+// If the context is done before all deliveries are handled, the connection is closed anyway and ctx.Err() returned.
+func (s *RabbitMqService) Stop(ctx context.Context) error {
+	log.Info("stopping RabbitMQ consumers")
+	s.watcher.Stop()
+	// A reconnect or channel recovery in progress must not start consumers that are not cancelled below.
+	s.consumers.stop()
+
+	channels := s.getChannels()
+	for _, config := range channels {
+		ch, _ := config.channel.Load().(*amqp.Channel)
+		if config.consumerTag == "" || ch == nil {
+			continue
+		}
+		if err := ch.Cancel(config.consumerTag, false); err != nil {
+			log.WithFields(log.Fields{
+				"channel": config.Name,
+				"error":   err,
+			}).Warn("could not cancel consumer")
+		}
+	}
+
+	var err error
+	select {
+	case <-s.consumers.drained():
+		log.Debug("all deliveries in flight have been handled")
+	case <-ctx.Done():
+		err = ctx.Err()
+		log.WithField("error", err).Warn("gave up waiting for deliveries in flight")
 	}
+
+	s.isConnected.Store(false)
+	for _, config := range channels {
+		if ch, _ := config.channel.Load().(*amqp.Channel); ch != nil {
+			ch.Close()
+		}
+		config.stats.setOpen(false)
+	}
+	s.rpc.close()
+	if conn := s.loadConnection(); conn != nil && s.replaceConnection(conn, nil) {
+		if closeErr := conn.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	log.Info("disconnected from RabbitMQ server")
+	return err
 }
 
 func (s *RabbitMqService) connect() (*amqp.Connection, error) {
@@ -74,54 +174,183 @@ func (s *RabbitMqService) IsConnected() bool {
 	return s.isConnected.Load().(bool)
 }
 
-var b = backoff.NewConstantBackoff(10 * time.Second)
+// Publish sends the payload and retries according to the retry policy until the broker confirmed it.
+// Returns ErrMaxAttempts if the policy limits the attempts and all of them failed.
+// Consider PublishContext to not block forever.
+func (s *RabbitMqService) Publish(config *ChannelConfig, payload string) error {
+	b := s.retry.NewBackoff()
+	for attempts := 1; ; attempts++ {
+		err := s.PublishContext(context.Background(), config, payload)
+		if err == nil {
+			return nil
+		}
+		logEntry := log.WithFields(log.Fields{
+			"channel":  config.Name,
+			"error":    err,
+			"attempts": attempts,
+		})
+		if !s.retry.hasAttemptsLeft(attempts) {
+			logEntry.Error("could not send message, giving up")
+			return ErrMaxAttempts
+		}
+		logEntry.WithField("help", "This was probably a network failure. Will retry").Error("could not send message")
+		time.Sleep(b.NextInterval())
+	}
+}
 
-func (s *RabbitMqService) Publish(config *ChannelConfig, payload string) {
-	config.channelMutex.Lock()
-	defer config.channelMutex.Unlock()
+// PublishContext sends the payload and waits until the broker confirmed it.
+// Returns an error if the broker rejected the message, the channel closed or the context is done before.
+func (s *RabbitMqService) PublishContext(ctx context.Context, config *ChannelConfig, payload string) error {
+	options := publishOptions(config)
+	return s.publishConfirmed(ctx, config, options, newPublishing(options, payload))
+}
 
+func (s *RabbitMqService) publishConfirmed(ctx context.Context, config *ChannelConfig, options *ExchangeOptions, msg amqp.Publishing) error {
 	logEntry := log.WithFields(log.Fields{
-		"queue_name":    config.ExchangeOptions.QueueName,
-		"exchange_name": config.ExchangeOptions.ExchangeName,
-		"routing_key":   config.ExchangeOptions.RoutingKey,
+		"queue_name":    options.QueueName,
+		"exchange_name": options.ExchangeName,
+		"routing_key":   options.RoutingKey,
 	})
+
+	if !s.IsConnected() {
+		return ErrNotConnected
+	}
+	c, _ := config.confirmer.Load().(*confirmer)
+	ch, _ := config.channel.Load().(*amqp.Channel)
+	if c == nil || ch == nil {
+		return ErrChannelClosed
+	}
+
 	logEntry.Debug("sending message")
+	confirmed, tag, err := c.publish(func() error {
+		return publishMessage(options, ch, msg)
+	})
+	if err != nil {
+		return err
+	}
 
-	retry := true
-	for retry {
-		if s.IsConnected() {
-			err := publishOnChannel(config.ExchangeOptions, config.channel.Load().(*amqp.Channel), payload)
-			if err == nil {
-				retry = false
-			} else {
-				logEntry.
-					WithField("help", "This was probably a network failure. Will retry until succeeded").
-					Error(err)
-				time.Sleep(b.NextInterval())
-			}
-		} else {
-			time.Sleep(b.NextInterval())
+	select {
+	case ack, ok := <-confirmed:
+		if !ok {
+			return ErrChannelClosed
+		}
+		if !ack {
+			return ErrNack
 		}
+		config.stats.published()
+		logEntry.Debug("sent message successfully")
+		return nil
+	case <-ctx.Done():
+		c.forget(tag)
+		return ctx.Err()
 	}
-	logEntry.Debug("sent message successfully")
 }
 
-func (s *RabbitMqService) createChannelAndInitialize(config *ChannelConfig) {
+// Channels without exchange publish to the default exchange, which routes directly to the queue.
+func publishOptions(config *ChannelConfig) *ExchangeOptions {
+	if config.ExchangeOptions != nil {
+		return config.ExchangeOptions
+	}
+	options := NewExchangeOptions()
+	options.QueueName = config.QueueOptions.QueueName
+	options.RoutingKey = config.QueueOptions.QueueName
+	options.ExchangeName = ""
+	return options
+}
+
+func (s *RabbitMqService) createChannelAndInitialize(config *ChannelConfig) error {
 	s.m.Lock()
 	defer s.m.Unlock()
-	ch := s.createChannelOrFail()
-	config.channel.Store(ch)
-	config.Initializer(config, ch)
+	err := s.tryCreateChannelAndInitialize(config)
+	config.stats.setError(err)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"channel": config.Name,
+			"error":   err,
+		}).Error("failed to initialize channel")
+	}
+	return err
 }
 
-func (s *RabbitMqService) AddChannelConfig(config *ChannelConfig) {
-	s.channels = append(s.channels, config)
-	config.channelMutex = &sync.Mutex{}
-	config.channel = &atomic.Value{}
+func (s *RabbitMqService) tryCreateChannelAndInitialize(config *ChannelConfig) error {
+	conn := s.getConnection()
+	if conn != nil && config.connection == conn && config.stats.isOpen() {
+		// already initialized by a concurrent reconnect
+		return nil
+	}
+	ch, err := s.openChannel()
+	if err != nil {
+		return err
+	}
+	config.confirmer.Store(ch.confirmer)
+	config.channel.Store(ch.channel)
+
+	if err := config.Initializer(config, ch.channel); err != nil {
+		ch.close()
+		return err
+	}
+	// Only watch channels that are in use, otherwise a failed initialization closed by the broker would start
+	// another recovery next to the one retrying it.
+	s.watchChannel(config, ch, conn)
+	config.connection = conn
+	config.stats.setOpen(true)
+	return nil
+}
+
+// openAmqpChannel opens a channel in confirm mode on the current connection.
+func (s *RabbitMqService) openAmqpChannel() (*managedChannel, error) {
+	ch, err := s.createChannel()
+	if err != nil {
+		return nil, err
+	}
+	c, err := newConfirmer(ch)
+	if err != nil {
+		ch.Close()
+		return nil, fmt.Errorf("failed to put channel into confirm mode: %s", err)
+	}
+	return &managedChannel{
+		channel:   ch,
+		confirmer: c,
+		closed:    ch.NotifyClose(make(chan *amqp.Error, 1)),
+		cancelled: ch.NotifyCancel(make(chan string, 1)),
+		close:     ch.Close,
+	}, nil
+}
+
+// AddChannelConfig registers the config and initializes its channel. If that fails, the connection is re-established
+// with backoff, which retries the initialization of all channels. The error is reported in the channel status.
+// If the service is not connected yet, ErrNotConnected is returned and the channel is initialized once connected.
+func (s *RabbitMqService) AddChannelConfig(config *ChannelConfig) error {
+	s.registerChannel(config)
+	if !s.IsConnected() {
+		return ErrNotConnected
+	}
+	if err := s.createChannelAndInitialize(config); err != nil {
+		s.reconnect()
+		return err
+	}
+	return nil
+}
 
+// registerChannel adds the config to the channels that are initialized on each (re)connect.
+func (s *RabbitMqService) registerChannel(config *ChannelConfig) {
+	config.channel = &atomic.Value{}
+	config.confirmer = &atomic.Value{}
+	config.consumers = s.consumers
+	config.stats = newChannelStats()
 	if config.Initializer == nil {
 		config.Initializer = defaultChannelInitializer
 	}
+	s.channelsM.Lock()
+	s.channels = append(s.channels, config)
+	s.channelsM.Unlock()
+}
 
-	s.createChannelAndInitialize(config)
+// reconnect closes the current connection and lets the watcher re-establish it.
+func (s *RabbitMqService) reconnect() {
+	s.isConnected.Store(false)
+	if conn := s.loadConnection(); conn != nil && s.replaceConnection(conn, nil) {
+		conn.Close()
+	}
+	s.watcher.Check()
 }
@@ -0,0 +1,125 @@
+package messaging
+
+import (
+	"sync"
+	"time"
+)
+
+type (
+	ServiceStatus struct {
+		Connected   bool            `json:"connected"`
+		LastPublish *time.Time      `json:"lastPublish,omitempty"`
+		LastConsume *time.Time      `json:"lastConsume,omitempty"`
+		Channels    []ChannelStatus `json:"channels"`
+	}
+	ChannelStatus struct {
+		Name        string     `json:"name"`
+		Open        bool       `json:"open"`
+		Error       string     `json:"error,omitempty"`
+		LastPublish *time.Time `json:"lastPublish,omitempty"`
+		LastConsume *time.Time `json:"lastConsume,omitempty"`
+	}
+	channelStats struct {
+		m           *sync.Mutex
+		open        bool
+		lastError   error
+		lastPublish time.Time
+		lastConsume time.Time
+	}
+)
+
+func newChannelStats() *channelStats {
+	return &channelStats{m: &sync.Mutex{}}
+}
+
+func (c *channelStats) setOpen(open bool) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.open = open
+}
+
+func (c *channelStats) isOpen() bool {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.open
+}
+
+// setError records the outcome of the last channel initialization, nil clears a previous error.
+func (c *channelStats) setError(err error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.lastError = err
+}
+
+func (c *channelStats) published() {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.lastPublish = time.Now()
+}
+
+func (c *channelStats) consumed() {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.lastConsume = time.Now()
+}
+
+// Status returns a snapshot of the connection and each channel, e.g. for health checks.
+func (s *RabbitMqService) Status() ServiceStatus {
+	return newServiceStatus(s.IsConnected(), s.getChannels())
+}
+
+func newServiceStatus(connected bool, channels []*ChannelConfig) ServiceStatus {
+	status := ServiceStatus{
+		Connected: connected,
+		Channels:  make([]ChannelStatus, 0, len(channels)),
+	}
+	var lastPublish, lastConsume time.Time
+	for _, config := range channels {
+		config.stats.m.Lock()
+		channel := ChannelStatus{
+			Name:        config.Name,
+			Open:        config.stats.open && status.Connected,
+			Error:       errorOrEmpty(config.stats.lastError),
+			LastPublish: timeOrNil(config.stats.lastPublish),
+			LastConsume: timeOrNil(config.stats.lastConsume),
+		}
+		if config.stats.lastPublish.After(lastPublish) {
+			lastPublish = config.stats.lastPublish
+		}
+		if config.stats.lastConsume.After(lastConsume) {
+			lastConsume = config.stats.lastConsume
+		}
+		config.stats.m.Unlock()
+		status.Channels = append(status.Channels, channel)
+	}
+	status.LastPublish = timeOrNil(lastPublish)
+	status.LastConsume = timeOrNil(lastConsume)
+	return status
+}
+
+// IsReady returns true if the service is connected and all channels are open.
+func (s ServiceStatus) IsReady() bool {
+	if !s.Connected {
+		return false
+	}
+	for _, channel := range s.Channels {
+		if !channel.Open {
+			return false
+		}
+	}
+	return true
+}
+
+func errorOrEmpty(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
@@ -0,0 +1,101 @@
+package messaging
+
+import (
+	"fmt"
+	"github.com/streadway/amqp"
+	"math"
+	"sort"
+	"strings"
+)
+
+type (
+	// BindingOptions binds the queue of a channel to an additional exchange.
+	BindingOptions struct {
+		ExchangeName string
+		RoutingKey   string
+		NoWait       bool
+		Args         amqp.Table
+	}
+	// Topology holds the channel configs declared in the configuration.
+	// Channels are named after their position in the config tree, e.g. "task.added".
+	Topology struct {
+		channels map[string]*ChannelConfig
+	}
+)
+
+// NewTopology names and validates the given definitions (grouped by entity, then by event) and fills in defaults.
+func NewTopology(definitions map[string]map[string]*ChannelConfig) (*Topology, error) {
+	t := &Topology{
+		channels: make(map[string]*ChannelConfig),
+	}
+	for entity, events := range definitions {
+		for event, config := range events {
+			name := strings.Join([]string{entity, event}, ".")
+			if config == nil {
+				return nil, fmt.Errorf("channel '%s' is empty", name)
+			}
+			if config.QueueOptions == nil && config.ExchangeOptions == nil {
+				return nil, fmt.Errorf("channel '%s' declares neither a queue nor an exchange", name)
+			}
+			if config.QueueOptions == nil && len(config.Bindings) > 0 {
+				return nil, fmt.Errorf("channel '%s' declares bindings without a queue", name)
+			}
+			config.Name = name
+			applyDefaults(config)
+			t.channels[name] = config
+		}
+	}
+	return t, nil
+}
+
+// Channel returns the config with the given name, or nil if the topology does not contain it.
+func (t *Topology) Channel(name string) *ChannelConfig {
+	return t.channels[name]
+}
+
+// Channels returns all configs, sorted by name.
+func (t *Topology) Channels() []*ChannelConfig {
+	names := make([]string, 0, len(t.channels))
+	for name := range t.channels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	configs := make([]*ChannelConfig, len(names))
+	for i, name := range names {
+		configs[i] = t.channels[name]
+	}
+	return configs
+}
+
+func applyDefaults(config *ChannelConfig) {
+	if q := config.QueueOptions; q != nil {
+		q.Args = normalizeArgs(q.Args)
+	}
+	if e := config.ExchangeOptions; e != nil {
+		defaults := NewExchangeOptions()
+		if e.ExchangeType == "" {
+			e.ExchangeType = defaults.ExchangeType
+		}
+		if e.DeliveryMode == 0 {
+			e.DeliveryMode = defaults.DeliveryMode
+		}
+		if e.ContentType == "" {
+			e.ContentType = defaults.ContentType
+		}
+		e.Args = normalizeArgs(e.Args)
+	}
+	for _, binding := range config.Bindings {
+		binding.Args = normalizeArgs(binding.Args)
+	}
+}
+
+// The config is decoded as JSON, so all numbers end up as float64. RabbitMQ rejects arguments such as
+// x-message-ttl or x-max-length unless they are integers.
+func normalizeArgs(args amqp.Table) amqp.Table {
+	for key, value := range args {
+		if f, ok := value.(float64); ok && f == math.Trunc(f) {
+			args[key] = int64(f)
+		}
+	}
+	return args
+}
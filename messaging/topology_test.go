@@ -0,0 +1,85 @@
+package messaging
+
+import (
+	"encoding/json"
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func newTopologyFromJson(t *testing.T, raw string) (*Topology, error) {
+	definitions := make(map[string]map[string]*ChannelConfig)
+	require.NoError(t, json.Unmarshal([]byte(raw), &definitions))
+	return NewTopology(definitions)
+}
+
+func TestNewTopology_ShouldBuildChannelConfigs(t *testing.T) {
+	topology, err := newTopologyFromJson(t, `{
+		"task": {
+			"added": {
+				"queue": {"queueName": "task-added", "durable": true, "args": {"x-message-ttl": 60000}},
+				"exchange": {"exchangeName": "task-added", "durable": true},
+				"qos": {"prefetchCount": 1},
+				"bindings": [{"exchangeName": "retry", "routingKey": "task.added"}]
+			}
+		},
+		"slice": {
+			"completed": {
+				"exchange": {"exchangeName": "slice-completed", "exchangeType": "topic"}
+			}
+		}
+	}`)
+	require.NoError(t, err)
+
+	taskAdded := topology.Channel("task.added")
+	require.NotNil(t, taskAdded)
+	assert.Equal(t, "task.added", taskAdded.Name)
+	assert.Equal(t, "task-added", taskAdded.QueueOptions.QueueName)
+	assert.True(t, taskAdded.QueueOptions.Durable)
+	assert.Equal(t, amqp.Table{"x-message-ttl": int64(60000)}, taskAdded.QueueOptions.Args)
+	assert.Equal(t, "fanout", taskAdded.ExchangeOptions.ExchangeType)
+	assert.Equal(t, amqp.Persistent, taskAdded.ExchangeOptions.DeliveryMode)
+	assert.Equal(t, "application/xml", taskAdded.ExchangeOptions.ContentType)
+	assert.Equal(t, 1, taskAdded.QosOptions.PrefetchCount)
+	assert.Equal(t, []*BindingOptions{{ExchangeName: "retry", RoutingKey: "task.added"}}, taskAdded.Bindings)
+
+	sliceCompleted := topology.Channel("slice.completed")
+	require.NotNil(t, sliceCompleted)
+	assert.Nil(t, sliceCompleted.QueueOptions)
+	assert.Equal(t, "topic", sliceCompleted.ExchangeOptions.ExchangeType)
+
+	assert.Nil(t, topology.Channel("task.unknown"))
+	assert.Equal(t, []*ChannelConfig{sliceCompleted, taskAdded}, topology.Channels())
+}
+
+func TestNewTopology_ShouldRejectInvalidChannels(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+	}{
+		{
+			name: "Empty",
+			raw:  `{"task": {"added": null}}`,
+		},
+		{
+			name: "NeitherQueueNorExchange",
+			raw:  `{"task": {"added": {"qos": {"prefetchCount": 1}}}}`,
+		},
+		{
+			name: "BindingsWithoutQueue",
+			raw:  `{"task": {"added": {"exchange": {"exchangeName": "x"}, "bindings": [{"exchangeName": "y"}]}}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newTopologyFromJson(t, tt.raw)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestNormalizeArgs_ShouldKeepFractions(t *testing.T) {
+	args := normalizeArgs(amqp.Table{"whole": float64(5), "fraction": 0.5, "text": "value"})
+	assert.Equal(t, amqp.Table{"whole": int64(5), "fraction": 0.5, "text": "value"}, args)
+}
@@ -0,0 +1,52 @@
+package schema
+
+import (
+	"fmt"
+	"sort"
+)
+
+const (
+	// BackendGo validates with the pure Go implementation, which supports the XSD subset used by the clustercode
+	// schemas.
+	BackendGo = "go"
+	// BackendLibxml validates with libxml2. It is only available in binaries built with the libxml tag.
+	BackendLibxml = "libxml"
+)
+
+type (
+	// compiledSchema validates documents that have been checked to be well-formed. The outline of the document is
+	// passed along, so that backends don't have to parse it again. Violations are returned in document order.
+	compiledSchema interface {
+		validate(xml string, document *element) []Violation
+	}
+	// compiler turns the content of an XSD file into a compiledSchema.
+	compiler func(xsd []byte) (compiledSchema, error)
+)
+
+// DefaultBackend is used by validators that don't specify a backend.
+var DefaultBackend = BackendGo
+
+var backends = map[string]compiler{
+	BackendGo: compileGoSchema,
+}
+
+// Backends returns the names of the backends compiled into the binary.
+func Backends() []string {
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func compilerOf(backend string) (compiler, error) {
+	if backend == "" {
+		backend = DefaultBackend
+	}
+	compile, available := backends[backend]
+	if !available {
+		return nil, fmt.Errorf("schema backend '%s' is not available, choose one of %v", backend, Backends())
+	}
+	return compile, nil
+}
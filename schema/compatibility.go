@@ -0,0 +1,443 @@
+package schema
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+type (
+	// Change is a difference between two schema versions that breaks compatibility in at least one direction.
+	Change struct {
+		// Element is the message element the change affects, e.g. TaskAddedEvent.
+		Element string `json:"element,omitempty"`
+		// Path points to the changed element or attribute, e.g. /SliceCompletedEvent/StdStreams/L/@fd.
+		Path        string `json:"path"`
+		Description string `json:"description"`
+		// Backward is true if messages that are valid against the old schema may be rejected by the new one, which
+		// breaks producers that haven't been updated yet.
+		Backward bool `json:"backward"`
+		// Forward is true if messages that are valid against the new schema may be rejected by the old one, which
+		// breaks consumers that haven't been updated yet.
+		Forward bool `json:"forward"`
+	}
+	// Compatibility lists the changes between two schema versions, ordered by message element.
+	Compatibility struct {
+		Changes []Change `json:"changes"`
+	}
+
+	// comparison collects the changes while walking both schemas.
+	comparison struct {
+		element string
+		changes []Change
+	}
+	// constraints are the facets of a simple type and all the types it restricts.
+	constraints struct {
+		minLength int
+		// maxLength is -1 if unbounded.
+		maxLength    int
+		lower, upper bound
+		// patterns contains one entry per restriction, the alternatives of a restriction are joined with '|'.
+		patterns []string
+		// enumeration is nil if the values are not enumerated.
+		enumeration []string
+	}
+	// bound limits numeric values, value is nil if unbounded.
+	bound struct {
+		value     *big.Rat
+		exclusive bool
+	}
+)
+
+// CompareSchemas compares two versions of a schema. Both have to be supported by the pure Go backend.
+// Whether two different patterns accept the same values is undecidable in practice, so changed patterns are
+// reported as incompatible in both directions.
+func CompareSchemas(before []byte, after []byte) (*Compatibility, error) {
+	beforeSchema, err := parseGoSchema(before)
+	if err != nil {
+		return nil, fmt.Errorf("old schema: %s", err)
+	}
+	afterSchema, err := parseGoSchema(after)
+	if err != nil {
+		return nil, fmt.Errorf("new schema: %s", err)
+	}
+
+	c := &comparison{changes: []Change{}}
+	if beforeSchema.targetNamespace != afterSchema.targetNamespace || beforeSchema.qualified != afterSchema.qualified {
+		c.report("/", true, true, "target namespace changed from '%s' to '%s'",
+			beforeSchema.targetNamespace, afterSchema.targetNamespace)
+	}
+	for _, name := range elementNames(beforeSchema, afterSchema) {
+		c.element = name
+		path := "/" + name
+		beforeDecl, afterDecl := beforeSchema.elements[name], afterSchema.elements[name]
+		switch {
+		case afterDecl == nil:
+			c.report(path, true, false, "message element removed")
+		case beforeDecl == nil:
+			c.report(path, false, true, "message element added")
+		default:
+			c.compareElement(path, beforeDecl, afterDecl)
+		}
+	}
+	return &Compatibility{Changes: c.changes}, nil
+}
+
+// IsBackwardCompatible returns true if the new schema accepts every message the old schema accepts.
+func (c *Compatibility) IsBackwardCompatible() bool {
+	for _, change := range c.Changes {
+		if change.Backward {
+			return false
+		}
+	}
+	return true
+}
+
+// IsForwardCompatible returns true if the old schema accepts every message the new schema accepts.
+func (c *Compatibility) IsForwardCompatible() bool {
+	for _, change := range c.Changes {
+		if change.Forward {
+			return false
+		}
+	}
+	return true
+}
+
+func (c Change) String() string {
+	var directions []string
+	if c.Backward {
+		directions = append(directions, "backward")
+	}
+	if c.Forward {
+		directions = append(directions, "forward")
+	}
+	return fmt.Sprintf("%s: %s (breaks %s compatibility)", c.Path, c.Description, strings.Join(directions, " and "))
+}
+
+func elementNames(before *goSchema, after *goSchema) []string {
+	var names []string
+	for name := range before.elements {
+		names = append(names, name)
+	}
+	for name := range after.elements {
+		if _, exists := before.elements[name]; !exists {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (c *comparison) report(path string, backward bool, forward bool, format string, args ...interface{}) {
+	c.changes = append(c.changes, Change{
+		Element:     c.element,
+		Path:        path,
+		Description: fmt.Sprintf(format, args...),
+		Backward:    backward,
+		Forward:     forward,
+	})
+}
+
+func (c *comparison) compareElement(path string, before *elementDecl, after *elementDecl) {
+	c.compareOccurrences(path, "", before.minOccurs, before.maxOccurs, after.minOccurs, after.maxOccurs)
+	switch {
+	case (before.simple == nil) != (after.simple == nil):
+		c.report(path, true, true, "content changed between simple and complex type")
+	case before.simple != nil:
+		c.compareSimple(path, before.simple, after.simple)
+	default:
+		c.compareComplex(path, before.complex, after.complex)
+	}
+}
+
+// compareOccurrences compares the occurrences of an element or, if subject is set, of a model group.
+func (c *comparison) compareOccurrences(path string, subject string, beforeMin, beforeMax, afterMin, afterMax int) {
+	switch {
+	case afterMin > beforeMin && beforeMin == 0 && subject == "":
+		c.report(path, true, false, "element is now required")
+	case afterMin > beforeMin:
+		c.report(path, true, false, "%sminOccurs raised from %d to %d", subject, beforeMin, afterMin)
+	case afterMin < beforeMin && afterMin == 0 && subject == "":
+		c.report(path, false, true, "element is now optional")
+	case afterMin < beforeMin:
+		c.report(path, false, true, "%sminOccurs lowered from %d to %d", subject, beforeMin, afterMin)
+	}
+	switch {
+	case isTighterMax(afterMax, beforeMax):
+		c.report(path, true, false, "%smaxOccurs lowered from %s to %s", subject, maxString(beforeMax), maxString(afterMax))
+	case isTighterMax(beforeMax, afterMax):
+		c.report(path, false, true, "%smaxOccurs raised from %s to %s", subject, maxString(beforeMax), maxString(afterMax))
+	}
+}
+
+func (c *comparison) compareComplex(path string, before *complexType, after *complexType) {
+	c.compareAttributes(path, before.attributes, after.attributes)
+	if before.mixed != after.mixed {
+		if before.mixed {
+			c.report(path, true, false, "character content is no longer allowed")
+		} else {
+			c.report(path, false, true, "character content is now allowed")
+		}
+	}
+	switch {
+	case (before.content == nil) != (after.content == nil), (before.group == nil) != (after.group == nil):
+		c.report(path, true, true, "content model changed")
+	case before.content != nil:
+		c.compareSimple(path, before.content, after.content)
+	case before.group != nil:
+		c.compareGroup(path, before.group, after.group)
+	}
+}
+
+func (c *comparison) compareAttributes(path string, before []*attributeDecl, after []*attributeDecl) {
+	for _, beforeDecl := range before {
+		attributePath := path + "/@" + beforeDecl.name
+		afterDecl := findAttribute(after, beforeDecl.name)
+		switch {
+		case afterDecl == nil:
+			c.report(attributePath, true, beforeDecl.required, "attribute removed")
+			continue
+		case afterDecl.required && !beforeDecl.required:
+			c.report(attributePath, true, false, "attribute is now required")
+		case beforeDecl.required && !afterDecl.required:
+			c.report(attributePath, false, true, "attribute is now optional")
+		}
+		c.compareSimple(attributePath, beforeDecl.simple, afterDecl.simple)
+	}
+	for _, afterDecl := range after {
+		if findAttribute(before, afterDecl.name) != nil {
+			continue
+		}
+		if afterDecl.required {
+			c.report(path+"/@"+afterDecl.name, true, true, "required attribute added")
+		} else {
+			c.report(path+"/@"+afterDecl.name, false, true, "optional attribute added")
+		}
+	}
+}
+
+func (c *comparison) compareGroup(path string, before *modelGroup, after *modelGroup) {
+	if before.kind != after.kind {
+		c.report(path, true, true, "content model changed from xs:%s to xs:%s", before.kind, after.kind)
+		return
+	}
+	c.compareOccurrences(path, "xs:"+before.kind+" ", before.minOccurs, before.maxOccurs, after.minOccurs, after.maxOccurs)
+	for _, beforeDecl := range before.elements {
+		afterDecl := after.find(beforeDecl.name)
+		if afterDecl == nil {
+			c.report(path+"/"+beforeDecl.name, true, isRequired(before, beforeDecl), "element removed")
+			continue
+		}
+		c.compareElement(path+"/"+beforeDecl.name, beforeDecl, afterDecl)
+	}
+	for _, afterDecl := range after.elements {
+		if before.find(afterDecl.name) != nil {
+			continue
+		}
+		if isRequired(after, afterDecl) {
+			c.report(path+"/"+afterDecl.name, true, true, "required element added")
+		} else {
+			c.report(path+"/"+afterDecl.name, false, true, "optional element added")
+		}
+	}
+	if before.kind == "sequence" && !equalStrings(commonNames(before, after), commonNames(after, before)) {
+		c.report(path, true, true, "order of the child elements changed")
+	}
+}
+
+// isRequired returns true if every valid element contains the child.
+func isRequired(group *modelGroup, decl *elementDecl) bool {
+	return decl.minOccurs > 0 && group.minOccurs > 0 && group.kind != "choice"
+}
+
+// commonNames returns the names of the elements of the group that the other group contains as well, in order.
+func commonNames(group *modelGroup, other *modelGroup) []string {
+	var names []string
+	for _, decl := range group.elements {
+		if other.find(decl.name) != nil {
+			names = append(names, decl.name)
+		}
+	}
+	return names
+}
+
+func (c *comparison) compareSimple(path string, before *simpleType, after *simpleType) {
+	if before.builtin != after.builtin {
+		switch {
+		case before.builtin.numeric && after.builtin.numeric && before.builtin.lexical == after.builtin.lexical:
+			// Integer types only differ by their bounds, which are compared below.
+		case before.builtin.lexical == integerLexical && after.builtin.lexical == decimalLexical:
+			c.report(path, false, true, "type widened from xs:%s to xs:%s", before.builtin.name, after.builtin.name)
+		case before.builtin.lexical == decimalLexical && after.builtin.lexical == integerLexical:
+			c.report(path, true, false, "type narrowed from xs:%s to xs:%s", before.builtin.name, after.builtin.name)
+		default:
+			c.report(path, true, true, "type changed from xs:%s to xs:%s", before.builtin.name, after.builtin.name)
+			return
+		}
+	}
+	b, a := constraintsOf(before), constraintsOf(after)
+
+	switch {
+	case a.minLength > b.minLength:
+		c.report(path, true, false, "minimum length raised from %d to %d", b.minLength, a.minLength)
+	case a.minLength < b.minLength:
+		c.report(path, false, true, "minimum length lowered from %d to %d", b.minLength, a.minLength)
+	}
+	switch {
+	case isTighterMax(a.maxLength, b.maxLength):
+		c.report(path, true, false, "maximum length lowered from %s to %s", maxString(b.maxLength), maxString(a.maxLength))
+	case isTighterMax(b.maxLength, a.maxLength):
+		c.report(path, false, true, "maximum length raised from %s to %s", maxString(b.maxLength), maxString(a.maxLength))
+	}
+
+	switch {
+	case isTighterLower(a.lower, b.lower):
+		c.report(path, true, false, "minimum raised from %s to %s", b.lower.format(">"), a.lower.format(">"))
+	case isTighterLower(b.lower, a.lower):
+		c.report(path, false, true, "minimum lowered from %s to %s", b.lower.format(">"), a.lower.format(">"))
+	}
+	switch {
+	case isTighterUpper(a.upper, b.upper):
+		c.report(path, true, false, "maximum lowered from %s to %s", b.upper.format("<"), a.upper.format("<"))
+	case isTighterUpper(b.upper, a.upper):
+		c.report(path, false, true, "maximum raised from %s to %s", b.upper.format("<"), a.upper.format("<"))
+	}
+
+	switch {
+	case equalStrings(b.patterns, a.patterns):
+	case len(b.patterns) == 0:
+		c.report(path, true, false, "pattern '%s' added", strings.Join(a.patterns, "' and '"))
+	case len(a.patterns) == 0:
+		c.report(path, false, true, "pattern '%s' removed", strings.Join(b.patterns, "' and '"))
+	default:
+		c.report(path, true, true, "pattern changed from '%s' to '%s'",
+			strings.Join(b.patterns, "' and '"), strings.Join(a.patterns, "' and '"))
+	}
+
+	numeric := after.builtin.numeric
+	switch {
+	case b.enumeration == nil && a.enumeration == nil:
+	case b.enumeration == nil:
+		c.report(path, true, false, "values restricted to {'%s'}", strings.Join(a.enumeration, "', '"))
+	case a.enumeration == nil:
+		c.report(path, false, true, "enumeration {'%s'} removed", strings.Join(b.enumeration, "', '"))
+	default:
+		if removed := missingValues(b.enumeration, a.enumeration, numeric); len(removed) > 0 {
+			c.report(path, true, false, "enumeration narrowed, {'%s'} removed", strings.Join(removed, "', '"))
+		}
+		if added := missingValues(a.enumeration, b.enumeration, numeric); len(added) > 0 {
+			c.report(path, false, true, "enumeration widened, {'%s'} added", strings.Join(added, "', '"))
+		}
+	}
+}
+
+func constraintsOf(t *simpleType) *constraints {
+	c := &constraints{
+		maxLength: -1,
+		lower:     bound{value: t.builtin.min},
+		upper:     bound{value: t.builtin.max},
+	}
+	// The loop starts with the most derived type, whose enumeration is the one that applies.
+	for restriction := t; restriction != nil && restriction.base != nil; restriction = restriction.base {
+		f := &restriction.facets
+		for _, length := range []*int{f.length, f.minLength} {
+			if length != nil && *length > c.minLength {
+				c.minLength = *length
+			}
+		}
+		for _, length := range []*int{f.length, f.maxLength} {
+			if length != nil && isTighterMax(*length, c.maxLength) {
+				c.maxLength = *length
+			}
+		}
+		for _, lower := range []bound{{f.minInclusive, false}, {f.minExclusive, true}} {
+			if isTighterLower(lower, c.lower) {
+				c.lower = lower
+			}
+		}
+		for _, upper := range []bound{{f.maxInclusive, false}, {f.maxExclusive, true}} {
+			if isTighterUpper(upper, c.upper) {
+				c.upper = upper
+			}
+		}
+		if len(f.patternSources) > 0 {
+			c.patterns = append(c.patterns, strings.Join(f.patternSources, "|"))
+		}
+		if len(f.enumeration) > 0 && c.enumeration == nil {
+			c.enumeration = f.enumeration
+		}
+	}
+	sort.Strings(c.patterns)
+	return c
+}
+
+// isTighterMax returns true if the maximum a allows less than b, where -1 stands for unbounded.
+func isTighterMax(a int, b int) bool {
+	return a >= 0 && (b < 0 || a < b)
+}
+
+func maxString(max int) string {
+	if max < 0 {
+		return "unbounded"
+	}
+	return fmt.Sprintf("%d", max)
+}
+
+// isTighterLower returns true if the lower bound a excludes values that b allows.
+func isTighterLower(a bound, b bound) bool {
+	if a.value == nil {
+		return false
+	}
+	if b.value == nil {
+		return true
+	}
+	cmp := a.value.Cmp(b.value)
+	return cmp > 0 || cmp == 0 && a.exclusive && !b.exclusive
+}
+
+// isTighterUpper returns true if the upper bound a excludes values that b allows.
+func isTighterUpper(a bound, b bound) bool {
+	if a.value == nil {
+		return false
+	}
+	if b.value == nil {
+		return true
+	}
+	cmp := a.value.Cmp(b.value)
+	return cmp < 0 || cmp == 0 && a.exclusive && !b.exclusive
+}
+
+// format renders the bound with the operator for exclusive bounds, e.g. "> 0" or "<= 255".
+func (b bound) format(exclusive string) string {
+	switch {
+	case b.value == nil:
+		return "unbounded"
+	case b.exclusive:
+		return exclusive + " " + b.value.RatString()
+	}
+	return exclusive + "= " + b.value.RatString()
+}
+
+// missingValues returns the values that the other enumeration does not contain.
+func missingValues(values []string, other []string, numeric bool) []string {
+	var missing []string
+	for _, value := range values {
+		if !isEnumerated(other, value, numeric) {
+			missing = append(missing, value)
+		}
+	}
+	return missing
+}
+
+func equalStrings(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,238 @@
+package schema
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const compatibilityBase = `<xs:schema elementFormDefault="qualified" xmlns:xs="http://www.w3.org/2001/XMLSchema">
+  <xs:simpleType name="filedescriptor">
+    <xs:restriction base="xs:nonNegativeInteger">
+      <xs:enumeration value="0"/>
+      <xs:enumeration value="1"/>
+      <xs:enumeration value="2"/>
+    </xs:restriction>
+  </xs:simpleType>
+  <xs:simpleType name="job_id">
+    <xs:restriction base="xs:string">
+      <xs:pattern value="[0-9a-f]{8}"/>
+    </xs:restriction>
+  </xs:simpleType>
+  <xs:element name="SliceCompletedEvent">
+    <xs:complexType>
+      <xs:sequence>
+        <xs:element name="JobId" type="job_id"/>
+        <xs:element name="SliceNr" type="xs:int"/>
+        <xs:element name="L" minOccurs="0" maxOccurs="unbounded">
+          <xs:complexType>
+            <xs:simpleContent>
+              <xs:extension base="xs:string">
+                <xs:attribute name="fd" type="filedescriptor" use="required"/>
+              </xs:extension>
+            </xs:simpleContent>
+          </xs:complexType>
+        </xs:element>
+      </xs:sequence>
+    </xs:complexType>
+  </xs:element>
+  <xs:element name="TaskCompletedEvent">
+    <xs:complexType>
+      <xs:all>
+        <xs:element name="JobId" type="job_id"/>
+      </xs:all>
+    </xs:complexType>
+  </xs:element>
+</xs:schema>`
+
+var compatibilityTests = []struct {
+	name     string
+	old      string
+	new      string
+	expected []Change
+}{
+	{
+		"Unchanged",
+		`<xs:enumeration value="2"/>`,
+		`<xs:enumeration value="2"/>`,
+		[]Change{},
+	},
+	{
+		"NarrowedEnumeration",
+		`<xs:enumeration value="2"/>`,
+		``,
+		[]Change{{Element: "SliceCompletedEvent", Path: "/SliceCompletedEvent/L/@fd",
+			Description: "enumeration narrowed, {'2'} removed", Backward: true}},
+	},
+	{
+		"WidenedEnumeration",
+		`<xs:enumeration value="2"/>`,
+		`<xs:enumeration value="2"/><xs:enumeration value="3"/>`,
+		[]Change{{Element: "SliceCompletedEvent", Path: "/SliceCompletedEvent/L/@fd",
+			Description: "enumeration widened, {'3'} added", Forward: true}},
+	},
+	{
+		"RaisedMinimumLength",
+		`<xs:pattern value="[0-9a-f]{8}"/>`,
+		`<xs:pattern value="[0-9a-f]{8}"/><xs:minLength value="8"/>`,
+		[]Change{
+			{Element: "SliceCompletedEvent", Path: "/SliceCompletedEvent/JobId",
+				Description: "minimum length raised from 0 to 8", Backward: true},
+			{Element: "TaskCompletedEvent", Path: "/TaskCompletedEvent/JobId",
+				Description: "minimum length raised from 0 to 8", Backward: true},
+		},
+	},
+	{
+		"ChangedPattern",
+		`<xs:pattern value="[0-9a-f]{8}"/>`,
+		`<xs:pattern value="[0-9a-f]{36}"/>`,
+		[]Change{
+			{Element: "SliceCompletedEvent", Path: "/SliceCompletedEvent/JobId",
+				Description: "pattern changed from '[0-9a-f]{8}' to '[0-9a-f]{36}'", Backward: true, Forward: true},
+			{Element: "TaskCompletedEvent", Path: "/TaskCompletedEvent/JobId",
+				Description: "pattern changed from '[0-9a-f]{8}' to '[0-9a-f]{36}'", Backward: true, Forward: true},
+		},
+	},
+	{
+		"RemovedElement",
+		`<xs:element name="SliceNr" type="xs:int"/>`,
+		``,
+		[]Change{{Element: "SliceCompletedEvent", Path: "/SliceCompletedEvent/SliceNr",
+			Description: "element removed", Backward: true, Forward: true}},
+	},
+	{
+		"RequiredElementAdded",
+		`<xs:element name="SliceNr" type="xs:int"/>`,
+		`<xs:element name="SliceNr" type="xs:int"/><xs:element name="Host" type="xs:string"/>`,
+		[]Change{{Element: "SliceCompletedEvent", Path: "/SliceCompletedEvent/Host",
+			Description: "required element added", Backward: true, Forward: true}},
+	},
+	{
+		"OptionalElementAdded",
+		`<xs:element name="SliceNr" type="xs:int"/>`,
+		`<xs:element name="SliceNr" type="xs:int"/><xs:element name="Host" type="xs:string" minOccurs="0"/>`,
+		[]Change{{Element: "SliceCompletedEvent", Path: "/SliceCompletedEvent/Host",
+			Description: "optional element added", Forward: true}},
+	},
+	{
+		"ElementNowRequired",
+		`<xs:element name="L" minOccurs="0" maxOccurs="unbounded">`,
+		`<xs:element name="L" maxOccurs="10">`,
+		[]Change{
+			{Element: "SliceCompletedEvent", Path: "/SliceCompletedEvent/L",
+				Description: "element is now required", Backward: true},
+			{Element: "SliceCompletedEvent", Path: "/SliceCompletedEvent/L",
+				Description: "maxOccurs lowered from unbounded to 10", Backward: true},
+		},
+	},
+	{
+		"WidenedType",
+		`<xs:element name="SliceNr" type="xs:int"/>`,
+		`<xs:element name="SliceNr" type="xs:long"/>`,
+		[]Change{
+			{Element: "SliceCompletedEvent", Path: "/SliceCompletedEvent/SliceNr",
+				Description: "minimum lowered from >= -2147483648 to >= -9223372036854775808", Forward: true},
+			{Element: "SliceCompletedEvent", Path: "/SliceCompletedEvent/SliceNr",
+				Description: "maximum raised from <= 2147483647 to <= 9223372036854775807", Forward: true},
+		},
+	},
+	{
+		"ChangedType",
+		`<xs:element name="SliceNr" type="xs:int"/>`,
+		`<xs:element name="SliceNr" type="xs:string"/>`,
+		[]Change{{Element: "SliceCompletedEvent", Path: "/SliceCompletedEvent/SliceNr",
+			Description: "type changed from xs:int to xs:string", Backward: true, Forward: true}},
+	},
+	{
+		"ReorderedElements",
+		`<xs:element name="JobId" type="job_id"/>
+        <xs:element name="SliceNr" type="xs:int"/>`,
+		`<xs:element name="SliceNr" type="xs:int"/>
+        <xs:element name="JobId" type="job_id"/>`,
+		[]Change{{Element: "SliceCompletedEvent", Path: "/SliceCompletedEvent",
+			Description: "order of the child elements changed", Backward: true, Forward: true}},
+	},
+	{
+		"AttributeNowOptional",
+		`use="required"`,
+		``,
+		[]Change{{Element: "SliceCompletedEvent", Path: "/SliceCompletedEvent/L/@fd",
+			Description: "attribute is now optional", Forward: true}},
+	},
+	{
+		"RemovedMessage",
+		`<xs:element name="TaskCompletedEvent">`,
+		`<xs:element name="TaskCancelledEvent">`,
+		[]Change{
+			{Element: "TaskCancelledEvent", Path: "/TaskCancelledEvent", Description: "message element added", Forward: true},
+			{Element: "TaskCompletedEvent", Path: "/TaskCompletedEvent", Description: "message element removed", Backward: true},
+		},
+	},
+}
+
+func TestCompareSchemas(t *testing.T) {
+	for _, tt := range compatibilityTests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := compatibilityBase
+			after := replaceOnce(t, compatibilityBase, tt.old, tt.new)
+
+			compatibility, err := CompareSchemas([]byte(before), []byte(after))
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, compatibility.Changes)
+		})
+	}
+}
+
+func TestCompareSchemas_ShouldAllowOptionalElementInNewVersion(t *testing.T) {
+	before, err := ioutil.ReadFile(filepath.Join("testdata", "xsd", "event_v1.xsd"))
+	require.NoError(t, err)
+	after, err := ioutil.ReadFile(filepath.Join("testdata", "xsd", "event_v2.xsd"))
+	require.NoError(t, err)
+
+	compatibility, err := CompareSchemas(before, after)
+
+	require.NoError(t, err)
+	assert.True(t, compatibility.IsBackwardCompatible())
+	assert.False(t, compatibility.IsForwardCompatible())
+	assert.Equal(t, "/Event/Priority: optional element added (breaks forward compatibility)",
+		compatibility.Changes[0].String())
+}
+
+func TestCompareSchemas_ShouldRejectUnsupportedSchema(t *testing.T) {
+	_, err := CompareSchemas([]byte(compatibilityBase), []byte(`<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema">
+  <xs:import namespace="urn:other"/>
+</xs:schema>`))
+	assert.Error(t, err)
+}
+
+func TestFiles_CompareLatest(t *testing.T) {
+	files, err := ReadFiles(filepath.Join("testdata", "xsd", "event_v2.xsd"), filepath.Join("testdata", "xsd", "event_v%d.xsd"))
+	require.NoError(t, err)
+
+	previous, compatibility, err := files.CompareLatest()
+
+	require.NoError(t, err)
+	assert.Equal(t, 1, previous.Version)
+	assert.True(t, compatibility.IsBackwardCompatible())
+}
+
+func TestFiles_CompareLatest_WithoutPreviousVersion(t *testing.T) {
+	files, err := ReadFiles(filepath.Join("testdata", "xsd", "event_v1.xsd"), filepath.Join("testdata", "xsd", "event_v%d.xsd"))
+	require.NoError(t, err)
+
+	previous, compatibility, err := files.CompareLatest()
+
+	require.NoError(t, err)
+	assert.Nil(t, previous)
+	assert.Nil(t, compatibility)
+}
+
+func replaceOnce(t *testing.T, s string, old string, new string) string {
+	i := strings.Index(s, old)
+	require.True(t, i >= 0, "test schema does not contain %s", old)
+	return s[:i] + new + s[i+len(old):]
+}
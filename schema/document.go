@@ -0,0 +1,179 @@
+package schema
+
+import (
+	xml2 "encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type (
+	// element is a node of the document outline, which backends validate and which locates violations.
+	element struct {
+		name       xml2.Name
+		attributes []xml2.Attr
+		// text is the character data directly within the element.
+		text     string
+		line     int
+		column   int
+		children []*element
+	}
+	// positionCounter translates byte offsets into lines and columns. Offsets have to be requested in ascending order.
+	positionCounter struct {
+		data   []byte
+		offset int
+		line   int
+		column int
+	}
+)
+
+// outline parses the document into a tree of elements with their positions. Documents that are not well-formed
+// are rejected with a ValidationError pointing to the syntax error, as are documents with content other than
+// whitespace, comments and processing instructions outside of the root element. The returned element is the document
+// node, its only child is the root element.
+func outline(xml string) (*element, error) {
+	decoder := xml2.NewDecoder(strings.NewReader(xml))
+	position := newPositionCounter(xml)
+	document := &element{}
+	stack := []*element{document}
+	for {
+		offset := decoder.InputOffset()
+		token, err := decoder.Token()
+		if err != nil {
+			if syntaxErr, ok := err.(*xml2.SyntaxError); ok {
+				line, column := position.at(decoder.InputOffset())
+				return nil, &ValidationError{Violations: []Violation{{
+					Line:    line,
+					Column:  column,
+					Message: "provided XML string is not well-formed: " + syntaxErr.Msg,
+				}}}
+			}
+			break
+		}
+		current := stack[len(stack)-1]
+		if current == document {
+			if extra := extraContentOffset(document, token); extra >= 0 {
+				line, column := position.at(offset + extra)
+				return nil, &ValidationError{Violations: []Violation{{
+					Line:    line,
+					Column:  column,
+					Message: "provided XML string is not well-formed: extra content outside of the root element",
+				}}}
+			}
+		}
+		switch token := token.(type) {
+		case xml2.StartElement:
+			line, column := position.at(offset)
+			child := &element{name: token.Name, attributes: token.Attr, line: line, column: column}
+			current.children = append(current.children, child)
+			stack = append(stack, child)
+		case xml2.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml2.CharData:
+			current.text += string(token)
+		}
+	}
+	if len(document.children) == 0 {
+		return nil, &ValidationError{Violations: []Violation{{Message: "provided XML string does not contain an element"}}}
+	}
+	return document, nil
+}
+
+// extraContentOffset returns the offset of the content within the token that is not allowed at the document level,
+// or -1 if there is none. Only one element is allowed there, and no text.
+func extraContentOffset(document *element, token xml2.Token) int64 {
+	switch token := token.(type) {
+	case xml2.StartElement:
+		if len(document.children) > 0 {
+			return 0
+		}
+	case xml2.CharData:
+		if i := strings.IndexFunc(string(token), func(r rune) bool { return !strings.ContainsRune(" \t\r\n", r) }); i >= 0 {
+			return int64(i)
+		}
+	}
+	return -1
+}
+
+// version returns the version attribute of the root element, or 0 if there is none. Invalid values are left for
+// the schema to reject.
+func (e *element) version() int {
+	for _, attr := range e.children[0].attributes {
+		if attr.Name.Local == "version" && attr.Name.Space == "" {
+			if version, err := strconv.Atoi(attr.Value); err == nil {
+				return version
+			}
+		}
+	}
+	return 0
+}
+
+// locate returns the line and column of the element the path points to. Attributes are located at their element.
+func (e *element) locate(path string) (int, int) {
+	if i := strings.Index(path, "/@"); i >= 0 {
+		path = path[:i]
+	}
+	var found *element
+	e.walk("", func(elementPath string, el *element) bool {
+		if elementPath == path {
+			found = el
+		}
+		return found == nil
+	})
+	if found == nil {
+		return 0, 0
+	}
+	return found.line, found.column
+}
+
+// walk visits the elements in document order with their paths until visit returns false.
+func (e *element) walk(path string, visit func(path string, el *element) bool) bool {
+	for i, childPath := range e.childPaths(path) {
+		child := e.children[i]
+		if !visit(childPath, child) || !child.walk(childPath, visit) {
+			return false
+		}
+	}
+	return true
+}
+
+// childPaths returns the paths of the children, numbering them only if they have siblings of the same name, the
+// way libxml2 does.
+func (e *element) childPaths(path string) []string {
+	occurrences := make(map[string]int)
+	for _, child := range e.children {
+		occurrences[child.name.Local]++
+	}
+	index := make(map[string]int)
+	paths := make([]string, len(e.children))
+	for i, child := range e.children {
+		name := child.name.Local
+		index[name]++
+		paths[i] = path + "/" + name
+		if occurrences[name] > 1 {
+			paths[i] = fmt.Sprintf("%s[%d]", paths[i], index[name])
+		}
+	}
+	return paths
+}
+
+func newPositionCounter(xml string) *positionCounter {
+	return &positionCounter{data: []byte(xml), line: 1, column: 1}
+}
+
+func (p *positionCounter) at(offset int64) (int, int) {
+	end := int(offset)
+	if end > len(p.data) {
+		end = len(p.data)
+	}
+	for ; p.offset < end; p.offset++ {
+		if p.data[p.offset] == '\n' {
+			p.line++
+			p.column = 1
+		} else if p.data[p.offset]&0xC0 != 0x80 {
+			// Continuation bytes of UTF-8 sequences don't start a new column.
+			p.column++
+		}
+	}
+	return p.line, p.column
+}
@@ -0,0 +1,263 @@
+// Code generated by go run embedded_gen.go; DO NOT EDIT.
+
+package schema
+
+func init() {
+	embeddedSchemas = map[string]string{
+		"clustercode_v1.xsd": "" +
+			"<xs:schema elementFormDefault=\"qualified\" xmlns:xs=\"http://www.w3.org/2001/XMLSchema\">\n" +
+			"\n" +
+			"  <!-- Type definitions -->\n" +
+			"  <xs:complexType name=\"args\">\n" +
+			"    <xs:sequence minOccurs=\"0\" maxOccurs=\"unbounded\">\n" +
+			"      <xs:element name=\"Arg\" type=\"xs:string\"/>\n" +
+			"    </xs:sequence>\n" +
+			"  </xs:complexType>\n" +
+			"\n" +
+			"  <xs:complexType name=\"std_streams\">\n" +
+			"    <!-- This results in following:\n" +
+			"      <StdStreams>\n" +
+			"        <L fd=\"2\">This line is from stderr</Stream>\n" +
+			"        <L fd=\"1\">This line is from stdout</Stream>\n" +
+			"      </StdStreams>\n" +
+			"    -->\n" +
+			"    <xs:sequence minOccurs=\"0\" maxOccurs=\"unbounded\">\n" +
+			"      <xs:element name=\"L\">\n" +
+			"        <xs:complexType>\n" +
+			"          <xs:simpleContent>\n" +
+			"            <xs:extension base=\"xs:string\">\n" +
+			"              <xs:attribute name=\"fd\" type=\"filedescriptor\" use=\"required\"/>\n" +
+			"            </xs:extension>\n" +
+			"          </xs:simpleContent>\n" +
+			"        </xs:complexType>\n" +
+			"      </xs:element>\n" +
+			"    </xs:sequence>\n" +
+			"  </xs:complexType>\n" +
+			"\n" +
+			"  <xs:simpleType name=\"job_id\">\n" +
+			"    <xs:restriction base=\"uuid\">\n" +
+			"      <xs:minLength value=\"36\" />\n" +
+			"    </xs:restriction>\n" +
+			"  </xs:simpleType>\n" +
+			"\n" +
+			"  <!-- Type restrictions -->\n" +
+			"  <xs:simpleType name=\"uuid\">\n" +
+			"    <!-- This results in following:\n" +
+			"      <JobId>620b8251-52a1-4ecd-8adc-4fb280214bba</JobId>\n" +
+			"    -->\n" +
+			"    <xs:restriction base=\"xs:string\">\n" +
+			"      <xs:length value=\"36\" fixed=\"true\"/>\n" +
+			"      <xs:pattern value=\"[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-4[0-9a-fA-F]{3}-[8-9a-bA-B][0-9a-fA-F]{3}-[0-9a-fA-F]{12}\"/>\n" +
+			"    </xs:restriction>\n" +
+			"  </xs:simpleType>\n" +
+			"\n" +
+			"  <xs:simpleType name=\"clustercode_uri\">\n" +
+			"    <!-- This results in following:\n" +
+			"      'clustercode://base_dir:0/subdir/movie.mp4'\n" +
+			"      For more details, see test cases\n" +
+			"      > ATTENTION: XSD regex is quite limited! No non-capturing groups etc. See https://www.regular-expressions.info/xml.html\n" +
+			"    -->\n" +
+			"    <xs:restriction base=\"xs:anyURI\">\n" +
+			"      <xs:pattern value=\"clustercode://[a-zA-Z\\d\\-_.]+(:\\d{0,5})?/.+\"/>\n" +
+			"    </xs:restriction>\n" +
+			"  </xs:simpleType>\n" +
+			"\n" +
+			"  <xs:simpleType name=\"md5hash\">\n" +
+			"    <xs:restriction base=\"xs:string\">\n" +
+			"      <xs:length value=\"32\" fixed=\"true\"/>\n" +
+			"      <xs:pattern value=\"[0-9a-fA-F]{32}\"/>\n" +
+			"    </xs:restriction>\n" +
+			"  </xs:simpleType>\n" +
+			"\n" +
+			"  <xs:simpleType name=\"filedescriptor\">\n" +
+			"    <xs:restriction base=\"xs:nonNegativeInteger\">\n" +
+			"      <xs:enumeration value=\"0\"/>\n" +
+			"      <xs:enumeration value=\"1\"/>\n" +
+			"      <xs:enumeration value=\"2\"/>\n" +
+			"    </xs:restriction>\n" +
+			"  </xs:simpleType>\n" +
+			"\n" +
+			"  <!-- Message definitions -->\n" +
+			"  <xs:element name=\"TaskAddedEvent\">\n" +
+			"    <xs:complexType>\n" +
+			"      <xs:all>\n" +
+			"        <xs:element name=\"JobId\" type=\"job_id\"/>\n" +
+			"        <xs:element name=\"File\" type=\"clustercode_uri\"/>\n" +
+			"        <xs:element name=\"Args\" type=\"args\" minOccurs=\"0\"/>\n" +
+			"        <xs:element name=\"FileHash\" type=\"md5hash\" minOccurs=\"0\"/>\n" +
+			"      </xs:all>\n" +
+			"    </xs:complexType>\n" +
+			"  </xs:element>\n" +
+			"\n" +
+			"  <xs:element name=\"TaskCompletedEvent\">\n" +
+			"    <xs:complexType>\n" +
+			"      <xs:all>\n" +
+			"        <xs:element name=\"JobId\" type=\"job_id\"/>\n" +
+			"      </xs:all>\n" +
+			"    </xs:complexType>\n" +
+			"  </xs:element>\n" +
+			"\n" +
+			"  <!-- For now, this is basically the same as TaskCompletedEvent -->\n" +
+			"  <xs:element name=\"TaskCancelledEvent\">\n" +
+			"    <xs:complexType>\n" +
+			"      <xs:all>\n" +
+			"        <xs:element name=\"JobId\" type=\"job_id\"/>\n" +
+			"      </xs:all>\n" +
+			"    </xs:complexType>\n" +
+			"  </xs:element>\n" +
+			"\n" +
+			"  <xs:element name=\"SliceAddedEvent\">\n" +
+			"    <xs:complexType>\n" +
+			"      <xs:all>\n" +
+			"        <xs:element name=\"JobId\" type=\"job_id\"/>\n" +
+			"        <xs:element name=\"SliceNr\" type=\"xs:nonNegativeInteger\"/>\n" +
+			"        <xs:element name=\"Args\" type=\"args\" minOccurs=\"0\"/>\n" +
+			"      </xs:all>\n" +
+			"      <xs:attribute name=\"version\" type=\"xs:positiveInteger\"/>\n" +
+			"    </xs:complexType>\n" +
+			"  </xs:element>\n" +
+			"\n" +
+			"  <xs:element name=\"SliceCompletedEvent\">\n" +
+			"    <xs:complexType>\n" +
+			"      <xs:all>\n" +
+			"        <xs:element name=\"JobId\" type=\"job_id\"/>\n" +
+			"        <xs:element name=\"SliceNr\" type=\"xs:nonNegativeInteger\"/>\n" +
+			"        <xs:element name=\"StdStreams\" type=\"std_streams\" minOccurs=\"0\"/>\n" +
+			"        <xs:element name=\"FileHash\" type=\"md5hash\" minOccurs=\"0\"/>\n" +
+			"      </xs:all>\n" +
+			"      <xs:attribute name=\"version\" type=\"xs:positiveInteger\"/>\n" +
+			"    </xs:complexType>\n" +
+			"  </xs:element>\n" +
+			"\n" +
+			"</xs:schema>\n",
+		"clustercode_v2.xsd": "" +
+			"<xs:schema elementFormDefault=\"qualified\" xmlns:xs=\"http://www.w3.org/2001/XMLSchema\">\n" +
+			"\n" +
+			"  <!-- Type definitions -->\n" +
+			"  <xs:complexType name=\"args\">\n" +
+			"    <xs:sequence minOccurs=\"0\" maxOccurs=\"unbounded\">\n" +
+			"      <xs:element name=\"Arg\" type=\"xs:string\"/>\n" +
+			"    </xs:sequence>\n" +
+			"  </xs:complexType>\n" +
+			"\n" +
+			"  <xs:complexType name=\"std_streams\">\n" +
+			"    <!-- This results in following:\n" +
+			"      <StdStreams>\n" +
+			"        <L fd=\"2\">This line is from stderr</Stream>\n" +
+			"        <L fd=\"1\">This line is from stdout</Stream>\n" +
+			"      </StdStreams>\n" +
+			"    -->\n" +
+			"    <xs:sequence minOccurs=\"0\" maxOccurs=\"unbounded\">\n" +
+			"      <xs:element name=\"L\">\n" +
+			"        <xs:complexType>\n" +
+			"          <xs:simpleContent>\n" +
+			"            <xs:extension base=\"xs:string\">\n" +
+			"              <xs:attribute name=\"fd\" type=\"filedescriptor\" use=\"required\"/>\n" +
+			"            </xs:extension>\n" +
+			"          </xs:simpleContent>\n" +
+			"        </xs:complexType>\n" +
+			"      </xs:element>\n" +
+			"    </xs:sequence>\n" +
+			"  </xs:complexType>\n" +
+			"\n" +
+			"  <xs:simpleType name=\"job_id\">\n" +
+			"    <xs:restriction base=\"uuid\">\n" +
+			"      <xs:minLength value=\"36\" />\n" +
+			"    </xs:restriction>\n" +
+			"  </xs:simpleType>\n" +
+			"\n" +
+			"  <!-- Type restrictions -->\n" +
+			"  <xs:simpleType name=\"uuid\">\n" +
+			"    <!-- This results in following:\n" +
+			"      <JobId>620b8251-52a1-4ecd-8adc-4fb280214bba</JobId>\n" +
+			"    -->\n" +
+			"    <xs:restriction base=\"xs:string\">\n" +
+			"      <xs:length value=\"36\" fixed=\"true\"/>\n" +
+			"      <xs:pattern value=\"[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-4[0-9a-fA-F]{3}-[8-9a-bA-B][0-9a-fA-F]{3}-[0-9a-fA-F]{12}\"/>\n" +
+			"    </xs:restriction>\n" +
+			"  </xs:simpleType>\n" +
+			"\n" +
+			"  <xs:simpleType name=\"clustercode_uri\">\n" +
+			"    <!-- This results in following:\n" +
+			"      'clustercode://base_dir:0/subdir/movie.mp4'\n" +
+			"      For more details, see test cases\n" +
+			"      > ATTENTION: XSD regex is quite limited! No non-capturing groups etc. See https://www.regular-expressions.info/xml.html\n" +
+			"    -->\n" +
+			"    <xs:restriction base=\"xs:anyURI\">\n" +
+			"      <xs:pattern value=\"clustercode://[a-zA-Z\\d\\-_.]+(:\\d{0,5})?/.+\"/>\n" +
+			"    </xs:restriction>\n" +
+			"  </xs:simpleType>\n" +
+			"\n" +
+			"  <xs:simpleType name=\"md5hash\">\n" +
+			"    <xs:restriction base=\"xs:string\">\n" +
+			"      <xs:length value=\"32\" fixed=\"true\"/>\n" +
+			"      <xs:pattern value=\"[0-9a-fA-F]{32}\"/>\n" +
+			"    </xs:restriction>\n" +
+			"  </xs:simpleType>\n" +
+			"\n" +
+			"  <xs:simpleType name=\"filedescriptor\">\n" +
+			"    <xs:restriction base=\"xs:nonNegativeInteger\">\n" +
+			"      <xs:enumeration value=\"0\"/>\n" +
+			"      <xs:enumeration value=\"1\"/>\n" +
+			"      <xs:enumeration value=\"2\"/>\n" +
+			"    </xs:restriction>\n" +
+			"  </xs:simpleType>\n" +
+			"\n" +
+			"  <!-- Message definitions -->\n" +
+			"  <xs:element name=\"TaskAddedEvent\">\n" +
+			"    <xs:complexType>\n" +
+			"      <xs:all>\n" +
+			"        <xs:element name=\"JobId\" type=\"job_id\"/>\n" +
+			"        <xs:element name=\"File\" type=\"clustercode_uri\"/>\n" +
+			"        <!-- Since version 2 -->\n" +
+			"        <xs:element name=\"SliceSize\" type=\"xs:positiveInteger\" minOccurs=\"0\"/>\n" +
+			"        <xs:element name=\"Args\" type=\"args\" minOccurs=\"0\"/>\n" +
+			"        <xs:element name=\"FileHash\" type=\"md5hash\" minOccurs=\"0\"/>\n" +
+			"      </xs:all>\n" +
+			"      <xs:attribute name=\"version\" type=\"xs:positiveInteger\"/>\n" +
+			"    </xs:complexType>\n" +
+			"  </xs:element>\n" +
+			"\n" +
+			"  <xs:element name=\"TaskCompletedEvent\">\n" +
+			"    <xs:complexType>\n" +
+			"      <xs:all>\n" +
+			"        <xs:element name=\"JobId\" type=\"job_id\"/>\n" +
+			"      </xs:all>\n" +
+			"    </xs:complexType>\n" +
+			"  </xs:element>\n" +
+			"\n" +
+			"  <!-- For now, this is basically the same as TaskCompletedEvent -->\n" +
+			"  <xs:element name=\"TaskCancelledEvent\">\n" +
+			"    <xs:complexType>\n" +
+			"      <xs:all>\n" +
+			"        <xs:element name=\"JobId\" type=\"job_id\"/>\n" +
+			"      </xs:all>\n" +
+			"    </xs:complexType>\n" +
+			"  </xs:element>\n" +
+			"\n" +
+			"  <xs:element name=\"SliceAddedEvent\">\n" +
+			"    <xs:complexType>\n" +
+			"      <xs:all>\n" +
+			"        <xs:element name=\"JobId\" type=\"job_id\"/>\n" +
+			"        <xs:element name=\"SliceNr\" type=\"xs:nonNegativeInteger\"/>\n" +
+			"        <xs:element name=\"Args\" type=\"args\" minOccurs=\"0\"/>\n" +
+			"      </xs:all>\n" +
+			"      <xs:attribute name=\"version\" type=\"xs:positiveInteger\"/>\n" +
+			"    </xs:complexType>\n" +
+			"  </xs:element>\n" +
+			"\n" +
+			"  <xs:element name=\"SliceCompletedEvent\">\n" +
+			"    <xs:complexType>\n" +
+			"      <xs:all>\n" +
+			"        <xs:element name=\"JobId\" type=\"job_id\"/>\n" +
+			"        <xs:element name=\"SliceNr\" type=\"xs:nonNegativeInteger\"/>\n" +
+			"        <xs:element name=\"StdStreams\" type=\"std_streams\" minOccurs=\"0\"/>\n" +
+			"        <xs:element name=\"FileHash\" type=\"md5hash\" minOccurs=\"0\"/>\n" +
+			"      </xs:all>\n" +
+			"      <xs:attribute name=\"version\" type=\"xs:positiveInteger\"/>\n" +
+			"    </xs:complexType>\n" +
+			"  </xs:element>\n" +
+			"\n" +
+			"</xs:schema>\n",
+	}
+}
@@ -0,0 +1,61 @@
+//go:build ignore
+// +build ignore
+
+// This program generates embedded.go, which compiles the schemas of this package into the binary.
+// Run it with "go generate ./schema" whenever a schema is added or changed.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+func main() {
+	paths, err := filepath.Glob("clustercode_v*.xsd")
+	if err != nil {
+		log.Fatal(err)
+	}
+	buffer := &bytes.Buffer{}
+	fmt.Fprintln(buffer, "// Code generated by go run embedded_gen.go; DO NOT EDIT.")
+	fmt.Fprintln(buffer)
+	fmt.Fprintln(buffer, "package schema")
+	fmt.Fprintln(buffer)
+	fmt.Fprintln(buffer, "func init() {")
+	fmt.Fprintln(buffer, "embeddedSchemas = map[string]string{")
+	for _, path := range paths {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Fprintf(buffer, "%q: \"\" +\n", filepath.Base(path))
+		lines := strings.SplitAfter(string(content), "\n")
+		for i, line := range lines {
+			if line == "" {
+				continue
+			}
+			fmt.Fprint(buffer, strconv.Quote(line))
+			if i < len(lines)-1 && lines[i+1] != "" {
+				fmt.Fprint(buffer, " +")
+			} else {
+				fmt.Fprint(buffer, ",")
+			}
+			fmt.Fprintln(buffer)
+		}
+	}
+	fmt.Fprintln(buffer, "}")
+	fmt.Fprintln(buffer, "}")
+
+	source, err := format.Source(buffer.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile("embedded.go", source, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
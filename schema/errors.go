@@ -0,0 +1,65 @@
+package schema
+
+import (
+	"fmt"
+	"strings"
+)
+
+type (
+	// ValidationError lists the reasons why a message was rejected by the schema.
+	ValidationError struct {
+		Violations []Violation
+	}
+	// Violation is a single reason why a message was rejected. The path has the form of an XPath expression like
+	// /SliceCompletedEvent/StdStreams/L[2]/@fd. Line and column are 1-based and 0 if unknown.
+	Violation struct {
+		Path    string `json:"path,omitempty"`
+		Line    int    `json:"line,omitempty"`
+		Column  int    `json:"column,omitempty"`
+		Facet   string `json:"facet,omitempty"`
+		Value   string `json:"value,omitempty"`
+		Message string `json:"message"`
+	}
+)
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, violation := range e.Violations {
+		messages[i] = violation.String()
+	}
+	return strings.Join(messages, "\n")
+}
+
+// Details returns the violations, which are added to the headers of dead-lettered messages.
+func (e *ValidationError) Details() interface{} {
+	return e.Violations
+}
+
+func (v Violation) String() string {
+	location := v.Path
+	if v.Line > 0 && v.Path == "" {
+		location = fmt.Sprintf("line %d, column %d", v.Line, v.Column)
+	} else if v.Line > 0 {
+		location = fmt.Sprintf("%s (line %d, column %d)", v.Path, v.Line, v.Column)
+	}
+	if location == "" {
+		return v.Message
+	}
+	return location + ": " + v.Message
+}
+
+// add appends the violation, unless it only repeats the previous one: libxml2 reports a failing facet and then
+// again that the value is not valid for the type. Other violations of the same element are kept.
+func (e *ValidationError) add(violation Violation) {
+	if n := len(e.Violations); n > 0 && violation.repeats(e.Violations[n-1]) {
+		return
+	}
+	e.Violations = append(e.Violations, violation)
+}
+
+// repeats returns true if the violation rejects the same value of the same node for the same facet, or for no
+// facet in particular.
+func (v Violation) repeats(previous Violation) bool {
+	return v.Path != "" && v.Path == previous.Path && v.Value != "" && v.Value == previous.Value &&
+		(v.Facet == "" || v.Facet == previous.Facet)
+}
@@ -0,0 +1,155 @@
+package schema
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+var violationTests = []struct {
+	name     string
+	xml      string
+	expected []Violation
+}{
+	{
+		name: "AttributeOfRepeatedElement",
+		xml: "<SliceCompletedEvent>\n" +
+			"  <JobId>620b8251-52a1-4ecd-8adc-4fb280214bba</JobId>\n" +
+			"  <SliceNr>1</SliceNr>\n" +
+			"  <StdStreams>\n" +
+			"    <L fd=\"1\">first</L>\n" +
+			"    <L fd=\"3\">second</L>\n" +
+			"  </StdStreams>\n" +
+			"</SliceCompletedEvent>",
+		expected: []Violation{{
+			Path:    "/SliceCompletedEvent/StdStreams/L[2]/@fd",
+			Line:    6,
+			Column:  5,
+			Facet:   "enumeration",
+			Value:   "3",
+			Message: "Element 'L', attribute 'fd': [facet 'enumeration'] The value '3' is not an element of the set {'0', '1', '2'}.",
+		}},
+	},
+	{
+		name: "PatternOfElement",
+		xml:  "<TaskAddedEvent><JobId>620b8251-52a1-4ecd-8adc-4fb280214bba</JobId><File>movie.mp4</File></TaskAddedEvent>",
+		expected: []Violation{{
+			Path:    "/TaskAddedEvent/File",
+			Line:    1,
+			Column:  68,
+			Facet:   "pattern",
+			Value:   "movie.mp4",
+			Message: "Element 'File': [facet 'pattern'] The value 'movie.mp4' is not accepted by the pattern 'clustercode://[a-zA-Z\\d\\-_.]+(:\\d{0,5})?/.+'.",
+		}},
+	},
+	{
+		name: "PatternOfValueWithQuote",
+		xml:  "<TaskAddedEvent><JobId>620b8251-52a1-4ecd-8adc-4fb280214bba</JobId><File>it's.mp4</File></TaskAddedEvent>",
+		expected: []Violation{{
+			Path:    "/TaskAddedEvent/File",
+			Line:    1,
+			Column:  68,
+			Facet:   "pattern",
+			Value:   "it's.mp4",
+			Message: "Element 'File': [facet 'pattern'] The value 'it's.mp4' is not accepted by the pattern 'clustercode://[a-zA-Z\\d\\-_.]+(:\\d{0,5})?/.+'.",
+		}},
+	},
+	{
+		name: "MissingChild",
+		xml:  "<TaskCancelledEvent/>",
+		expected: []Violation{{
+			Path:    "/TaskCancelledEvent",
+			Line:    1,
+			Column:  1,
+			Message: "Element 'TaskCancelledEvent': Missing child element(s). Expected is ( JobId ).",
+		}},
+	},
+	{
+		name: "NotWellFormed",
+		xml:  "<TaskCancelledEvent>\n<JobId>",
+		expected: []Violation{{
+			Line:    2,
+			Column:  8,
+			Message: "provided XML string is not well-formed: unexpected EOF",
+		}},
+	},
+	{
+		name: "SecondRootElement",
+		xml:  "<TaskCancelledEvent><JobId>620b8251-52a1-4ecd-8adc-4fb280214bba</JobId></TaskCancelledEvent><x/>",
+		expected: []Violation{{
+			Line:    1,
+			Column:  93,
+			Message: "provided XML string is not well-formed: extra content outside of the root element",
+		}},
+	},
+	{
+		name: "TextAfterRootElement",
+		xml:  "<TaskCancelledEvent><JobId>620b8251-52a1-4ecd-8adc-4fb280214bba</JobId></TaskCancelledEvent>\n trailing",
+		expected: []Violation{{
+			Line:    2,
+			Column:  2,
+			Message: "provided XML string is not well-formed: extra content outside of the root element",
+		}},
+	},
+	{
+		name: "TextBeforeRootElement",
+		xml:  "leading<TaskCancelledEvent><JobId>620b8251-52a1-4ecd-8adc-4fb280214bba</JobId></TaskCancelledEvent>",
+		expected: []Violation{{
+			Line:    1,
+			Column:  1,
+			Message: "provided XML string is not well-formed: extra content outside of the root element",
+		}},
+	},
+}
+
+func TestValidateXml_ShouldAllowMiscOutsideRootElement(t *testing.T) {
+	xml := "<?xml version=\"1.0\"?>\n<!-- cancelled -->\n" +
+		"<TaskCancelledEvent><JobId>620b8251-52a1-4ecd-8adc-4fb280214bba</JobId></TaskCancelledEvent>\n<!-- end -->\n"
+	for _, backend := range Backends() {
+		v := &Validator{Backend: backend}
+		v.LoadXmlSchema("clustercode_v1.xsd")
+		t.Run(backend, func(t *testing.T) {
+			valid, err := v.ValidateXml(&xml)
+			assert.NoError(t, err)
+			assert.True(t, valid)
+		})
+	}
+}
+
+func TestValidateXml_ShouldReportViolations(t *testing.T) {
+	for _, backend := range Backends() {
+		v := &Validator{Backend: backend}
+		v.LoadXmlSchema("clustercode_v1.xsd")
+		for _, tt := range violationTests {
+			t.Run(backend+"/"+tt.name, func(t *testing.T) {
+				valid, err := v.ValidateXml(&tt.xml)
+				assert.False(t, valid)
+				require.IsType(t, &ValidationError{}, err)
+				assert.Equal(t, tt.expected, err.(*ValidationError).Violations)
+			})
+		}
+	}
+}
+
+func TestValidationError_ShouldKeepDistinctViolationsOfAnElement(t *testing.T) {
+	err := &ValidationError{}
+	err.add(Violation{Path: "/A/@b", Facet: "pattern", Value: "x", Message: "pattern"})
+	err.add(Violation{Path: "/A/@b", Value: "x", Message: "repeated for the type"})
+	err.add(Violation{Path: "/A/@b", Facet: "maxLength", Value: "x", Message: "length"})
+	err.add(Violation{Path: "/A", Message: "missing child"})
+	err.add(Violation{Path: "/A", Message: "missing attribute"})
+
+	assert.Equal(t, []Violation{
+		{Path: "/A/@b", Facet: "pattern", Value: "x", Message: "pattern"},
+		{Path: "/A/@b", Facet: "maxLength", Value: "x", Message: "length"},
+		{Path: "/A", Message: "missing child"},
+		{Path: "/A", Message: "missing attribute"},
+	}, err.Violations)
+}
+
+func TestViolation_String(t *testing.T) {
+	assert.Equal(t, "/A/@b (line 2, column 3): invalid",
+		Violation{Path: "/A/@b", Line: 2, Column: 3, Message: "invalid"}.String())
+	assert.Equal(t, "line 2, column 3: invalid", Violation{Line: 2, Column: 3, Message: "invalid"}.String())
+	assert.Equal(t, "invalid", Violation{Message: "invalid"}.String())
+}
@@ -0,0 +1,159 @@
+package schema
+
+//go:generate go run embedded_gen.go
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+type (
+	// File is the source of a schema version, as it is compiled and served to clients.
+	File struct {
+		// Version is 0 for a latest schema whose path does not match the file pattern.
+		Version int
+		Name    string
+		Content []byte
+		// Digest is the hex encoded SHA-256 digest of the content.
+		Digest string
+		// ModTime is zero for embedded schemas.
+		ModTime time.Time
+	}
+	// Files are the schema versions of the gateway and the latest schema, which validates messages that do not
+	// declare a version.
+	Files struct {
+		Latest   *File
+		versions map[int]*File
+	}
+)
+
+// embeddedSchemas are the schemas of this package by file name, see embedded.go.
+var embeddedSchemas map[string]string
+
+// ReadFiles reads the latest schema from the given path and every version matching the file pattern, which
+// contains a single %d placeholder for the version, e.g. "schema/clustercode_v%d.xsd". If latest is empty, only
+// the versions are read.
+func ReadFiles(latest string, pattern string) (*Files, error) {
+	versions, err := readVersions(pattern)
+	if err != nil {
+		return nil, err
+	}
+	files := &Files{versions: versions}
+	if latest == "" {
+		return files, nil
+	}
+	version, _ := versionOfPath(pattern, latest)
+	if files.Latest, err = readFile(latest, version); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// EmbeddedFiles is like ReadFiles, but takes the schemas that were compiled into the binary. Only the file names
+// of the paths are considered, so the gateway does not depend on its working directory.
+func EmbeddedFiles(latest string, pattern string) (*Files, error) {
+	pattern, latest = filepath.Base(pattern), filepath.Base(latest)
+	files := &Files{versions: make(map[int]*File)}
+	for name, content := range embeddedSchemas {
+		if version, ok := versionOfPath(pattern, name); ok {
+			files.versions[version] = newFile(name, version, []byte(content), time.Time{})
+		}
+	}
+	content, embedded := embeddedSchemas[latest]
+	if !embedded {
+		return nil, fmt.Errorf("schema %s is not embedded", latest)
+	}
+	version, _ := versionOfPath(pattern, latest)
+	files.Latest = newFile(latest, version, []byte(content), time.Time{})
+	return files, nil
+}
+
+// readVersions reads every version matching the file pattern.
+func readVersions(pattern string) (map[int]*File, error) {
+	paths, err := filepath.Glob(strings.Replace(pattern, "%d", "*", 1))
+	if err != nil {
+		return nil, err
+	}
+	versions := make(map[int]*File)
+	for _, path := range paths {
+		if version, ok := versionOfPath(pattern, path); ok {
+			if versions[version], err = readFile(path, version); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return versions, nil
+}
+
+func readFile(path string, version int) (*File, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return newFile(filepath.Base(path), version, content, info.ModTime()), nil
+}
+
+func newFile(name string, version int, content []byte, modTime time.Time) *File {
+	digest := sha256.Sum256(content)
+	return &File{
+		Version: version,
+		Name:    name,
+		Content: content,
+		Digest:  hex.EncodeToString(digest[:]),
+		ModTime: modTime,
+	}
+}
+
+// Versions returns the versions in ascending order.
+func (f *Files) Versions() []int {
+	versions := make([]int, 0, len(f.versions))
+	for version := range f.versions {
+		versions = append(versions, version)
+	}
+	sort.Ints(versions)
+	return versions
+}
+
+// Version returns the schema of the given version.
+func (f *Files) Version(version int) (*File, bool) {
+	file, exists := f.versions[version]
+	return file, exists
+}
+
+// IsLatest returns true if the file has the same content as the latest schema.
+func (f *Files) IsLatest(file *File) bool {
+	return f.Latest != nil && f.Latest.Digest == file.Digest
+}
+
+// CompareLatest compares the latest schema with the highest version below it, or with the highest version that
+// differs from it if the version of the latest schema is unknown. Since messages that don't declare a version are
+// validated against the latest schema, producers that don't declare one break unless it is backward compatible.
+// The returned file is nil if there is no version to compare with.
+func (f *Files) CompareLatest() (*File, *Compatibility, error) {
+	if f.Latest == nil {
+		return nil, nil, nil
+	}
+	var previous *File
+	for _, version := range f.Versions() {
+		file := f.versions[version]
+		if f.Latest.Version > 0 && version < f.Latest.Version || f.Latest.Version == 0 && !f.IsLatest(file) {
+			previous = file
+		}
+	}
+	if previous == nil {
+		return nil, nil, nil
+	}
+	compatibility, err := CompareSchemas(previous.Content, f.Latest.Content)
+	return previous, compatibility, err
+}
@@ -0,0 +1,49 @@
+package schema
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestReadFiles(t *testing.T) {
+	files, err := ReadFiles("testdata/xsd/event_v1.xsd", "testdata/xsd/event_v%d.xsd")
+	require.NoError(t, err)
+
+	assert.Equal(t, []int{1, 2}, files.Versions())
+	assert.Equal(t, 1, files.Latest.Version)
+	assert.Equal(t, "event_v1.xsd", files.Latest.Name)
+	v1, _ := files.Version(1)
+	v2, _ := files.Version(2)
+	assert.True(t, files.IsLatest(v1))
+	assert.False(t, files.IsLatest(v2))
+	assert.Len(t, v1.Digest, 64)
+	assert.False(t, v1.ModTime.IsZero())
+}
+
+func TestReadFiles_ShouldFailWithoutLatest(t *testing.T) {
+	_, err := ReadFiles("testdata/xsd/missing.xsd", "testdata/xsd/event_v%d.xsd")
+	assert.Error(t, err)
+}
+
+// Fails if embedded.go is outdated, run "go generate ./schema" to update it.
+func TestEmbeddedFiles_ShouldMatchFiles(t *testing.T) {
+	read, err := ReadFiles("clustercode_v1.xsd", "clustercode_v%d.xsd")
+	require.NoError(t, err)
+	embedded, err := EmbeddedFiles("schema/clustercode_v1.xsd", "schema/clustercode_v%d.xsd")
+	require.NoError(t, err)
+
+	assert.Equal(t, read.Versions(), embedded.Versions())
+	for _, version := range read.Versions() {
+		expected, _ := read.Version(version)
+		actual, _ := embedded.Version(version)
+		assert.Equal(t, expected.Digest, actual.Digest)
+	}
+	assert.Equal(t, read.Latest.Digest, embedded.Latest.Digest)
+	assert.True(t, embedded.Latest.ModTime.IsZero())
+}
+
+func TestEmbeddedFiles_ShouldFailWithoutLatest(t *testing.T) {
+	_, err := EmbeddedFiles("schema/clustercode_v99.xsd", "schema/clustercode_v%d.xsd")
+	assert.Error(t, err)
+}
@@ -0,0 +1,149 @@
+//go:build libxml
+// +build libxml
+
+package schema
+
+/*
+#cgo pkg-config: libxml-2.0
+#include <stdlib.h>
+#include <string.h>
+#include <libxml/tree.h>
+#include <libxml/xmlschemas.h>
+
+void collectViolation(void *ctx, xmlErrorPtr err); // Implemented in Go.
+
+static void setViolationHandler(xmlSchemaValidCtxtPtr ctxt, void *ctx) {
+	xmlSchemaSetValidStructuredErrors(ctxt, (xmlStructuredErrorFunc) collectViolation, ctx);
+}
+
+// nodePath returns the path of the node, which has to be released with free.
+static char *nodePath(void *node) {
+	if (node == NULL) {
+		return NULL;
+	}
+	xmlChar *path = xmlGetNodePath((xmlNodePtr) node);
+	if (path == NULL) {
+		return NULL;
+	}
+	char *copy = strdup((const char *) path);
+	xmlFree(path);
+	return copy;
+}
+*/
+import "C"
+
+import (
+	"github.com/jbussdieker/golibxml"
+	"github.com/krolaw/xsd"
+	"regexp"
+	"strings"
+	"sync"
+	"unsafe"
+)
+
+// libxml2 reports violations as plain messages, so the facet, value and attribute are parsed from them. Values
+// may contain quotes, hence the patterns match up to the text that follows the value.
+var (
+	facetPattern     = regexp.MustCompile(`\[facet '([^']*)'\]`)
+	valuePattern     = regexp.MustCompile(`(?:The value '(.*?)' (?:has a length|is not|is less|is greater|must be)|: '(.*?)' is not a valid value)`)
+	attributePattern = regexp.MustCompile(`^Element '[^']*', attribute '([^']*)'`)
+)
+
+type (
+	libxmlSchema struct {
+		schema *xsd.Schema
+	}
+	// rawViolation is what libxml2 reports. The node is only valid as long as the document is.
+	rawViolation struct {
+		node    unsafe.Pointer
+		message string
+	}
+)
+
+var (
+	// C code must not keep Go pointers, so validations are identified by C allocated handles.
+	validations      = make(map[unsafe.Pointer]*[]rawViolation)
+	validationsMutex = &sync.Mutex{}
+)
+
+func init() {
+	backends[BackendLibxml] = compileLibxmlSchema
+}
+
+func compileLibxmlSchema(data []byte) (compiledSchema, error) {
+	xsdSchema, err := xsd.ParseSchema(data)
+	if err != nil {
+		return nil, err
+	}
+	return &libxmlSchema{schema: xsdSchema}, nil
+}
+
+// validate validates the document with libxml2 and returns the violations with their node paths.
+func (s *libxmlSchema) validate(xml string, document *element) []Violation {
+	doc := golibxml.ParseDoc(xml)
+	if doc == nil {
+		return []Violation{{Message: "provided XML string does not seem to be valid XML"}}
+	}
+	defer doc.Free()
+
+	ctxt := C.xmlSchemaNewValidCtxt(C.xmlSchemaPtr(unsafe.Pointer(s.schema.Ptr)))
+	if ctxt == nil {
+		return []Violation{{Message: "could not build validator"}}
+	}
+	defer C.xmlSchemaFreeValidCtxt(ctxt)
+
+	handle := C.malloc(1)
+	defer C.free(handle)
+	var raw []rawViolation
+	validationsMutex.Lock()
+	validations[handle] = &raw
+	validationsMutex.Unlock()
+	defer func() {
+		validationsMutex.Lock()
+		delete(validations, handle)
+		validationsMutex.Unlock()
+	}()
+
+	C.setViolationHandler(ctxt, handle)
+	// golibxml._Ctype_xmlDocPtr can't be cast to C.xmlDocPtr of this package, even though they are both
+	// essentially _Ctype_xmlDocPtr.  Using unsafe gets around this.
+	if C.xmlSchemaValidateDoc(ctxt, C.xmlDocPtr(unsafe.Pointer(doc.Ptr))) == 0 {
+		return nil
+	}
+	violations := make([]Violation, len(raw))
+	for i, r := range raw {
+		violations[i] = newViolation(nodePath(r.node), r.message)
+	}
+	if len(violations) == 0 {
+		violations = append(violations, Violation{Message: "document is not valid"})
+	}
+	return violations
+}
+
+func nodePath(node unsafe.Pointer) string {
+	path := C.nodePath(node)
+	if path == nil {
+		return ""
+	}
+	defer C.free(unsafe.Pointer(path))
+	return C.GoString(path)
+}
+
+// newViolation extracts the facet and the offending value from a libxml2 message. Violations of attributes are
+// reported for their element, so the attribute is added to the path.
+func newViolation(path string, message string) Violation {
+	violation := Violation{
+		Path:    path,
+		Message: strings.TrimSpace(message),
+	}
+	if match := attributePattern.FindStringSubmatch(message); match != nil && path != "" && !strings.Contains(path, "/@") {
+		violation.Path = path + "/@" + match[1]
+	}
+	if match := facetPattern.FindStringSubmatch(message); match != nil {
+		violation.Facet = match[1]
+	}
+	if match := valuePattern.FindStringSubmatch(message); match != nil {
+		violation.Value = match[1] + match[2]
+	}
+	return violation
+}
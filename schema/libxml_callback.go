@@ -0,0 +1,27 @@
+//go:build libxml
+// +build libxml
+
+package schema
+
+/*
+#include <libxml/xmlerror.h>
+*/
+import "C"
+
+import (
+	"unsafe"
+)
+
+//export collectViolation
+func collectViolation(ctx unsafe.Pointer, err C.xmlErrorPtr) {
+	validationsMutex.Lock()
+	raw, ok := validations[ctx]
+	validationsMutex.Unlock()
+	if !ok || err == nil {
+		return
+	}
+	*raw = append(*raw, rawViolation{
+		node:    err.node,
+		message: C.GoString(err.message),
+	})
+}
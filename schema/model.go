@@ -0,0 +1,180 @@
+package schema
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strings"
+)
+
+type (
+	// Declaration describes an element or attribute of a schema, so that code can be generated from it.
+	Declaration struct {
+		Name string
+		// TypeName is the name of a named complex type, empty for anonymous and simple types.
+		TypeName string
+		// Type is the built-in type of the simple content, e.g. "string" or "nonNegativeInteger". It is empty for
+		// elements without simple content.
+		Type string
+		// Optional is true if valid messages may omit the element or attribute.
+		Optional bool
+		// Repeated is true if the element may occur more than once.
+		Repeated bool
+		// Sample is a valid value of the simple content.
+		Sample     string
+		Attributes []Declaration
+		Children   []Declaration
+	}
+)
+
+// Describe returns the global elements of the schema ordered by name. The schema has to be supported by the pure
+// Go backend, elements with mixed content are not supported.
+func Describe(xsd []byte) ([]Declaration, error) {
+	s, err := parseGoSchema(xsd)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(s.elements))
+	for name := range s.elements {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	declarations := make([]Declaration, len(names))
+	for i, name := range names {
+		if declarations[i], err = describeElement(s.elements[name], false, false); err != nil {
+			return nil, err
+		}
+	}
+	return declarations, nil
+}
+
+// describeElement describes the element, which is optional or repeated as well if its model group is.
+func describeElement(decl *elementDecl, optional bool, repeated bool) (Declaration, error) {
+	d := Declaration{
+		Name:     decl.name,
+		Optional: optional || decl.minOccurs == 0,
+		Repeated: repeated || decl.maxOccurs != 1,
+	}
+	if decl.simple != nil {
+		return d, d.describeSimple(decl.simple)
+	}
+	t := decl.complex
+	if t.mixed {
+		return d, fmt.Errorf("element '%s': mixed content is not supported", decl.name)
+	}
+	d.TypeName = t.name
+	for _, attr := range t.attributes {
+		attribute := Declaration{Name: attr.name, Optional: !attr.required}
+		if err := attribute.describeSimple(attr.simple); err != nil {
+			return d, fmt.Errorf("element '%s': %s", decl.name, err)
+		}
+		d.Attributes = append(d.Attributes, attribute)
+	}
+	if t.content != nil {
+		return d, d.describeSimple(t.content)
+	}
+	if t.group != nil {
+		optional := t.group.minOccurs == 0 || t.group.kind == "choice"
+		repeated := t.group.maxOccurs != 1
+		for _, child := range t.group.elements {
+			childDeclaration, err := describeElement(child, optional, repeated)
+			if err != nil {
+				return d, fmt.Errorf("element '%s': %s", decl.name, err)
+			}
+			d.Children = append(d.Children, childDeclaration)
+		}
+	}
+	return d, nil
+}
+
+func (d *Declaration) describeSimple(t *simpleType) error {
+	d.Type = t.builtin.name
+	sample, err := sampleOf(t)
+	if err != nil {
+		return fmt.Errorf("'%s': %s", d.Name, err)
+	}
+	d.Sample = sample
+	return nil
+}
+
+// sampleOf returns a value that is valid for the type, taken from its enumeration, its patterns or its bounds.
+func sampleOf(t *simpleType) (string, error) {
+	c := constraintsOf(t)
+	candidates := append([]string{}, c.enumeration...)
+	for restriction := t; restriction != nil && restriction.base != nil; restriction = restriction.base {
+		for _, pattern := range restriction.facets.patterns {
+			candidates = append(candidates, patternSample(pattern))
+		}
+	}
+	switch {
+	case t.builtin.name == "boolean":
+		candidates = append(candidates, "true")
+	case t.builtin.numeric:
+		one := big.NewRat(1, 1)
+		for _, b := range []bound{c.lower, c.upper} {
+			if b.value == nil {
+				continue
+			}
+			candidates = append(candidates, b.value.RatString(),
+				new(big.Rat).Add(b.value, one).RatString(), new(big.Rat).Sub(b.value, one).RatString())
+		}
+		candidates = append(candidates, "1", "0")
+	default:
+		candidates = append(candidates, "text", strings.Repeat("a", c.minLength))
+	}
+	for _, candidate := range candidates {
+		if t.check(candidate) == nil {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("found no valid sample value for type '%s'", t.typeName())
+}
+
+// patternSample returns the shortest value the pattern matches, preferring letters and digits.
+func patternSample(pattern *regexp.Regexp) string {
+	re, err := syntax.Parse(pattern.String(), syntax.Perl)
+	if err != nil {
+		return ""
+	}
+	sample := &strings.Builder{}
+	writeSample(sample, re)
+	return sample.String()
+}
+
+func writeSample(sample *strings.Builder, re *syntax.Regexp) {
+	switch re.Op {
+	case syntax.OpLiteral:
+		sample.WriteString(string(re.Rune))
+	case syntax.OpCharClass:
+		sample.WriteRune(classSample(re.Rune))
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		sample.WriteRune('a')
+	case syntax.OpCapture, syntax.OpAlternate, syntax.OpPlus:
+		writeSample(sample, re.Sub[0])
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			writeSample(sample, sub)
+		}
+	case syntax.OpRepeat:
+		for i := 0; i < re.Min; i++ {
+			writeSample(sample, re.Sub[0])
+		}
+	}
+}
+
+// classSample picks a rune of the character class, which is given as pairs of ranges.
+func classSample(ranges []rune) rune {
+	for _, preferred := range []rune{'a', '0', 'A'} {
+		for i := 0; i+1 < len(ranges); i += 2 {
+			if ranges[i] <= preferred && preferred <= ranges[i+1] {
+				return preferred
+			}
+		}
+	}
+	if len(ranges) == 0 {
+		return 'a'
+	}
+	return ranges[0]
+}
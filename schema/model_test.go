@@ -0,0 +1,61 @@
+package schema
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"testing"
+)
+
+func TestDescribe_ShouldDescribeMessages(t *testing.T) {
+	xsd, err := ioutil.ReadFile("clustercode_v1.xsd")
+	require.NoError(t, err)
+
+	declarations, err := Describe(xsd)
+
+	require.NoError(t, err)
+	names := []string{}
+	for _, d := range declarations {
+		names = append(names, d.Name)
+	}
+	assert.Equal(t, []string{"SliceAddedEvent", "SliceCompletedEvent", "TaskAddedEvent", "TaskCancelledEvent",
+		"TaskCompletedEvent"}, names)
+	for _, d := range declarations {
+		for _, child := range d.Children {
+			if child.Type != "" {
+				assert.NotEmpty(t, child.Sample, "%s/%s", d.Name, child.Name)
+			}
+		}
+	}
+}
+
+func TestDescribe_ShouldRejectMixedContent(t *testing.T) {
+	_, err := Describe([]byte(`<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema">
+  <xs:element name="Note">
+    <xs:complexType mixed="true">
+      <xs:sequence>
+        <xs:element name="B" type="xs:string"/>
+      </xs:sequence>
+    </xs:complexType>
+  </xs:element>
+</xs:schema>`))
+	assert.Error(t, err)
+}
+
+func TestSampleOf_ShouldMatchPattern(t *testing.T) {
+	s, err := parseGoSchema([]byte(`<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema">
+  <xs:element name="Hash">
+    <xs:simpleType>
+      <xs:restriction base="xs:string">
+        <xs:pattern value="[0-9A-F]{4}-x"/>
+      </xs:restriction>
+    </xs:simpleType>
+  </xs:element>
+</xs:schema>`))
+	require.NoError(t, err)
+
+	sample, err := sampleOf(s.elements["Hash"].simple)
+
+	require.NoError(t, err)
+	assert.Equal(t, "0000-x", sample)
+}
@@ -1,18 +1,30 @@
 package schema
 
 import (
-	"errors"
 	"fmt"
-	"github.com/jbussdieker/golibxml"
-	"github.com/krolaw/xsd"
 	log "github.com/sirupsen/logrus"
-	"io/ioutil"
-	"unsafe"
+	"sort"
 )
 
 type (
+	// Validator validates messages against the schema version they declare. Messages without a version are
+	// validated against the latest schema.
 	Validator struct {
-		schema *xsd.Schema
+		// Backend is the name of the backend that compiles the schemas, DefaultBackend if empty.
+		Backend string
+		latest  compiledSchema
+		// latestVersion is the version of the latest schema, 0 if it is unknown.
+		latestVersion int
+		versions      map[int]compiledSchema
+	}
+	// Report is the outcome of validating a message.
+	Report struct {
+		// Root is the local name of the root element, empty if the message is not well-formed.
+		Root string
+		// Version is the schema version the message was validated against, 0 if that is the latest schema and its
+		// version is unknown.
+		Version    int
+		Violations []Violation
 	}
 )
 
@@ -22,34 +34,155 @@ func NewXmlValidator(path string) *Validator {
 	return v
 }
 
+// NewVersionedXmlValidator loads the latest schema from the given path and every version matching the file
+// pattern, which contains a single %d placeholder for the version, e.g. "schema/clustercode_v%d.xsd".
+func NewVersionedXmlValidator(backend string, latest string, pattern string) *Validator {
+	files, err := ReadFiles(latest, pattern)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return NewFilesValidator(backend, files)
+}
+
+// NewFilesValidator compiles the latest schema and every version of the given files.
+func NewFilesValidator(backend string, files *Files) *Validator {
+	v := &Validator{Backend: backend}
+	v.latest = v.compileSchema(files.Latest)
+	v.latestVersion = files.Latest.Version
+	v.versions = make(map[int]compiledSchema)
+	for _, version := range files.Versions() {
+		file, _ := files.Version(version)
+		v.versions[version] = v.compileSchema(file)
+	}
+	log.WithField("versions", v.Versions()).Debug("Loaded schema versions")
+	return v
+}
+
+// LoadXmlSchema loads the schema that is used for messages which do not declare a version.
 func (v *Validator) LoadXmlSchema(path string) {
-	log.WithField("path", path).Debug("Loading schema")
-	xsdfile, err := ioutil.ReadFile(path)
+	file, err := readFile(path, 0)
 	if err != nil {
 		log.Fatal(err)
 	}
-	xsdSchema, err := xsd.ParseSchema(xsdfile)
+	v.latest = v.compileSchema(file)
+}
+
+// LoadXmlSchemas loads every schema version matching the file pattern.
+func (v *Validator) LoadXmlSchemas(pattern string) {
+	files, err := readVersions(pattern)
 	if err != nil {
 		log.Fatal(err)
 	}
-	v.schema = xsdSchema
+	if v.versions == nil {
+		v.versions = make(map[int]compiledSchema)
+	}
+	for version, file := range files {
+		v.versions[version] = v.compileSchema(file)
+	}
+	log.WithFields(log.Fields{
+		"pattern":  pattern,
+		"versions": v.Versions(),
+	}).Debug("Loaded schema versions")
+}
+
+// Versions returns the loaded schema versions in ascending order.
+func (v *Validator) Versions() []int {
+	versions := make([]int, 0, len(v.versions))
+	for version := range v.versions {
+		versions = append(versions, version)
+	}
+	sort.Ints(versions)
+	return versions
 }
 
+func (v *Validator) IsLoaded() bool {
+	return v != nil && v.latest != nil
+}
+
+// ValidateXml validates the message against the schema version declared in the version attribute of its root
+// element, or against the latest schema if it does not declare one.
 func (v *Validator) ValidateXml(xml *string) (bool, error) {
-	if v.schema == nil {
+	return v.ValidateXmlVersion(xml, 0)
+}
+
+// ValidateXmlVersion is like ValidateXml, but uses the given version if the message does not declare one itself,
+// e.g. because it was passed along in a message header. A version of 0 stands for the latest schema.
+// Messages declaring a version that is not loaded are rejected, unless no versions have been loaded at all.
+// The returned error is a *ValidationError.
+func (v *Validator) ValidateXmlVersion(xml *string, version int) (bool, error) {
+	report := v.Validate(xml, version)
+	if report.Valid() {
+		return true, nil
+	}
+	return false, &ValidationError{Violations: report.Violations}
+}
+
+// Validate is like ValidateXmlVersion, but reports the root element and the version the message was validated
+// against as well.
+func (v *Validator) Validate(xml *string, version int) *Report {
+	if v.latest == nil {
 		log.Fatal("schema is not loaded")
 	}
-	doc := golibxml.ParseDoc(*xml)
-	if doc == nil {
-		return false, errors.New("provided XML string does not seem to be valid XML")
+	report := &Report{}
+	document, err := outline(*xml)
+	if err != nil {
+		report.Violations = err.(*ValidationError).Violations
+		return report
 	}
-	defer doc.Free()
-
-	// golibxml._Ctype_xmlDocPtr can't be cast to xsd.DocPtr, even though they are both
-	// essentially _Ctype_xmlDocPtr.  Using unsafe gets around this.
-	if err := v.schema.Validate(xsd.DocPtr(unsafe.Pointer(doc.Ptr))); err != nil {
-		return false, errors.New(fmt.Sprintln(err))
+	report.Root = document.children[0].name.Local
+	if declared := document.version(); declared > 0 {
+		version = declared
+	}
+	schema := v.latest
+	if version > 0 && len(v.versions) > 0 {
+		var known bool
+		if schema, known = v.versions[version]; !known {
+			report.Violations = []Violation{{
+				Message: fmt.Sprintf("schema version %d is not supported", version),
+			}}
+			return report
+		}
+		report.Version = version
 	} else {
-		return true, nil
+		report.Version = v.latestVersion
+	}
+
+	validationErr := &ValidationError{}
+	for _, violation := range schema.validate(*xml, document) {
+		violation.Line, violation.Column = document.locate(violation.Path)
+		validationErr.add(violation)
+	}
+	report.Violations = validationErr.Violations
+	return report
+}
+
+// Valid returns true if the message has no violations.
+func (r *Report) Valid() bool {
+	return len(r.Violations) == 0
+}
+
+func (v *Validator) compileSchema(file *File) compiledSchema {
+	log.WithFields(log.Fields{
+		"name":    file.Name,
+		"backend": v.Backend,
+	}).Debug("Loading schema")
+	compile, err := compilerOf(v.Backend)
+	if err != nil {
+		log.Fatal(err)
+	}
+	xsdSchema, err := compile(file.Content)
+	if err != nil {
+		log.WithField("name", file.Name).Fatal(err)
+	}
+	return xsdSchema
+}
+
+// versionOfPath extracts the version from a path that matched the glob of the file pattern.
+func versionOfPath(pattern string, path string) (int, bool) {
+	var version int
+	if _, err := fmt.Sscanf(path, pattern, &version); err != nil || version <= 0 {
+		return 0, false
 	}
+	// Sscanf ignores trailing input, so make sure the path does not just start like the pattern.
+	return version, fmt.Sprintf(pattern, version) == path
 }
@@ -85,24 +85,112 @@ var validationTests = []struct {
 }
 
 func TestValidation(t *testing.T) {
-	v := &Validator{}
-	v.LoadXmlSchema("clustercode_v1.xsd")
-	for _, tt := range validationTests {
-		t.Run(tt.name, func(t *testing.T) {
+	for _, backend := range Backends() {
+		v := &Validator{Backend: backend}
+		v.LoadXmlSchema("clustercode_v1.xsd")
+		for _, tt := range validationTests {
+			t.Run(backend+"/"+tt.name, func(t *testing.T) {
+
+				// get XML
+				path := filepath.Join("testdata", "xml", tt.testFile)
+				rawXmlBytes, ioErr := ioutil.ReadFile(path)
+				assert.NoError(t, ioErr)
+				xml := string(rawXmlBytes)
+
+				valid, err := v.ValidateXml(&xml)
+				if tt.isValid {
+					assert.NoError(t, err)
+					assert.True(t, valid)
+				} else {
+					assert.NotEmpty(t, err)
+					assert.False(t, valid)
+				}
+			})
+		}
+	}
+}
+
+var versionTests = []struct {
+	name     string
+	xml      string
+	version  int
+	expected bool
+}{
+	{"Unversioned_ValidatesAgainstLatest", `<Event><Name>a</Name><Priority>1</Priority></Event>`, 0, true},
+	{"DeclaredVersion1_RejectsNewElement", `<Event version="1"><Name>a</Name><Priority>1</Priority></Event>`, 0, false},
+	{"DeclaredVersion1_Valid", `<Event version="1"><Name>a</Name></Event>`, 0, true},
+	{"DeclaredVersion2_Valid", `<Event version="2"><Name>a</Name><Priority>1</Priority></Event>`, 0, true},
+	{"HeaderVersion1_RejectsNewElement", `<Event><Name>a</Name><Priority>1</Priority></Event>`, 1, false},
+	{"DeclaredVersion_TakesPrecedenceOverHeader", `<Event version="2"><Name>a</Name><Priority>1</Priority></Event>`, 1, true},
+	{"UnknownVersion", `<Event version="3"><Name>a</Name></Event>`, 0, false},
+	{"InvalidVersion", `<Event version="latest"><Name>a</Name></Event>`, 0, false},
+}
 
-			// get XML
-			path := filepath.Join("testdata", "xml", tt.testFile)
-			rawXmlBytes, ioErr := ioutil.ReadFile(path)
-			assert.NoError(t, ioErr)
-			xml := string(rawXmlBytes)
+func TestValidateXmlVersion(t *testing.T) {
+	for _, backend := range Backends() {
+		v := NewVersionedXmlValidator(backend,
+			filepath.Join("testdata", "xsd", "event_v2.xsd"),
+			filepath.Join("testdata", "xsd", "event_v%d.xsd"))
+		assert.Equal(t, []int{1, 2}, v.Versions())
+		for _, tt := range versionTests {
+			t.Run(backend+"/"+tt.name, func(t *testing.T) {
+				valid, err := v.ValidateXmlVersion(&tt.xml, tt.version)
+				assert.Equal(t, tt.expected, valid)
+				if !tt.expected {
+					assert.Error(t, err)
+				}
+			})
+		}
+	}
+}
 
-			valid, err := v.ValidateXml(&xml)
-			if tt.isValid {
-				assert.NoError(t, err)
-				assert.True(t, valid)
-			} else {
-				assert.NotEmpty(t, err)
-				assert.False(t, valid)
+func TestValidate_ShouldReportRootAndVersion(t *testing.T) {
+	v := NewVersionedXmlValidator("",
+		filepath.Join("testdata", "xsd", "event_v2.xsd"),
+		filepath.Join("testdata", "xsd", "event_v%d.xsd"))
+	tests := []struct {
+		name            string
+		xml             string
+		version         int
+		expectedRoot    string
+		expectedVersion int
+		expectedValid   bool
+	}{
+		{"Latest", `<Event><Name>a</Name></Event>`, 0, "Event", 2, true},
+		{"HeaderVersion", `<Event><Name>a</Name></Event>`, 1, "Event", 1, true},
+		{"DeclaredVersion", `<Event version="1"><Name>a</Name><Priority>1</Priority></Event>`, 2, "Event", 1, false},
+		{"UnknownVersion", `<Event version="3"><Name>a</Name></Event>`, 0, "Event", 0, false},
+		{"NotWellFormed", `<Event>`, 0, "", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := v.Validate(&tt.xml, tt.version)
+			assert.Equal(t, tt.expectedRoot, report.Root)
+			assert.Equal(t, tt.expectedVersion, report.Version)
+			assert.Equal(t, tt.expectedValid, report.Valid())
+		})
+	}
+}
+
+func TestVersionOfPath(t *testing.T) {
+	pattern := "schema/clustercode_v%d.xsd"
+	tests := []struct {
+		path     string
+		version  int
+		expected bool
+	}{
+		{"schema/clustercode_v1.xsd", 1, true},
+		{"schema/clustercode_v12.xsd", 12, true},
+		{"schema/clustercode_v0.xsd", 0, false},
+		{"schema/clustercode_v1.xsd.bak", 1, false},
+		{"schema/clustercode_vX.xsd", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			version, ok := versionOfPath(pattern, tt.path)
+			assert.Equal(t, tt.expected, ok)
+			if ok {
+				assert.Equal(t, tt.version, version)
 			}
 		})
 	}
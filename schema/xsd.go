@@ -0,0 +1,568 @@
+package schema
+
+import (
+	xml2 "encoding/xml"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// The pure Go backend supports the subset of XSD that the clustercode schemas use: global elements, named and
+// anonymous complex types with xs:sequence, xs:choice or xs:all of elements, attributes, simple content extensions
+// and simple type restrictions of the built-in types. Schemas using anything else are rejected when compiled.
+
+type (
+	goSchema struct {
+		targetNamespace string
+		qualified       bool
+		elements        map[string]*elementDecl
+	}
+	elementDecl struct {
+		name      string
+		minOccurs int
+		// maxOccurs is -1 for unbounded.
+		maxOccurs int
+		// Exactly one of the types is set.
+		complex *complexType
+		simple  *simpleType
+	}
+	complexType struct {
+		// name is empty for anonymous types.
+		name string
+		// group is nil if the type has no element content.
+		group      *modelGroup
+		attributes []*attributeDecl
+		// content is the type of the character data of simple content types.
+		content *simpleType
+		mixed   bool
+	}
+	modelGroup struct {
+		// kind is either sequence, choice or all.
+		kind      string
+		minOccurs int
+		maxOccurs int
+		elements  []*elementDecl
+	}
+	attributeDecl struct {
+		name     string
+		required bool
+		simple   *simpleType
+	}
+	// simpleType is a built-in type or a restriction of another simple type.
+	simpleType struct {
+		name    string
+		base    *simpleType
+		builtin *builtinType
+		facets  facets
+	}
+	facets struct {
+		length, minLength, maxLength           *int
+		minInclusive, maxInclusive             *big.Rat
+		minExclusive, maxExclusive             *big.Rat
+		patterns                               []*regexp.Regexp
+		patternSources, enumeration            []string
+		minInclusiveSource, maxInclusiveSource string
+		minExclusiveSource, maxExclusiveSource string
+	}
+
+	// The xsd* types map the XSD document. Children that are not mapped end up in Unsupported.
+	xsdSchema struct {
+		TargetNamespace      string           `xml:"targetNamespace,attr"`
+		ElementFormDefault   string           `xml:"elementFormDefault,attr"`
+		AttributeFormDefault string           `xml:"attributeFormDefault,attr"`
+		Elements             []xsdElement     `xml:"element"`
+		ComplexTypes         []xsdComplexType `xml:"complexType"`
+		SimpleTypes          []xsdSimpleType  `xml:"simpleType"`
+		Unsupported          []xsdNode        `xml:",any"`
+	}
+	xsdElement struct {
+		Name        string          `xml:"name,attr"`
+		Ref         string          `xml:"ref,attr"`
+		Type        string          `xml:"type,attr"`
+		MinOccurs   string          `xml:"minOccurs,attr"`
+		MaxOccurs   string          `xml:"maxOccurs,attr"`
+		ComplexType *xsdComplexType `xml:"complexType"`
+		SimpleType  *xsdSimpleType  `xml:"simpleType"`
+		Unsupported []xsdNode       `xml:",any"`
+	}
+	xsdComplexType struct {
+		Name          string            `xml:"name,attr"`
+		Mixed         string            `xml:"mixed,attr"`
+		Sequence      *xsdGroup         `xml:"sequence"`
+		Choice        *xsdGroup         `xml:"choice"`
+		All           *xsdGroup         `xml:"all"`
+		SimpleContent *xsdSimpleContent `xml:"simpleContent"`
+		Attributes    []xsdAttribute    `xml:"attribute"`
+		Unsupported   []xsdNode         `xml:",any"`
+	}
+	xsdGroup struct {
+		XMLName     xml2.Name
+		MinOccurs   string       `xml:"minOccurs,attr"`
+		MaxOccurs   string       `xml:"maxOccurs,attr"`
+		Elements    []xsdElement `xml:"element"`
+		Unsupported []xsdNode    `xml:",any"`
+	}
+	xsdSimpleContent struct {
+		Extension   *xsdExtension `xml:"extension"`
+		Unsupported []xsdNode     `xml:",any"`
+	}
+	xsdExtension struct {
+		Base        string         `xml:"base,attr"`
+		Attributes  []xsdAttribute `xml:"attribute"`
+		Unsupported []xsdNode      `xml:",any"`
+	}
+	xsdAttribute struct {
+		Name        string         `xml:"name,attr"`
+		Ref         string         `xml:"ref,attr"`
+		Type        string         `xml:"type,attr"`
+		Use         string         `xml:"use,attr"`
+		SimpleType  *xsdSimpleType `xml:"simpleType"`
+		Unsupported []xsdNode      `xml:",any"`
+	}
+	xsdSimpleType struct {
+		Name        string          `xml:"name,attr"`
+		Restriction *xsdRestriction `xml:"restriction"`
+		Unsupported []xsdNode       `xml:",any"`
+	}
+	xsdRestriction struct {
+		Base         string     `xml:"base,attr"`
+		Length       *xsdFacet  `xml:"length"`
+		MinLength    *xsdFacet  `xml:"minLength"`
+		MaxLength    *xsdFacet  `xml:"maxLength"`
+		MinInclusive *xsdFacet  `xml:"minInclusive"`
+		MaxInclusive *xsdFacet  `xml:"maxInclusive"`
+		MinExclusive *xsdFacet  `xml:"minExclusive"`
+		MaxExclusive *xsdFacet  `xml:"maxExclusive"`
+		Patterns     []xsdFacet `xml:"pattern"`
+		Enumeration  []xsdFacet `xml:"enumeration"`
+		Unsupported  []xsdNode  `xml:",any"`
+	}
+	xsdFacet struct {
+		Value string `xml:"value,attr"`
+	}
+	xsdNode struct {
+		XMLName xml2.Name
+	}
+
+	// goCompiler resolves the named types of a schema while compiling it.
+	goCompiler struct {
+		complexTypes    map[string]*xsdComplexType
+		simpleTypes     map[string]*xsdSimpleType
+		compiledComplex map[string]*complexType
+		compiledSimple  map[string]*simpleType
+		// resolving detects circular type definitions.
+		resolving map[string]bool
+	}
+)
+
+func compileGoSchema(data []byte) (compiledSchema, error) {
+	schema, err := parseGoSchema(data)
+	if err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
+
+// parseGoSchema compiles the schema into the model that the pure Go backend validates with.
+func parseGoSchema(data []byte) (*goSchema, error) {
+	doc := xsdSchema{}
+	if err := xml2.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if err := checkSupported("schema", doc.Unsupported); err != nil {
+		return nil, err
+	}
+	c := &goCompiler{
+		complexTypes:    make(map[string]*xsdComplexType),
+		simpleTypes:     make(map[string]*xsdSimpleType),
+		compiledComplex: make(map[string]*complexType),
+		compiledSimple:  make(map[string]*simpleType),
+		resolving:       make(map[string]bool),
+	}
+	for i := range doc.ComplexTypes {
+		c.complexTypes[doc.ComplexTypes[i].Name] = &doc.ComplexTypes[i]
+	}
+	for i := range doc.SimpleTypes {
+		c.simpleTypes[doc.SimpleTypes[i].Name] = &doc.SimpleTypes[i]
+	}
+
+	schema := &goSchema{
+		targetNamespace: doc.TargetNamespace,
+		qualified:       doc.ElementFormDefault == "qualified",
+		elements:        make(map[string]*elementDecl),
+	}
+	if doc.AttributeFormDefault == "qualified" {
+		return nil, fmt.Errorf("attributeFormDefault 'qualified' is not supported")
+	}
+	// Named types are compiled even if no element uses them, so that mistakes show up early.
+	for name := range c.complexTypes {
+		if _, err := c.complexTypeNamed(name); err != nil {
+			return nil, err
+		}
+	}
+	for name := range c.simpleTypes {
+		if _, err := c.simpleTypeNamed(name); err != nil {
+			return nil, err
+		}
+	}
+	for i := range doc.Elements {
+		decl, err := c.element(&doc.Elements[i])
+		if err != nil {
+			return nil, err
+		}
+		if doc.Elements[i].MinOccurs != "" || doc.Elements[i].MaxOccurs != "" {
+			return nil, fmt.Errorf("element '%s': occurrences are not allowed on global elements", decl.name)
+		}
+		schema.elements[decl.name] = decl
+	}
+	return schema, nil
+}
+
+func (c *goCompiler) element(e *xsdElement) (*elementDecl, error) {
+	if e.Ref != "" {
+		return nil, fmt.Errorf("element references are not supported (ref '%s')", e.Ref)
+	}
+	if e.Name == "" {
+		return nil, fmt.Errorf("element without name")
+	}
+	if err := checkSupported("element '"+e.Name+"'", e.Unsupported); err != nil {
+		return nil, err
+	}
+	decl := &elementDecl{name: e.Name}
+	var err error
+	if decl.minOccurs, decl.maxOccurs, err = occurrences(e.MinOccurs, e.MaxOccurs); err != nil {
+		return nil, fmt.Errorf("element '%s': %s", e.Name, err)
+	}
+	switch {
+	case e.ComplexType != nil:
+		decl.complex, err = c.complexType(e.ComplexType)
+	case e.SimpleType != nil:
+		decl.simple, err = c.simpleType(e.SimpleType)
+	case e.Type != "":
+		decl.complex, decl.simple, err = c.typeNamed(e.Type)
+	default:
+		// Elements without type accept anything in XSD, which is not supported.
+		err = fmt.Errorf("no type declared")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("element '%s': %s", e.Name, err)
+	}
+	return decl, nil
+}
+
+// typeNamed resolves a type reference, which is either a complex or a simple type.
+func (c *goCompiler) typeNamed(qname string) (*complexType, *simpleType, error) {
+	name := localName(qname)
+	if _, exists := c.complexTypes[name]; exists && !isBuiltinReference(qname) {
+		complex, err := c.complexTypeNamed(name)
+		return complex, nil, err
+	}
+	simple, err := c.simpleTypeReference(qname)
+	return nil, simple, err
+}
+
+func (c *goCompiler) complexTypeNamed(name string) (*complexType, error) {
+	if compiled, exists := c.compiledComplex[name]; exists {
+		return compiled, nil
+	}
+	if c.resolving["complex:"+name] {
+		return nil, fmt.Errorf("type '%s' is defined recursively, which is not supported", name)
+	}
+	c.resolving["complex:"+name] = true
+	defer delete(c.resolving, "complex:"+name)
+	compiled, err := c.complexType(c.complexTypes[name])
+	if err != nil {
+		return nil, fmt.Errorf("type '%s': %s", name, err)
+	}
+	compiled.name = name
+	c.compiledComplex[name] = compiled
+	return compiled, nil
+}
+
+func (c *goCompiler) complexType(t *xsdComplexType) (*complexType, error) {
+	if err := checkSupported("complexType", t.Unsupported); err != nil {
+		return nil, err
+	}
+	compiled := &complexType{mixed: t.Mixed == "true" || t.Mixed == "1"}
+	groups := 0
+	for _, group := range []*xsdGroup{t.Sequence, t.Choice, t.All} {
+		if group == nil {
+			continue
+		}
+		groups++
+		compiledGroup, err := c.group(group)
+		if err != nil {
+			return nil, err
+		}
+		compiled.group = compiledGroup
+	}
+	attributes := t.Attributes
+	if t.SimpleContent != nil {
+		groups++
+		if err := checkSupported("simpleContent", t.SimpleContent.Unsupported); err != nil {
+			return nil, err
+		}
+		extension := t.SimpleContent.Extension
+		if extension == nil {
+			return nil, fmt.Errorf("simpleContent is only supported with an extension")
+		}
+		if err := checkSupported("extension", extension.Unsupported); err != nil {
+			return nil, err
+		}
+		content, err := c.simpleTypeReference(extension.Base)
+		if err != nil {
+			return nil, err
+		}
+		compiled.content = content
+		attributes = append(attributes, extension.Attributes...)
+	}
+	if groups > 1 {
+		return nil, fmt.Errorf("only one of sequence, choice, all or simpleContent is allowed")
+	}
+	for i := range attributes {
+		attribute, err := c.attribute(&attributes[i])
+		if err != nil {
+			return nil, err
+		}
+		compiled.attributes = append(compiled.attributes, attribute)
+	}
+	return compiled, nil
+}
+
+func (c *goCompiler) group(g *xsdGroup) (*modelGroup, error) {
+	kind := g.XMLName.Local
+	if err := checkSupported(kind, g.Unsupported); err != nil {
+		return nil, err
+	}
+	compiled := &modelGroup{kind: kind}
+	var err error
+	if compiled.minOccurs, compiled.maxOccurs, err = occurrences(g.MinOccurs, g.MaxOccurs); err != nil {
+		return nil, fmt.Errorf("%s: %s", kind, err)
+	}
+	if kind == "all" && compiled.maxOccurs != 1 {
+		return nil, fmt.Errorf("all: maxOccurs must be 1")
+	}
+	names := make(map[string]bool)
+	for i := range g.Elements {
+		decl, err := c.element(&g.Elements[i])
+		if err != nil {
+			return nil, err
+		}
+		if kind == "all" && decl.maxOccurs != 1 {
+			return nil, fmt.Errorf("element '%s': maxOccurs must be 1 within all", decl.name)
+		}
+		if names[decl.name] {
+			// Repeated elements would need backtracking to be matched, which is not supported.
+			return nil, fmt.Errorf("element '%s' is declared more than once in the same %s", decl.name, kind)
+		}
+		names[decl.name] = true
+		compiled.elements = append(compiled.elements, decl)
+	}
+	return compiled, nil
+}
+
+func (c *goCompiler) attribute(a *xsdAttribute) (*attributeDecl, error) {
+	if a.Ref != "" {
+		return nil, fmt.Errorf("attribute references are not supported (ref '%s')", a.Ref)
+	}
+	if err := checkSupported("attribute '"+a.Name+"'", a.Unsupported); err != nil {
+		return nil, err
+	}
+	decl := &attributeDecl{name: a.Name}
+	switch a.Use {
+	case "", "optional":
+	case "required":
+		decl.required = true
+	default:
+		return nil, fmt.Errorf("attribute '%s': use '%s' is not supported", a.Name, a.Use)
+	}
+	var err error
+	switch {
+	case a.SimpleType != nil:
+		decl.simple, err = c.simpleType(a.SimpleType)
+	case a.Type != "":
+		decl.simple, err = c.simpleTypeReference(a.Type)
+	default:
+		decl.simple = builtinSimpleType("anySimpleType")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("attribute '%s': %s", a.Name, err)
+	}
+	return decl, nil
+}
+
+func (c *goCompiler) simpleTypeReference(qname string) (*simpleType, error) {
+	name := localName(qname)
+	if _, exists := c.simpleTypes[name]; exists && !isBuiltinReference(qname) {
+		return c.simpleTypeNamed(name)
+	}
+	if simple := builtinSimpleType(name); simple != nil {
+		return simple, nil
+	}
+	return nil, fmt.Errorf("type '%s' is not defined or not supported", qname)
+}
+
+func (c *goCompiler) simpleTypeNamed(name string) (*simpleType, error) {
+	if compiled, exists := c.compiledSimple[name]; exists {
+		return compiled, nil
+	}
+	if c.resolving["simple:"+name] {
+		return nil, fmt.Errorf("type '%s' is defined recursively", name)
+	}
+	c.resolving["simple:"+name] = true
+	defer delete(c.resolving, "simple:"+name)
+	compiled, err := c.simpleType(c.simpleTypes[name])
+	if err != nil {
+		return nil, fmt.Errorf("type '%s': %s", name, err)
+	}
+	c.compiledSimple[name] = compiled
+	return compiled, nil
+}
+
+func (c *goCompiler) simpleType(t *xsdSimpleType) (*simpleType, error) {
+	if err := checkSupported("simpleType", t.Unsupported); err != nil {
+		return nil, err
+	}
+	r := t.Restriction
+	if r == nil {
+		return nil, fmt.Errorf("simple types are only supported as restriction")
+	}
+	if err := checkSupported("restriction", r.Unsupported); err != nil {
+		return nil, err
+	}
+	base, err := c.simpleTypeReference(r.Base)
+	if err != nil {
+		return nil, err
+	}
+	compiled := &simpleType{name: t.Name, base: base, builtin: base.builtin}
+	f := &compiled.facets
+	for _, length := range []struct {
+		facet  *xsdFacet
+		target **int
+	}{{r.Length, &f.length}, {r.MinLength, &f.minLength}, {r.MaxLength, &f.maxLength}} {
+		if length.facet == nil {
+			continue
+		}
+		value, err := strconv.Atoi(strings.TrimSpace(length.facet.Value))
+		if err != nil || value < 0 {
+			return nil, fmt.Errorf("invalid length '%s'", length.facet.Value)
+		}
+		*length.target = &value
+	}
+	for _, bound := range []struct {
+		facet  *xsdFacet
+		target **big.Rat
+		source *string
+	}{
+		{r.MinInclusive, &f.minInclusive, &f.minInclusiveSource},
+		{r.MaxInclusive, &f.maxInclusive, &f.maxInclusiveSource},
+		{r.MinExclusive, &f.minExclusive, &f.minExclusiveSource},
+		{r.MaxExclusive, &f.maxExclusive, &f.maxExclusiveSource},
+	} {
+		if bound.facet == nil {
+			continue
+		}
+		if !compiled.builtin.numeric {
+			return nil, fmt.Errorf("bounds are only supported for numeric types")
+		}
+		value, ok := new(big.Rat).SetString(strings.TrimSpace(bound.facet.Value))
+		if !ok {
+			return nil, fmt.Errorf("invalid bound '%s'", bound.facet.Value)
+		}
+		*bound.target = value
+		*bound.source = strings.TrimSpace(bound.facet.Value)
+	}
+	for _, pattern := range r.Patterns {
+		expression, err := compilePattern(pattern.Value)
+		if err != nil {
+			return nil, err
+		}
+		f.patterns = append(f.patterns, expression)
+		f.patternSources = append(f.patternSources, pattern.Value)
+	}
+	for _, enumeration := range r.Enumeration {
+		f.enumeration = append(f.enumeration, compiled.builtin.normalize(enumeration.Value))
+	}
+	return compiled, nil
+}
+
+// compilePattern translates an XSD regular expression, which always has to match the whole value and knows no
+// anchors. XSD specific escapes like \i and \c and character class subtraction are not supported.
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	translated := &strings.Builder{}
+	inClass := false
+	runes := []rune(pattern)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '\\' && i+1 < len(runes):
+			i++
+			if strings.ContainsRune("iIcC", runes[i]) {
+				return nil, fmt.Errorf("pattern '%s': escape \\%c is not supported", pattern, runes[i])
+			}
+			translated.WriteRune(r)
+			translated.WriteRune(runes[i])
+			continue
+		case inClass && r == '-' && i+1 < len(runes) && runes[i+1] == '[':
+			return nil, fmt.Errorf("pattern '%s': character class subtraction is not supported", pattern)
+		case inClass && r == ']':
+			inClass = false
+		case !inClass && r == '[':
+			inClass = true
+		case !inClass && (r == '^' || r == '$'):
+			translated.WriteRune('\\')
+		}
+		translated.WriteRune(r)
+	}
+	expression, err := regexp.Compile("^(?:" + translated.String() + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("pattern '%s': %s", pattern, err)
+	}
+	return expression, nil
+}
+
+func occurrences(minOccurs string, maxOccurs string) (int, int, error) {
+	min, max := 1, 1
+	var err error
+	if minOccurs != "" {
+		if min, err = strconv.Atoi(minOccurs); err != nil || min < 0 {
+			return 0, 0, fmt.Errorf("invalid minOccurs '%s'", minOccurs)
+		}
+	}
+	if maxOccurs == "unbounded" {
+		max = -1
+	} else if maxOccurs != "" {
+		if max, err = strconv.Atoi(maxOccurs); err != nil || max < 0 {
+			return 0, 0, fmt.Errorf("invalid maxOccurs '%s'", maxOccurs)
+		}
+	}
+	if max >= 0 && min > max {
+		return 0, 0, fmt.Errorf("minOccurs is greater than maxOccurs")
+	}
+	return min, max, nil
+}
+
+// checkSupported rejects XSD constructs the backend does not know. Annotations are ignored.
+func checkSupported(parent string, nodes []xsdNode) error {
+	for _, node := range nodes {
+		if node.XMLName.Local != "annotation" {
+			return fmt.Errorf("%s: xs:%s is not supported", parent, node.XMLName.Local)
+		}
+	}
+	return nil
+}
+
+func localName(qname string) string {
+	if i := strings.Index(qname, ":"); i >= 0 {
+		return qname[i+1:]
+	}
+	return qname
+}
+
+// isBuiltinReference tells whether a prefixed name refers to the XSD namespace. The prefixes of the schema are
+// not resolved, so the conventional xs and xsd prefixes are assumed.
+func isBuiltinReference(qname string) bool {
+	return strings.HasPrefix(qname, "xs:") || strings.HasPrefix(qname, "xsd:")
+}
@@ -0,0 +1,127 @@
+package schema
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+const subsetXsd = `<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema">
+  <xs:simpleType name="level">
+    <xs:restriction base="xs:int">
+      <xs:minInclusive value="1"/>
+      <xs:maxExclusive value="10"/>
+    </xs:restriction>
+  </xs:simpleType>
+  <xs:simpleType name="code">
+    <xs:restriction base="xs:string">
+      <xs:pattern value="[A-Z]{2}"/>
+      <xs:pattern value="\^[0-9]"/>
+    </xs:restriction>
+  </xs:simpleType>
+  <xs:element name="Order">
+    <xs:complexType>
+      <xs:sequence>
+        <xs:element name="Id" type="xs:positiveInteger"/>
+        <xs:element name="Code" type="code" minOccurs="0"/>
+        <xs:element name="Items" minOccurs="0">
+          <xs:complexType>
+            <xs:choice maxOccurs="unbounded">
+              <xs:element name="Item" type="xs:string"/>
+              <xs:element name="Gift" type="xs:string"/>
+            </xs:choice>
+          </xs:complexType>
+        </xs:element>
+        <xs:element name="Note" maxOccurs="2">
+          <xs:complexType>
+            <xs:simpleContent>
+              <xs:extension base="xs:token">
+                <xs:attribute name="level" type="level" use="required"/>
+              </xs:extension>
+            </xs:simpleContent>
+          </xs:complexType>
+        </xs:element>
+      </xs:sequence>
+    </xs:complexType>
+  </xs:element>
+</xs:schema>`
+
+var goBackendTests = []struct {
+	name         string
+	xml          string
+	expectedPath string
+	facet        string
+}{
+	{name: "Valid", xml: `<Order><Id> 1 </Id><Code>AB</Code><Items><Item>a</Item><Gift>b</Gift><Item>c</Item></Items><Note level="9">x</Note></Order>`},
+	{name: "AlternativePattern", xml: `<Order><Id>1</Id><Code>^1</Code><Note level="1"/></Order>`},
+	{name: "PatternIsAnchored", xml: `<Order><Id>1</Id><Code>ABC</Code><Note level="1"/></Order>`, expectedPath: "/Order/Code", facet: "pattern"},
+	{name: "InvalidBuiltin", xml: `<Order><Id>0</Id><Note level="1"/></Order>`, expectedPath: "/Order/Id"},
+	{name: "MissingRequiredElement", xml: `<Order><Code>AB</Code><Note level="1"/></Order>`, expectedPath: "/Order/Code"},
+	{name: "MissingTrailingElement", xml: `<Order><Id>1</Id><Items><Item>a</Item></Items></Order>`, expectedPath: "/Order"},
+	{name: "WrongOrder", xml: `<Order><Id>1</Id><Note level="1"/><Items><Item>a</Item></Items></Order>`, expectedPath: "/Order/Items"},
+	{name: "EmptyRequiredChoice", xml: `<Order><Id>1</Id><Items/><Note level="1"/></Order>`, expectedPath: "/Order/Items"},
+	{name: "UnknownAlternative", xml: `<Order><Id>1</Id><Items><Item>a</Item><Box/></Items><Note level="1"/></Order>`, expectedPath: "/Order/Items/Box"},
+	{name: "TooManyOccurrences", xml: `<Order><Id>1</Id><Note level="1"/><Note level="1"/><Note level="1"/></Order>`, expectedPath: "/Order/Note[3]"},
+	{name: "MissingAttribute", xml: `<Order><Id>1</Id><Note/></Order>`, expectedPath: "/Order/Note"},
+	{name: "UnknownAttribute", xml: `<Order><Id>1</Id><Note level="1" color="red"/></Order>`, expectedPath: "/Order/Note/@color"},
+	{name: "AttributeBelowMinimum", xml: `<Order><Id>1</Id><Note level="0"/></Order>`, expectedPath: "/Order/Note/@level", facet: "minInclusive"},
+	{name: "AttributeAtExclusiveMaximum", xml: `<Order><Id>1</Id><Note level="10"/></Order>`, expectedPath: "/Order/Note/@level", facet: "maxExclusive"},
+	{name: "ElementInSimpleContent", xml: `<Order><Id>1</Id><Note level="1"><B/></Note></Order>`, expectedPath: "/Order/Note"},
+	{name: "TextInElementOnlyContent", xml: `<Order>text<Id>1</Id><Note level="1"/></Order>`, expectedPath: "/Order"},
+	{name: "UnknownRoot", xml: `<Invoice/>`, expectedPath: "/Invoice"},
+	{name: "UnexpectedNamespace", xml: `<Order xmlns="urn:other"><Id>1</Id><Note level="1"/></Order>`, expectedPath: "/Order"},
+}
+
+func TestGoBackend_ShouldValidateSubset(t *testing.T) {
+	compiled, err := compileGoSchema([]byte(subsetXsd))
+	require.NoError(t, err)
+	for _, tt := range goBackendTests {
+		t.Run(tt.name, func(t *testing.T) {
+			document, err := outline(tt.xml)
+			require.NoError(t, err)
+
+			violations := compiled.validate(tt.xml, document)
+
+			if tt.expectedPath == "" {
+				assert.Empty(t, violations)
+				return
+			}
+			require.NotEmpty(t, violations)
+			assert.Equal(t, tt.expectedPath, violations[0].Path, violations[0].Message)
+			assert.Equal(t, tt.facet, violations[0].Facet)
+		})
+	}
+}
+
+func TestGoBackend_ShouldRejectUnsupportedSchemas(t *testing.T) {
+	tests := map[string]string{
+		"Import":              `<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema"><xs:import namespace="urn:x"/></xs:schema>`,
+		"ElementReference":    `<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema"><xs:element name="A"><xs:complexType><xs:sequence><xs:element ref="B"/></xs:sequence></xs:complexType></xs:element></xs:schema>`,
+		"ComplexContent":      `<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema"><xs:complexType name="A"><xs:complexContent/></xs:complexType></xs:schema>`,
+		"Union":               `<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema"><xs:simpleType name="A"><xs:union memberTypes="xs:int"/></xs:simpleType></xs:schema>`,
+		"UnknownType":         `<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema"><xs:element name="A" type="xs:dateTime"/></xs:schema>`,
+		"ClassSubtraction":    `<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema"><xs:simpleType name="A"><xs:restriction base="xs:string"><xs:pattern value="[a-z-[aeiou]]"/></xs:restriction></xs:simpleType></xs:schema>`,
+		"NameCharacterEscape": `<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema"><xs:simpleType name="A"><xs:restriction base="xs:string"><xs:pattern value="\i\c*"/></xs:restriction></xs:simpleType></xs:schema>`,
+		"RecursiveType":       `<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema"><xs:complexType name="A"><xs:sequence><xs:element name="A" type="A" minOccurs="0"/></xs:sequence></xs:complexType></xs:schema>`,
+		"NestedGroup":         `<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema"><xs:complexType name="A"><xs:sequence><xs:choice/></xs:sequence></xs:complexType></xs:schema>`,
+		"RepeatedElement":     `<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema"><xs:complexType name="A"><xs:sequence><xs:element name="B" type="xs:string"/><xs:element name="B" type="xs:int"/></xs:sequence></xs:complexType></xs:schema>`,
+	}
+	for name, xsd := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := compileGoSchema([]byte(xsd))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestGoBackend_ShouldCompareEnumeratedNumbersByValue(t *testing.T) {
+	v := &Validator{Backend: BackendGo}
+	v.LoadXmlSchema("clustercode_v1.xsd")
+	xml := `<SliceCompletedEvent><JobId>620b8251-52a1-4ecd-8adc-4fb280214bba</JobId><SliceNr>1</SliceNr>` +
+		`<StdStreams><L fd="01">line</L></StdStreams></SliceCompletedEvent>`
+
+	valid, err := v.ValidateXml(&xml)
+
+	assert.NoError(t, err)
+	assert.True(t, valid)
+}
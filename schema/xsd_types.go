@@ -0,0 +1,194 @@
+package schema
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+type (
+	// builtinType is a primitive or derived XSD type with its lexical space.
+	builtinType struct {
+		name string
+		// collapse is true for types whose whitespace is collapsed before validation.
+		collapse bool
+		numeric  bool
+		lexical  *regexp.Regexp
+		// min and max bound numeric types, nil if unbounded.
+		min, max *big.Rat
+	}
+	// invalidValue describes why a value is not valid for a simple type. The facet is empty if the value is not
+	// in the lexical or value space of the builtin type.
+	invalidValue struct {
+		facet   string
+		value   string
+		message string
+	}
+)
+
+var (
+	integerLexical = regexp.MustCompile(`^[+-]?[0-9]+$`)
+	decimalLexical = regexp.MustCompile(`^[+-]?([0-9]+(\.[0-9]*)?|\.[0-9]+)$`)
+	whitespace     = regexp.MustCompile(`[ \t\r\n]+`)
+
+	builtinTypes = map[string]*builtinType{
+		"anySimpleType":      {name: "anySimpleType"},
+		"string":             {name: "string"},
+		"normalizedString":   {name: "normalizedString"},
+		"token":              {name: "token", collapse: true},
+		"anyURI":             {name: "anyURI", collapse: true},
+		"boolean":            {name: "boolean", collapse: true, lexical: regexp.MustCompile(`^(true|false|1|0)$`)},
+		"decimal":            {name: "decimal", collapse: true, numeric: true, lexical: decimalLexical},
+		"integer":            {name: "integer", collapse: true, numeric: true, lexical: integerLexical},
+		"nonNegativeInteger": {name: "nonNegativeInteger", collapse: true, numeric: true, lexical: integerLexical, min: big.NewRat(0, 1)},
+		"positiveInteger":    {name: "positiveInteger", collapse: true, numeric: true, lexical: integerLexical, min: big.NewRat(1, 1)},
+		"nonPositiveInteger": {name: "nonPositiveInteger", collapse: true, numeric: true, lexical: integerLexical, max: big.NewRat(0, 1)},
+		"negativeInteger":    {name: "negativeInteger", collapse: true, numeric: true, lexical: integerLexical, max: big.NewRat(-1, 1)},
+		"long":               {name: "long", collapse: true, numeric: true, lexical: integerLexical, min: ratOf("-9223372036854775808"), max: ratOf("9223372036854775807")},
+		"int":                {name: "int", collapse: true, numeric: true, lexical: integerLexical, min: big.NewRat(-2147483648, 1), max: big.NewRat(2147483647, 1)},
+		"short":              {name: "short", collapse: true, numeric: true, lexical: integerLexical, min: big.NewRat(-32768, 1), max: big.NewRat(32767, 1)},
+		"byte":               {name: "byte", collapse: true, numeric: true, lexical: integerLexical, min: big.NewRat(-128, 1), max: big.NewRat(127, 1)},
+		"unsignedLong":       {name: "unsignedLong", collapse: true, numeric: true, lexical: integerLexical, min: big.NewRat(0, 1), max: ratOf("18446744073709551615")},
+		"unsignedInt":        {name: "unsignedInt", collapse: true, numeric: true, lexical: integerLexical, min: big.NewRat(0, 1), max: big.NewRat(4294967295, 1)},
+		"unsignedShort":      {name: "unsignedShort", collapse: true, numeric: true, lexical: integerLexical, min: big.NewRat(0, 1), max: big.NewRat(65535, 1)},
+		"unsignedByte":       {name: "unsignedByte", collapse: true, numeric: true, lexical: integerLexical, min: big.NewRat(0, 1), max: big.NewRat(255, 1)},
+	}
+)
+
+func ratOf(value string) *big.Rat {
+	rat, _ := new(big.Rat).SetString(value)
+	return rat
+}
+
+func builtinSimpleType(name string) *simpleType {
+	builtin, exists := builtinTypes[name]
+	if !exists {
+		return nil
+	}
+	return &simpleType{name: "xs:" + name, builtin: builtin}
+}
+
+// normalize applies the whitespace handling of the type to the value.
+func (b *builtinType) normalize(value string) string {
+	switch {
+	case b.collapse:
+		return strings.TrimSpace(whitespace.ReplaceAllString(value, " "))
+	case b.name == "normalizedString":
+		return strings.NewReplacer("\t", " ", "\r", " ", "\n", " ").Replace(value)
+	}
+	return value
+}
+
+// check describes with a libxml2 style message why the value is not valid for the type, or returns nil.
+func (t *simpleType) check(raw string) *invalidValue {
+	value := t.builtin.normalize(raw)
+	if invalid := t.builtin.check(value, t.typeName()); invalid != nil {
+		return invalid
+	}
+	for restriction := t; restriction != nil && restriction.base != nil; restriction = restriction.base {
+		if invalid := restriction.facets.check(value, t.builtin.numeric); invalid != nil {
+			return invalid
+		}
+	}
+	return nil
+}
+
+// typeName is the name of the type as it appears in messages.
+func (t *simpleType) typeName() string {
+	if t.name == "" {
+		return "local atomic type"
+	}
+	return t.name
+}
+
+func (b *builtinType) check(value string, typeName string) *invalidValue {
+	valid := b.lexical == nil || b.lexical.MatchString(value)
+	if valid && b.numeric {
+		number := ratOf(value)
+		valid = (b.min == nil || number.Cmp(b.min) >= 0) && (b.max == nil || number.Cmp(b.max) <= 0)
+	}
+	if valid {
+		return nil
+	}
+	return &invalidValue{
+		value:   value,
+		message: fmt.Sprintf("'%s' is not a valid value of the atomic type '%s'.", value, typeName),
+	}
+}
+
+func (f *facets) check(value string, numeric bool) *invalidValue {
+	length := utf8.RuneCountInString(value)
+	if f.length != nil && length != *f.length {
+		return facetViolation("length", value, "The value '%s' has a length of '%d'; this differs from the allowed length of '%d'.",
+			value, length, *f.length)
+	}
+	if f.minLength != nil && length < *f.minLength {
+		return facetViolation("minLength", value, "The value '%s' has a length of '%d'; this underruns the allowed minimum length of '%d'.",
+			value, length, *f.minLength)
+	}
+	if f.maxLength != nil && length > *f.maxLength {
+		return facetViolation("maxLength", value, "The value '%s' has a length of '%d'; this exceeds the allowed maximum length of '%d'.",
+			value, length, *f.maxLength)
+	}
+	if len(f.patterns) > 0 && !f.matchesPattern(value) {
+		// Patterns of the same restriction are alternatives, libxml2 reports the last one.
+		return facetViolation("pattern", value, "The value '%s' is not accepted by the pattern '%s'.",
+			value, f.patternSources[len(f.patternSources)-1])
+	}
+	if len(f.enumeration) > 0 && !isEnumerated(f.enumeration, value, numeric) {
+		return facetViolation("enumeration", value, "The value '%s' is not an element of the set {'%s'}.",
+			value, strings.Join(f.enumeration, "', '"))
+	}
+	if f.minInclusive == nil && f.maxInclusive == nil && f.minExclusive == nil && f.maxExclusive == nil {
+		return nil
+	}
+	number := ratOf(value)
+	switch {
+	case f.minInclusive != nil && number.Cmp(f.minInclusive) < 0:
+		return facetViolation("minInclusive", value, "The value '%s' is less than the minimum value allowed ('%s').",
+			value, f.minInclusiveSource)
+	case f.maxInclusive != nil && number.Cmp(f.maxInclusive) > 0:
+		return facetViolation("maxInclusive", value, "The value '%s' is greater than the maximum value allowed ('%s').",
+			value, f.maxInclusiveSource)
+	case f.minExclusive != nil && number.Cmp(f.minExclusive) <= 0:
+		return facetViolation("minExclusive", value, "The value '%s' must be greater than '%s'.", value, f.minExclusiveSource)
+	case f.maxExclusive != nil && number.Cmp(f.maxExclusive) >= 0:
+		return facetViolation("maxExclusive", value, "The value '%s' must be less than '%s'.", value, f.maxExclusiveSource)
+	}
+	return nil
+}
+
+// facetViolation formats the message like libxml2, with the name of the failing facet in front.
+func facetViolation(facet string, value string, format string, args ...interface{}) *invalidValue {
+	return &invalidValue{
+		facet:   facet,
+		value:   value,
+		message: fmt.Sprintf("[facet '%s'] "+format, append([]interface{}{facet}, args...)...),
+	}
+}
+
+func (f *facets) matchesPattern(value string) bool {
+	for _, pattern := range f.patterns {
+		if pattern.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// isEnumerated compares numbers by value, so that 01 matches an enumerated 1.
+func isEnumerated(enumeration []string, value string, numeric bool) bool {
+	for _, allowed := range enumeration {
+		if value == allowed {
+			return true
+		}
+		if numeric {
+			if number, ok := new(big.Rat).SetString(allowed); ok && number.Cmp(ratOf(value)) == 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
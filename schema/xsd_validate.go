@@ -0,0 +1,253 @@
+package schema
+
+import (
+	"fmt"
+	"strings"
+)
+
+const xsiNamespace = "http://www.w3.org/2001/XMLSchema-instance"
+
+type (
+	// goValidation collects the violations of a single document.
+	goValidation struct {
+		schema     *goSchema
+		violations []Violation
+	}
+)
+
+func (s *goSchema) validate(xml string, document *element) []Violation {
+	v := &goValidation{schema: s}
+	root := document.children[0]
+	path := document.childPaths("")[0]
+	decl, declared := s.elements[root.name.Local]
+	if !declared || root.name.Space != s.targetNamespace {
+		v.report(path, root, "No matching global declaration available for the validation root.")
+		return v.violations
+	}
+	v.element(path, root, decl)
+	return v.violations
+}
+
+func (v *goValidation) report(path string, el *element, message string) {
+	v.reportValue(path, el, &invalidValue{message: message})
+}
+
+// reportValue fills in the facet and value itself, so that they don't have to be parsed from the message.
+func (v *goValidation) reportValue(path string, el *element, invalid *invalidValue) {
+	v.violations = append(v.violations, Violation{
+		Path:    path,
+		Facet:   invalid.facet,
+		Value:   invalid.value,
+		Message: fmt.Sprintf("Element '%s': %s", el.name.Local, invalid.message),
+	})
+}
+
+func (v *goValidation) reportAttribute(path string, el *element, name string, invalid *invalidValue) {
+	v.violations = append(v.violations, Violation{
+		Path:    path + "/@" + name,
+		Facet:   invalid.facet,
+		Value:   invalid.value,
+		Message: fmt.Sprintf("Element '%s', attribute '%s': %s", el.name.Local, name, invalid.message),
+	})
+}
+
+func (v *goValidation) element(path string, el *element, decl *elementDecl) {
+	if decl.simple != nil {
+		v.attributes(path, el, nil)
+		if len(el.children) > 0 {
+			v.report(path, el, "Element content is not allowed, because the content type is a simple type definition.")
+			return
+		}
+		if invalid := decl.simple.check(el.text); invalid != nil {
+			v.reportValue(path, el, invalid)
+		}
+		return
+	}
+
+	t := decl.complex
+	v.attributes(path, el, t.attributes)
+	switch {
+	case t.content != nil:
+		if len(el.children) > 0 {
+			v.report(path, el, "Element content is not allowed, because the content type is a simple type definition.")
+			return
+		}
+		if invalid := t.content.check(el.text); invalid != nil {
+			v.reportValue(path, el, invalid)
+		}
+		return
+	case t.group == nil:
+		if len(el.children) > 0 {
+			v.report(path, el, "Element content is not allowed, because the content type is empty.")
+			return
+		}
+		if !t.mixed && strings.TrimSpace(el.text) != "" {
+			v.report(path, el, "Character content is not allowed, because the content type is empty.")
+		}
+		return
+	}
+	if !t.mixed && strings.TrimSpace(el.text) != "" {
+		v.report(path, el, "Character content other than whitespace is not allowed because the content type is 'element-only'.")
+	}
+	childPaths := el.childPaths(path)
+	for i, child := range el.children {
+		if child.name.Space != v.schema.childNamespace() {
+			v.report(childPaths[i], child, "This element is not expected.")
+			return
+		}
+	}
+	if t.group.kind == "all" {
+		v.all(path, el, childPaths, t.group)
+	} else {
+		v.sequence(path, el, childPaths, t.group)
+	}
+}
+
+func (s *goSchema) childNamespace() string {
+	if s.qualified {
+		return s.targetNamespace
+	}
+	return ""
+}
+
+func (v *goValidation) attributes(path string, el *element, decls []*attributeDecl) {
+	present := make(map[string]bool)
+	for _, attr := range el.attributes {
+		if attr.Name.Space == "xmlns" || (attr.Name.Space == "" && attr.Name.Local == "xmlns") || attr.Name.Space == xsiNamespace {
+			continue
+		}
+		decl := findAttribute(decls, attr.Name.Local)
+		if decl == nil || attr.Name.Space != "" {
+			v.reportAttribute(path, el, attr.Name.Local,
+				&invalidValue{message: "The attribute '" + attr.Name.Local + "' is not allowed."})
+			continue
+		}
+		present[decl.name] = true
+		if invalid := decl.simple.check(attr.Value); invalid != nil {
+			v.reportAttribute(path, el, attr.Name.Local, invalid)
+		}
+	}
+	for _, decl := range decls {
+		if decl.required && !present[decl.name] {
+			v.report(path, el, fmt.Sprintf("The attribute '%s' is required but missing.", decl.name))
+		}
+	}
+}
+
+func findAttribute(decls []*attributeDecl, name string) *attributeDecl {
+	for _, decl := range decls {
+		if decl.name == name {
+			return decl
+		}
+	}
+	return nil
+}
+
+// all matches the children in any order, each declared element at most once.
+func (v *goValidation) all(path string, el *element, childPaths []string, group *modelGroup) {
+	seen := make(map[string]bool)
+	for i, child := range el.children {
+		decl := group.find(child.name.Local)
+		if decl == nil || seen[decl.name] {
+			v.report(childPaths[i], child, "This element is not expected.")
+			return
+		}
+		seen[decl.name] = true
+		v.element(childPaths[i], child, decl)
+	}
+	if len(el.children) == 0 && group.minOccurs == 0 {
+		return
+	}
+	var missing []string
+	for _, decl := range group.elements {
+		if decl.minOccurs > 0 && !seen[decl.name] {
+			missing = append(missing, decl.name)
+		}
+	}
+	if len(missing) > 0 {
+		v.report(path, el, expected("Missing child element(s).", missing))
+	}
+}
+
+// sequence matches the children against repetitions of a sequence or choice. Since the element names within a
+// group are unique, matching greedily is deterministic and needs no backtracking.
+func (v *goValidation) sequence(path string, el *element, childPaths []string, group *modelGroup) {
+	i := 0
+	for repetition := 0; group.maxOccurs < 0 || repetition < group.maxOccurs; repetition++ {
+		start := i
+		var missing []string
+		if group.kind == "choice" {
+			missing = v.choice(el, childPaths, group, &i)
+		} else {
+			for _, decl := range group.elements {
+				count := 0
+				for i < len(el.children) && el.children[i].name.Local == decl.name && (decl.maxOccurs < 0 || count < decl.maxOccurs) {
+					v.element(childPaths[i], el.children[i], decl)
+					i++
+					count++
+				}
+				if count < decl.minOccurs {
+					missing = []string{decl.name}
+					break
+				}
+			}
+		}
+		if i == start && (repetition >= group.minOccurs || len(missing) == 0) {
+			break
+		}
+		if len(missing) > 0 {
+			if i < len(el.children) {
+				v.report(childPaths[i], el.children[i], expected("This element is not expected.", missing))
+			} else {
+				v.report(path, el, expected("Missing child element(s).", missing))
+			}
+			return
+		}
+	}
+	if i < len(el.children) {
+		v.report(childPaths[i], el.children[i], "This element is not expected.")
+	}
+}
+
+// choice matches one child against the alternatives and returns them if none matches but one is required.
+func (v *goValidation) choice(el *element, childPaths []string, group *modelGroup, i *int) []string {
+	if *i < len(el.children) {
+		if decl := group.find(el.children[*i].name.Local); decl != nil {
+			count := 0
+			for *i < len(el.children) && el.children[*i].name.Local == decl.name && (decl.maxOccurs < 0 || count < decl.maxOccurs) {
+				v.element(childPaths[*i], el.children[*i], decl)
+				*i++
+				count++
+			}
+			if count < decl.minOccurs {
+				return []string{decl.name}
+			}
+			return nil
+		}
+	}
+	var alternatives []string
+	for _, decl := range group.elements {
+		if decl.minOccurs == 0 {
+			// An optional alternative matches nothing.
+			return nil
+		}
+		alternatives = append(alternatives, decl.name)
+	}
+	return alternatives
+}
+
+func (g *modelGroup) find(name string) *elementDecl {
+	for _, decl := range g.elements {
+		if decl.name == name {
+			return decl
+		}
+	}
+	return nil
+}
+
+func expected(message string, names []string) string {
+	if len(names) == 1 {
+		return fmt.Sprintf("%s Expected is ( %s ).", message, names[0])
+	}
+	return fmt.Sprintf("%s Expected is one of ( %s ).", message, strings.Join(names, ", "))
+}